@@ -109,6 +109,15 @@ func main() {
 	flag.StringVar(&utils.Options.PathCustomUserData, "userdata", "", locale.Loc("custom_user_data", nil))
 	flag.String("lang", "", "lang")
 	flag.BoolVar(&utils.Options.Capture, "capture", false, "Capture pcap2 file")
+	flag.IntVar(&utils.Options.Spectators, "spectators", 0, "how many extra clients may join a proxy session to watch, replays play in realtime when set")
+	flag.IntVar(&utils.Options.Reconnect, "reconnect", 0, "how often to try reconnecting when the server connection is lost, the client waits in the loading screen")
+	flag.IntVar(&utils.Options.InjectRate, "inject-rate", 0, "how many packets the proxy sends on its own per second to each side, 0 for no limit")
+	flag.StringVar(&utils.Options.Listen.Address, "listen", utils.DefaultListenAddress, "address the proxy listens on, like 0.0.0.0:19132 or [::]:19132")
+	flag.StringVar(&utils.Options.Listen.MOTD, "motd", "", "name of the proxy in the server list")
+	flag.IntVar(&utils.Options.Listen.PlayerCount, "player-count", 0, "player count shown in the server list")
+	flag.IntVar(&utils.Options.Listen.MaxPlayers, "max-players", 0, "max players shown in the server list")
+	flag.BoolVar(&utils.Options.Listen.MirrorStatus, "mirror-status", false, "show the name and player count of the server in the server list")
+	flag.BoolVar(&utils.Options.Listen.HideFromLAN, "hide-lan", false, "dont show the proxy in the LAN tab, add it as a server to join")
 
 	subcommands.Register(subcommands.HelpCommand(), "")
 	subcommands.ImportantFlag("debug")
@@ -134,14 +134,22 @@ func NewPacketCapturer() *proxy.Handler {
 		AddressAndName:  p.AddressAndName,
 		OnServerConnect: p.OnServerConnect,
 		PacketRaw:       p.PacketFunc,
-		OnEnd: func() {
-			p.dumpLock.Lock()
-			defer p.dumpLock.Unlock()
-			if p.file != nil {
-				p.fw.Close()
-				p.file.Close()
-			}
+		OnReconnect: func() {
+			// every server connection gets its own capture
+			p.Close()
+			p.AddressAndName("", p.hostname)
 		},
+		OnEnd: p.Close,
+	}
+}
+
+func (p *packetCapturer) Close() {
+	p.dumpLock.Lock()
+	defer p.dumpLock.Unlock()
+	if p.file != nil {
+		p.fw.Close()
+		p.file.Close()
+		p.file = nil
 	}
 }
 
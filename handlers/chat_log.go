@@ -36,6 +36,7 @@ func NewChatLogger() *proxy.Handler {
 	return &proxy.Handler{
 		Name:     "Packet Capturer",
 		PacketCB: c.PacketCB,
+		Packets:  []uint32{packet.IDText},
 		AddressAndName: func(address, hostname string) error {
 			filename := fmt.Sprintf("%s_%s_chat.log", hostname, time.Now().Format("2006-01-02_15-04-05_Z07"))
 			f, err := os.Create(filename)
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/bedrock-tool/bedrocktool/utils/proxy"
+	"github.com/bedrock-tool/bedrocktool/utils/scripting"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// NewScriptHandler creates a handler that runs the scripts at the paths passed for every proxy callback.
+// files the scripts write go to outputDir.
+func NewScriptHandler(paths []string, timeout time.Duration, outputDir string) *proxy.Handler {
+	vm := scripting.New()
+	if timeout != 0 {
+		vm.Timeout = timeout
+	}
+	vm.OutputDir = outputDir
+	ctx, cancel := context.WithCancel(context.Background())
+	var loadErr error
+
+	var h *proxy.Handler
+	h = &proxy.Handler{
+		Name: "Script",
+		ProxyRef: func(pc *proxy.Context) {
+			vm.SetEnv(scripting.ProxyEnv(pc))
+			// loaded before the proxy decides which packets to decode, scripts stay loaded when transferring
+			if loadErr = vm.Load(paths); loadErr != nil {
+				return
+			}
+			go vm.Watch(ctx)
+			if !vm.HasPacketCallbacks() {
+				h.Packets = []uint32{}
+			}
+		},
+		AddressAndName: func(address, hostname string) error {
+			if loadErr != nil {
+				return loadErr
+			}
+			vm.OnAddressAndName(address, hostname)
+			return nil
+		},
+		PacketCB: func(pk packet.Packet, toServer bool, _ time.Time, preLogin bool) (packet.Packet, error) {
+			if pk2 := vm.OnPacket(pk, toServer); pk2 == nil && !preLogin {
+				return nil, nil
+			}
+			return pk, nil
+		},
+		OnServerConnect: func() (bool, error) {
+			return vm.OnServerConnect(), nil
+		},
+		ConnectCB: func() bool {
+			return vm.OnConnect()
+		},
+		OnEnd: func() {
+			vm.OnEnd()
+			vm.Close()
+		},
+		Deferred: cancel,
+	}
+	return h
+}
@@ -169,6 +169,10 @@ func NewSkinSaver(skinCB func(SkinAdd)) *proxy.Handler {
 			s.fpath = outPathBase
 			return nil
 		},
+		Packets: []uint32{
+			packet.IDMovePlayer, packet.IDMoveActorAbsolute, packet.IDPlayerList,
+			packet.IDAddPlayer, packet.IDAnimate,
+		},
 		PacketCB: func(pk packet.Packet, toServer bool, timeReceived time.Time, preLogin bool) (packet.Packet, error) {
 			for _, s := range s.ProcessPacket(pk) {
 				if skinCB != nil {
@@ -205,7 +209,7 @@ func (s *SkinSaver) stealSkin() {
 	traceStart := mgl64.Vec3{float64(pos[0]), float64(pos[1]), float64(pos[2])}
 	traceEnd := traceStart.Add(dir.Mul(dist))
 
-	s.proxy.ClientWritePacket(&packet.SpawnParticleEffect{
+	s.proxy.InjectToClient(&packet.SpawnParticleEffect{
 		Dimension:      0,
 		EntityUniqueID: -1,
 		Position:       mgl32.Vec3{float32(traceEnd[0]), float32(traceEnd[1]), float32(traceEnd[2])},
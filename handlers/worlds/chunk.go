@@ -6,21 +6,31 @@ import (
 
 	"github.com/bedrock-tool/bedrocktool/handlers/worlds/worldstate"
 	"github.com/bedrock-tool/bedrocktool/locale"
+	"github.com/bedrock-tool/bedrocktool/utils/proxy"
 	"github.com/df-mc/dragonfly/server/block/cube"
 	"github.com/df-mc/dragonfly/server/world"
 	"github.com/df-mc/dragonfly/server/world/chunk"
-	"github.com/gregwebs/go-recovery"
 	"github.com/sandertv/gophertunnel/minecraft/nbt"
 	"github.com/sandertv/gophertunnel/minecraft/protocol"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
 	"github.com/sirupsen/logrus"
 )
 
-func (w *worldsHandler) processChangeDimension(pk *packet.ChangeDimension) {
-	dim, _ := world.DimensionByID(int(pk.Dimension))
+func (w *worldsHandler) processChangeDimension(e proxy.DimensionChanged) {
+	dim, _ := world.DimensionByID(int(e.Dimension))
 	w.SaveAndReset(false, dim)
 }
 
+func (w *worldsHandler) processChunk(e proxy.ChunkReceived) {
+	if e.Chunk != nil {
+		w.processLevelChunk(e.Chunk)
+		return
+	}
+	if err := w.processSubChunk(e.SubChunk); err != nil {
+		logrus.Error(err)
+	}
+}
+
 func (w *worldsHandler) processLevelChunk(pk *packet.LevelChunk) {
 	if len(pk.RawPayload) == 0 {
 		logrus.Info(locale.Loc("empty_chunk", nil))
@@ -36,20 +46,26 @@ func (w *worldsHandler) processLevelChunk(pk *packet.LevelChunk) {
 	}
 
 	w.worldStateLock.Lock()
-	defer w.worldStateLock.Unlock()
+	currentWorld := w.currentWorld
+	w.worldStateLock.Unlock()
 
 	//os.WriteFile("chunk.bin", pk.RawPayload, 0777)
 
-	ch, blockNBTs, err := chunk.NetworkDecode(world.AirRID(), pk.RawPayload, subChunkCount, w.serverState.useOldBiomes, w.serverState.useHashedRids, w.currentWorld.Range())
+	ch, blockNBTs, err := chunk.NetworkDecode(world.AirRID(), pk.RawPayload, subChunkCount, w.serverState.useOldBiomes, w.serverState.useHashedRids, currentWorld.Range())
 	if err != nil {
 		logrus.Error(err)
 		return
 	}
+
+	// scripts can use the world, their hooks run without holding the lock
 	var chunkBlockNBT = make(map[cube.Pos]worldstate.DummyBlock)
 	for _, blockNBT := range blockNBTs {
 		x := int(blockNBT["x"].(int32))
 		y := int(blockNBT["y"].(int32))
 		z := int(blockNBT["z"].(int32))
+		if w.scripting.OnBlockEntity(cube.Pos{x, y, z}, blockNBT) {
+			continue
+		}
 		chunkBlockNBT[cube.Pos{x, y, z}] = worldstate.DummyBlock{
 			ID:  blockNBT["id"].(string),
 			NBT: blockNBT,
@@ -57,43 +73,45 @@ func (w *worldsHandler) processLevelChunk(pk *packet.LevelChunk) {
 	}
 
 	pos := world.ChunkPos(pk.Position)
-	if w.scripting.CB.OnChunkAdd != nil {
-		var ignore bool
-		err := recovery.Call(func() error {
-			ignore = w.scripting.CB.OnChunkAdd(pos)
-			return nil
-		})
-		if err != nil {
-			logrus.Errorf("Scripting: %s", err)
-		}
-		if ignore {
-			return
-		}
+	if w.scripting.OnChunkAdd(pos) {
+		return
+	}
+
+	w.worldStateLock.Lock()
+	defer w.worldStateLock.Unlock()
+	if w.currentWorld != currentWorld {
+		// saved while the scripts ran, the chunk belongs to the old world
+		return
 	}
 	err = w.currentWorld.StoreChunk(pos, ch, chunkBlockNBT)
 	if err != nil {
 		logrus.Error(err)
 	}
 
-	max := w.currentWorld.Dimension().Range().Height() / 16
+	max := w.currentWorld.Range().Height() / 16
 	switch pk.SubChunkCount {
 	case protocol.SubChunkRequestModeLimited:
 		max = int(pk.HighestSubChunk)
 		fallthrough
 	case protocol.SubChunkRequestModeLimitless:
 		var offsetTable []protocol.SubChunkOffset
-		r := w.currentWorld.Dimension().Range()
+		r := w.currentWorld.Range()
 		for y := int8(r.Min() / 16); y < int8(r.Max()/16)+1; y++ {
 			offsetTable = append(offsetTable, protocol.SubChunkOffset{0, y, 0})
 		}
 
 		dimId, _ := world.DimensionID(w.currentWorld.Dimension())
-		_ = w.proxy.Server.WritePacket(&packet.SubChunkRequest{
-			Dimension: int32(dimId),
-			Position: protocol.SubChunkPos{
-				pk.Position.X(), 0, pk.Position.Z(),
+		w.proxy.Inject(proxy.Injection{
+			Packet: &packet.SubChunkRequest{
+				Dimension: int32(dimId),
+				Position: protocol.SubChunkPos{
+					pk.Position.X(), 0, pk.Position.Z(),
+				},
+				Offsets: offsetTable[:min(max+1, len(offsetTable))],
 			},
-			Offsets: offsetTable[:min(max+1, len(offsetTable))],
+			ToServer: true,
+			// the client never asks for them, the server gets the request after the chunk went through
+			After: pk,
 		})
 	default:
 		// legacy
@@ -120,9 +138,51 @@ func (w *worldsHandler) processSubChunk(pk *packet.SubChunk) error {
 	var chunks = make(map[world.ChunkPos]*chunk.Chunk)
 	var blockNBTs = make(map[world.ChunkPos]map[cube.Pos]worldstate.DummyBlock)
 
+	w.worldStateLock.Lock()
+	currentWorld := w.currentWorld
+	decodedNBTs, err := w.decodeSubChunks(pk, currentWorld, chunks, blockNBTs)
+	w.worldStateLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// scripts can use the world, their hooks run without holding the lock
+	for _, blockNBT := range decodedNBTs {
+		blockPos := cube.Pos{
+			int(blockNBT["x"].(int32)),
+			int(blockNBT["y"].(int32)),
+			int(blockNBT["z"].(int32)),
+		}
+		if w.scripting.OnBlockEntity(blockPos, blockNBT) {
+			continue
+		}
+		cp := world.ChunkPos{int32(blockPos[0] >> 4), int32(blockPos[2] >> 4)}
+		if _, ok := blockNBTs[cp]; !ok {
+			continue
+		}
+		blockNBTs[cp][blockPos] = worldstate.DummyBlock{
+			ID:  blockNBT["id"].(string),
+			NBT: blockNBT,
+		}
+	}
+
 	w.worldStateLock.Lock()
 	defer w.worldStateLock.Unlock()
+	if w.currentWorld != currentWorld {
+		// saved while the scripts ran, the chunks belong to the old world
+		return nil
+	}
+	for cp, c := range chunks {
+		w.currentWorld.StoreChunk(cp, c, blockNBTs[cp])
+		w.mapUI.SetChunk(cp, c, w.currentWorld.IsPaused())
+	}
 
+	w.mapUI.SchedRedraw()
+	return nil
+}
+
+// decodeSubChunks puts the sub chunks into the chunks they belong to, returns the block entities for the scripts
+func (w *worldsHandler) decodeSubChunks(pk *packet.SubChunk, currentWorld *worldstate.World, chunks map[world.ChunkPos]*chunk.Chunk, blockNBTs map[world.ChunkPos]map[cube.Pos]worldstate.DummyBlock) (decodedNBTs []map[string]any, err error) {
 	for _, ent := range pk.SubChunkEntries {
 		if ent.Result != protocol.SubChunkResultSuccess {
 			continue
@@ -136,12 +196,12 @@ func (w *worldsHandler) processSubChunk(pk *packet.SubChunk) error {
 		if _, ok := chunks[pos]; ok {
 			continue
 		}
-		ch, ok, err := w.currentWorld.LoadChunk(pos)
+		ch, ok, err := currentWorld.LoadChunk(pos)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if !ok {
-			return errors.New("bug check: subchunk received before chunk")
+			return nil, errors.New("bug check: subchunk received before chunk")
 		}
 		chunks[pos] = ch
 		blockNBTs[pos] = make(map[cube.Pos]worldstate.DummyBlock)
@@ -163,13 +223,13 @@ func (w *worldsHandler) processSubChunk(pk *packet.SubChunk) error {
 			sub, err := chunk.DecodeSubChunk(
 				buf,
 				world.AirRID(),
-				w.currentWorld.Dimension().Range(),
+				currentWorld.Range(),
 				&index,
 				chunk.NetworkEncoding,
 				w.serverState.useHashedRids,
 			)
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			ch := chunks[pos]
@@ -180,26 +240,13 @@ func (w *worldsHandler) processSubChunk(pk *packet.SubChunk) error {
 				for buf.Len() > 0 {
 					blockNBT := make(map[string]any, 0)
 					if err = dec.Decode(&blockNBT); err != nil {
-						return err
-					}
-					blockNBTs[pos][cube.Pos{
-						int(blockNBT["x"].(int32)),
-						int(blockNBT["y"].(int32)),
-						int(blockNBT["z"].(int32)),
-					}] = worldstate.DummyBlock{
-						ID:  blockNBT["id"].(string),
-						NBT: blockNBT,
+						return nil, err
 					}
+					decodedNBTs = append(decodedNBTs, blockNBT)
 				}
 			}
 		}
 	}
 
-	for cp, c := range chunks {
-		w.currentWorld.StoreChunk(cp, c, blockNBTs[cp])
-		w.mapUI.SetChunk(cp, c, w.currentWorld.IsPaused())
-	}
-
-	w.mapUI.SchedRedraw()
-	return nil
+	return decodedNBTs, nil
 }
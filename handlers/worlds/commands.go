@@ -0,0 +1,126 @@
+package worlds
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/bedrock-tool/bedrocktool/locale"
+	"github.com/bedrock-tool/bedrocktool/utils/proxy"
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/chunk"
+)
+
+func (w *worldsHandler) registerCommands() {
+	w.proxy.RegisterCommand(proxy.Command{
+		Name:        "setname",
+		Description: locale.Loc("setname_desc", nil),
+		Overloads: []proxy.CommandOverload{{
+			Params: []proxy.CommandParam{{Name: "name", Type: proxy.ParamText}},
+			Run: func(args proxy.CommandArgs) error {
+				if !w.setWorldName(args.String("name"), false) {
+					return errors.New("couldn't rename the world")
+				}
+				return nil
+			},
+		}},
+	})
+
+	w.proxy.RegisterCommand(proxy.Command{
+		Name:        "void",
+		Description: locale.Loc("void_desc", nil),
+		Overloads: []proxy.CommandOverload{{
+			Params: []proxy.CommandParam{{Name: "enabled", Type: proxy.ParamBool, Optional: true}},
+			Run: func(args proxy.CommandArgs) error {
+				enabled := !w.currentWorld.VoidGen
+				if args.Has("enabled") {
+					enabled = args.Bool("enabled")
+				}
+				w.setVoidGen(enabled, false)
+				return nil
+			},
+		}},
+	})
+
+	w.proxy.RegisterCommand(proxy.Command{
+		Name:        "exclude-mob",
+		Description: "add a mob to the list of mobs to ignore",
+		Overloads: []proxy.CommandOverload{{
+			Params: []proxy.CommandParam{{Name: "mobs", Type: proxy.ParamText}},
+			Run: func(args proxy.CommandArgs) error {
+				w.excludeMobs(strings.Fields(args.String("mobs"))...)
+				return nil
+			},
+		}},
+	})
+
+	w.proxy.RegisterCommand(proxy.Command{
+		Name:        "stop-capture",
+		Description: "stop capturing entities, chunks",
+		Overloads: []proxy.CommandOverload{{
+			Run: func(args proxy.CommandArgs) error {
+				return w.pauseCapture()
+			},
+		}},
+	})
+
+	w.proxy.RegisterCommand(proxy.Command{
+		Name:        "start-capture",
+		Description: "start capturing entities, chunks",
+		Overloads: []proxy.CommandOverload{{
+			Run: func(args proxy.CommandArgs) error {
+				return w.resumeCapture()
+			},
+		}},
+	})
+
+	w.proxy.RegisterCommand(proxy.Command{
+		Name:        "panel",
+		Description: "open the world capture control panel",
+		Overloads: []proxy.CommandOverload{{
+			Run: func(args proxy.CommandArgs) error {
+				w.showPanel()
+				return nil
+			},
+		}},
+	})
+
+	w.proxy.RegisterCommand(proxy.Command{
+		Name:        "save-world",
+		Description: "immediately save and reset the world state",
+		Overloads: []proxy.CommandOverload{{
+			Run: func(args proxy.CommandArgs) error {
+				w.SaveAndReset(false, nil)
+				return nil
+			},
+		}},
+	})
+}
+
+func (w *worldsHandler) excludeMobs(mobs ...string) {
+	w.settings.ExcludedMobs = append(w.settings.ExcludedMobs, mobs...)
+	w.proxy.SendMessage(fmt.Sprintf("Exluding: %s", strings.Join(w.settings.ExcludedMobs, ", ")))
+}
+
+func (w *worldsHandler) pauseCapture() error {
+	if w.currentWorld.IsPaused() {
+		return errors.New("capturing is already paused")
+	}
+	w.currentWorld.PauseCapture()
+	w.proxy.SendMessage("Paused Capturing")
+	return nil
+}
+
+func (w *worldsHandler) resumeCapture() error {
+	if !w.currentWorld.IsPaused() {
+		return errors.New("capturing is not paused")
+	}
+	w.proxy.SendMessage("Restarted Capturing")
+	pos := cube.Pos{int(math.Floor(float64(w.proxy.Player.Position[0]))), int(math.Floor(float64(w.proxy.Player.Position[1]))), int(math.Floor(float64(w.proxy.Player.Position[2])))}
+	w.currentWorld.UnpauseCapture(pos, w.serverState.radius, func(cp world.ChunkPos, c *chunk.Chunk) {
+		w.mapUI.SetChunk(cp, c, false)
+	})
+	return nil
+}
@@ -0,0 +1,126 @@
+package worlds
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/df-mc/dragonfly/server/block"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sirupsen/logrus"
+)
+
+// dragonfly keeps blocks, items and biomes in globals that every session in the process shares.
+// only one session at a time can add the items and custom blocks of its server,
+// the registry is reset once no session uses it anymore.
+var dragonflyGlobals struct {
+	sync.Mutex
+	sessions int
+	// the session that added items and blocks of its server
+	owner *worldsHandler
+	// the owner added custom blocks, that renumbers every block state
+	blocksChanged bool
+	// something was added that has to be reset
+	dirty bool
+}
+
+var (
+	errGlobalsInUse   = errors.New("another world session is running, servers with custom items or blocks can only be captured while no other session is")
+	errGlobalsChanged = errors.New("another world session added custom blocks, this server sends block ids that would be read wrong with them")
+)
+
+// resets dragonfly globals
+func resetGlobals() {
+	world.ClearStates()
+	world.LoadBlockStates()
+	block.InitBlocks()
+	world.FinaliseBlockRegistry()
+	world.ResetBiomes()
+}
+
+// useGlobals marks the registry as used by this session until releaseGlobals
+func (w *worldsHandler) useGlobals() {
+	dragonflyGlobals.Lock()
+	defer dragonflyGlobals.Unlock()
+	if w.usingGlobals {
+		return
+	}
+	w.usingGlobals = true
+	dragonflyGlobals.sessions++
+}
+
+func (w *worldsHandler) releaseGlobals() {
+	dragonflyGlobals.Lock()
+	defer dragonflyGlobals.Unlock()
+	if !w.usingGlobals {
+		return
+	}
+	w.usingGlobals = false
+	dragonflyGlobals.sessions--
+	if dragonflyGlobals.owner == w {
+		dragonflyGlobals.owner = nil
+		dragonflyGlobals.blocksChanged = false
+	}
+	if dragonflyGlobals.dirty && dragonflyGlobals.sessions == 0 {
+		resetGlobals()
+		dragonflyGlobals.dirty = false
+	}
+}
+
+// claimGlobals adds the custom items and blocks of the server to the registry.
+// changing it while another session runs would break how that session reads chunks and items,
+// and without hashed runtime ids this session reads blocks wrong once another one added custom blocks.
+// either way this session can't be captured right and fails.
+func (w *worldsHandler) claimGlobals(items []protocol.ItemEntry, blocks []protocol.BlockEntry, hashedRids bool) error {
+	dragonflyGlobals.Lock()
+	defer dragonflyGlobals.Unlock()
+
+	var customItems []protocol.ItemEntry
+	for _, ie := range items {
+		if _, ok := world.ItemRidByName(ie.Name); !ok {
+			customItems = append(customItems, ie)
+		}
+	}
+
+	owner := dragonflyGlobals.owner
+	if len(customItems) == 0 && len(blocks) == 0 {
+		if owner != nil && owner != w && dragonflyGlobals.blocksChanged && !hashedRids {
+			return errGlobalsChanged
+		}
+		return nil
+	}
+	if owner != w && (owner != nil || dragonflyGlobals.sessions > 1) {
+		return errGlobalsInUse
+	}
+
+	dragonflyGlobals.owner = w
+	dragonflyGlobals.dirty = true
+	world.InsertCustomItems(customItems)
+	if len(blocks) > 0 {
+		// telling the chunk code what custom blocks there are so it can generate offsets
+		world.InsertCustomBlocks(blocks)
+		dragonflyGlobals.blocksChanged = true
+	}
+	return nil
+}
+
+// registerBiomes adds biomes dragonfly doesn't know
+func (w *worldsHandler) registerBiomes(biomes map[string]any) {
+	dragonflyGlobals.Lock()
+	defer dragonflyGlobals.Unlock()
+	for k, v := range biomes {
+		if _, ok := world.BiomeByName(k); ok {
+			continue
+		}
+		data, ok := v.(map[string]any)
+		if !ok {
+			logrus.Warnf("biome %s has no definition", k)
+			continue
+		}
+		world.RegisterBiome(&customBiome{
+			name: k,
+			data: data,
+		})
+		dragonflyGlobals.dirty = true
+	}
+}
@@ -18,7 +18,6 @@ import (
 	"github.com/df-mc/dragonfly/server/world/chunk"
 	"github.com/sandertv/gophertunnel/minecraft/protocol"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
-	"github.com/sirupsen/logrus"
 )
 
 const ViewMapID = 0x424242
@@ -60,6 +59,25 @@ func (m *MapUI) GetBounds() (Min, Max protocol.ChunkPos) {
 	return
 }
 
+// renderMode is how chunks are drawn on the map
+type renderMode int
+
+const (
+	// colors of the top blocks
+	renderSurface renderMode = iota
+	// height of the top blocks, higher is brighter
+	renderHeight
+)
+
+var renderModeNames = []string{"Surface", "Height map"}
+
+func (r renderMode) render(ch *chunk.Chunk) *image.RGBA {
+	if r == renderHeight {
+		return utils.Chunk2HeightImg(ch)
+	}
+	return utils.Chunk2Img(ch)
+}
+
 type renderElem struct {
 	ch  *chunk.Chunk
 	pos protocol.ChunkPos
@@ -72,14 +90,20 @@ type MapUI struct {
 	renderQueue    *lockfree.Queue
 	renderedChunks map[protocol.ChunkPos]*image.RGBA // prerendered chunks
 	oldRendered    map[protocol.ChunkPos]*image.RGBA
-	ticker         *time.Ticker
 	w              *worldsHandler
+	// what the rendered chunks were drawn from, kept to draw them again when the render mode changes
+	chunks    map[protocol.ChunkPos]*renderElem
+	oldChunks map[protocol.ChunkPos]*renderElem
+	// ends the goroutines of Start
+	cancel context.CancelFunc
 
 	l  sync.Mutex
 	wg sync.WaitGroup
 
-	zoomLevel  int  // pixels per chunk
+	zoomLevel  int // pixels per chunk
+	renderMode renderMode
 	needRedraw bool // when the map has updated this is true
+	redrawAll  bool // every chunk was drawn again, the gui needs all of them
 	showOnGui  bool
 }
 
@@ -90,6 +114,8 @@ func NewMapUI(w *worldsHandler) *MapUI {
 		renderQueue:    lockfree.NewQueue(),
 		renderedChunks: make(map[protocol.ChunkPos]*image.RGBA),
 		oldRendered:    make(map[protocol.ChunkPos]*image.RGBA),
+		chunks:         make(map[protocol.ChunkPos]*renderElem),
+		oldChunks:      make(map[protocol.ChunkPos]*renderElem),
 		needRedraw:     true,
 		w:              w,
 	}
@@ -97,7 +123,11 @@ func NewMapUI(w *worldsHandler) *MapUI {
 }
 
 func (m *MapUI) Start(ctx context.Context) {
-	reply := messages.Router.Handle(&messages.Message{
+	// a reconnect starts the map again, the old goroutines have to end first
+	m.Stop()
+	ctx, m.cancel = context.WithCancel(ctx)
+
+	reply := m.w.proxy.UI(&messages.Message{
 		Source: "mapui",
 		Target: "ui",
 		Data:   messages.Features{Request: true},
@@ -111,23 +141,18 @@ func (m *MapUI) Start(ctx context.Context) {
 		}
 	}
 
-	// init map
-	err := m.w.proxy.ClientWritePacket(&packet.ClientBoundMapItemData{
+	// init map, injected so it isn't written while the proxy loop writes
+	m.w.proxy.InjectToClient(&packet.ClientBoundMapItemData{
 		MapID:          ViewMapID,
 		Scale:          4,
 		MapsIncludedIn: []int64{ViewMapID},
 		UpdateFlags:    packet.MapUpdateFlagInitialisation,
 	})
-	if err != nil {
-		logrus.Error(err)
-		return
-	}
 
-	m.ticker = time.NewTicker(33 * time.Millisecond)
 	m.wg.Add(1)
 	go func() {
 		lookup, _ := utils.ResolveColors(m.w.customBlocks, m.w.serverState.packs, true)
-		messages.Router.Handle(&messages.Message{
+		m.w.proxy.UI(&messages.Message{
 			Source: "mapui",
 			Target: "ui",
 			Data:   messages.MapLookup{Lookup: lookup},
@@ -135,10 +160,14 @@ func (m *MapUI) Start(ctx context.Context) {
 		m.wg.Done()
 	}()
 	go func() {
+		t := time.NewTicker(33 * time.Millisecond)
+		defer t.Stop()
 		var oldPos mgl32.Vec3
-		for range m.ticker.C {
-			if ctx.Err() != nil {
+		for {
+			select {
+			case <-ctx.Done():
 				return
+			case <-t.C:
 			}
 			newPos := m.w.proxy.Player.Position
 			if int(oldPos.X()) != int(newPos.X()) || int(oldPos.Z()) != int(newPos.Z()) {
@@ -150,38 +179,39 @@ func (m *MapUI) Start(ctx context.Context) {
 				m.needRedraw = false
 				m.redraw()
 
-				if err := m.w.proxy.ClientWritePacket(&packet.ClientBoundMapItemData{
+				m.w.proxy.InjectToClient(&packet.ClientBoundMapItemData{
 					MapID:       ViewMapID,
 					Scale:       4,
 					Width:       128,
 					Height:      128,
 					Pixels:      utils.Img2rgba(m.img),
 					UpdateFlags: packet.MapUpdateFlagTexture,
-				}); err != nil {
-					logrus.Error(err)
-					return
-				}
+				})
 			}
 		}
 	}()
 	go func() { // send map item
 		t := time.NewTicker(1 * time.Second)
-		for range t.C {
-			if m.w.proxy.Client == nil {
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
 				return
+			case <-t.C:
 			}
-			err := m.w.proxy.ClientWritePacket(&mapItemPacket)
-			if err != nil {
-				logrus.Error(err)
+			if m.w.proxy.Client == nil {
 				return
 			}
+			m.w.proxy.InjectToClient(&mapItemPacket)
 		}
 	}()
 }
 
+// Stop ends the goroutines sending the map to the client
 func (m *MapUI) Stop() {
-	if m.ticker != nil {
-		m.ticker.Stop()
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
 	}
 }
 
@@ -190,7 +220,9 @@ func (m *MapUI) Reset() {
 	m.l.Lock()
 	m.renderedChunks = make(map[protocol.ChunkPos]*image.RGBA)
 	m.oldRendered = make(map[protocol.ChunkPos]*image.RGBA)
-	messages.Router.Handle(&messages.Message{
+	m.chunks = make(map[protocol.ChunkPos]*renderElem)
+	m.oldChunks = make(map[protocol.ChunkPos]*renderElem)
+	m.w.proxy.UI(&messages.Message{
 		Source: "mapui",
 		Target: "ui",
 		Data: messages.UpdateMap{
@@ -210,6 +242,38 @@ func (m *MapUI) ChangeZoom() {
 	m.SchedRedraw()
 }
 
+// SetZoom sets how many pixels a chunk is on the map
+func (m *MapUI) SetZoom(level int) {
+	m.zoomLevel = level
+	m.SchedRedraw()
+}
+
+// SetRenderMode draws every chunk again in the render mode passed
+func (m *MapUI) SetRenderMode(mode renderMode) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if mode == m.renderMode {
+		return
+	}
+	m.renderMode = mode
+	for pos, r := range m.chunks {
+		m.renderedChunks[pos] = m.renderChunk(r)
+	}
+	for pos, r := range m.oldChunks {
+		m.oldRendered[pos] = m.renderChunk(r)
+	}
+	m.redrawAll = true
+	m.SchedRedraw()
+}
+
+func (m *MapUI) renderChunk(r *renderElem) *image.RGBA {
+	img := m.renderMode.render(r.ch)
+	if r.isDeferredState {
+		draw.Draw(img, img.Rect, red, image.Point{}, draw.Over)
+	}
+	return img
+}
+
 // SchedRedraw tells the map to redraw the next time its sent
 func (m *MapUI) SchedRedraw() {
 	m.needRedraw = true
@@ -226,21 +290,23 @@ func (m *MapUI) processQueue() []protocol.ChunkPos {
 			break
 		}
 		if r.ch != nil {
-			img := utils.Chunk2Img(r.ch)
 			if r.isDeferredState {
 				if old, ok := m.renderedChunks[r.pos]; ok {
 					m.oldRendered[r.pos] = old
+					m.oldChunks[r.pos] = m.chunks[r.pos]
 				}
-				draw.Draw(img, img.Rect, red, image.Point{}, draw.Over)
 			}
 
-			m.renderedChunks[r.pos] = img
+			m.renderedChunks[r.pos] = m.renderChunk(r)
+			m.chunks[r.pos] = r
 			updatedChunks = append(updatedChunks, r.pos)
 		} else {
 			if img, ok := m.oldRendered[r.pos]; ok {
 				m.renderedChunks[r.pos] = img
+				m.chunks[r.pos] = m.oldChunks[r.pos]
 			} else {
 				delete(m.renderedChunks, r.pos)
+				delete(m.chunks, r.pos)
 			}
 		}
 	}
@@ -252,6 +318,13 @@ func (m *MapUI) redraw() {
 	m.l.Lock()
 	defer m.l.Unlock()
 	updatedChunks := m.processQueue()
+	if m.redrawAll {
+		m.redrawAll = false
+		updatedChunks = updatedChunks[:0]
+		for pos := range m.renderedChunks {
+			updatedChunks = append(updatedChunks, pos)
+		}
+	}
 
 	// draw ingame map
 	middle := protocol.ChunkPos{
@@ -280,7 +353,7 @@ func (m *MapUI) redraw() {
 
 	// send tiles to gui map
 	if m.showOnGui {
-		messages.Router.Handle(&messages.Message{
+		m.w.proxy.UI(&messages.Message{
 			Source: "mapui",
 			Target: "ui",
 			Data: messages.UpdateMap{
@@ -0,0 +1,85 @@
+package worlds
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flytam/filenamify"
+)
+
+type OutputFormat string
+
+const (
+	OutputZip    OutputFormat = "zip"
+	OutputFolder OutputFormat = "folder"
+	OutputBoth   OutputFormat = "both"
+)
+
+// ParseOutputFormat parses the format given on the command line.
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	switch f := OutputFormat(strings.ToLower(s)); f {
+	case OutputZip, OutputFolder, OutputBoth:
+		return f, nil
+	case "":
+		return OutputZip, nil
+	}
+	return "", fmt.Errorf("unknown output format %q, must be zip, folder or both", s)
+}
+
+// OutputSettings controls where saved worlds are written to and in which form.
+type OutputSettings struct {
+	// directory all worlds are written to
+	BaseDir string
+	// path of the world folder relative to BaseDir,
+	// may contain {server} {world} {dimension} {date} {counter}
+	NameTemplate string
+	// write a .mcworld, the world folder or both
+	Format OutputFormat
+	// keep the world folder after it has been zipped, only used with OutputZip
+	KeepFolder bool
+}
+
+const (
+	defaultOutputDir      = "worlds"
+	defaultOutputTemplate = "{server}/{world}"
+)
+
+func (o *OutputSettings) setDefaults() {
+	if o.BaseDir == "" {
+		o.BaseDir = defaultOutputDir
+	}
+	if o.NameTemplate == "" {
+		o.NameTemplate = defaultOutputTemplate
+	}
+	if o.Format == "" {
+		o.Format = OutputZip
+	}
+}
+
+func (o *OutputSettings) zip() bool {
+	return o.Format == OutputZip || o.Format == OutputBoth
+}
+
+func (o *OutputSettings) keepFolder() bool {
+	return o.Format != OutputZip || o.KeepFolder
+}
+
+// worldFolder expands the naming template for a world
+func (o *OutputSettings) worldFolder(server, world, dimension string, counter int, date time.Time) string {
+	clean := func(s string) string {
+		s, _ = filenamify.FilenamifyV2(s)
+		return s
+	}
+	r := strings.NewReplacer(
+		"{server}", clean(server),
+		"{world}", clean(world),
+		"{dimension}", clean(strings.TrimPrefix(dimension, "minecraft:")),
+		"{date}", date.Format("2006-01-02_15-04-05"),
+		"{counter}", strconv.Itoa(counter),
+	)
+	name := filepath.Clean(r.Replace(o.NameTemplate))
+	return filepath.Join(o.BaseDir, name)
+}
@@ -14,10 +14,8 @@ import (
 	"github.com/bedrock-tool/bedrocktool/utils/nbtconv"
 	"github.com/bedrock-tool/bedrocktool/utils/resourcepack"
 	"github.com/df-mc/dragonfly/server/block/cube"
-	"github.com/df-mc/dragonfly/server/item/inventory"
 	"github.com/df-mc/dragonfly/server/world"
 	"github.com/go-gl/mathgl/mgl32"
-	"github.com/gregwebs/go-recovery"
 	"github.com/sandertv/gophertunnel/minecraft/nbt"
 	"github.com/sandertv/gophertunnel/minecraft/protocol"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
@@ -28,7 +26,25 @@ func (w *worldsHandler) getEntity(id worldstate.EntityRuntimeID) *worldstate.Ent
 	return w.currentWorld.GetEntity(id)
 }
 
+// worldsPackets are the packets packetCB uses, chunks come from the proxy events
+var worldsPackets = []uint32{
+	packet.IDStartGame, packet.IDSetTime, packet.IDRequestChunkRadius, packet.IDChunkRadiusUpdated,
+	packet.IDDimensionData, packet.IDItemComponent, packet.IDBiomeDefinitionList,
+	packet.IDBlockActorData, packet.IDClientBoundMapItemData, packet.IDMapInfoRequest,
+	packet.IDContainerOpen, packet.IDContainerClose, packet.IDInventoryContent, packet.IDInventorySlot,
+	packet.IDItemStackRequest, packet.IDMobEquipment, packet.IDMobArmourEquipment,
+	packet.IDAddPlayer, packet.IDPlayerList, packet.IDPlayerSkin, packet.IDAnimate,
+	packet.IDAddActor, packet.IDSetActorData, packet.IDSetActorMotion, packet.IDSetActorLink,
+	packet.IDMoveActorAbsolute, packet.IDMoveActorDelta, packet.IDUpdateAttributes,
+	packet.IDInventoryTransaction,
+}
+
 func (w *worldsHandler) packetCB(_pk packet.Packet, toServer bool, timeReceived time.Time, preLogin bool) (packet.Packet, error) {
+	// scripts see packets first so their changes are what gets saved
+	if pk := w.scripting.OnPacket(_pk, toServer); pk == nil && !preLogin {
+		return nil, nil
+	}
+
 	// general / startup
 	switch pk := _pk.(type) {
 	case *packet.RequestChunkRadius:
@@ -47,7 +63,12 @@ func (w *worldsHandler) packetCB(_pk packet.Packet, toServer bool, timeReceived
 			w.currentWorld.SetTime(timeReceived, int(pk.Time))
 			w.serverState.useHashedRids = pk.UseBlockNetworkIDHashes
 
-			world.InsertCustomItems(pk.Items)
+			if err := w.claimGlobals(pk.Items, pk.Blocks, pk.UseBlockNetworkIDHashes); err != nil {
+				// ends the session in OnServerConnect, nothing of it is saved
+				w.globalsErr = err
+				break
+			}
+			w.serverState.itemNames = nbtconv.NewItemNames(pk.Items)
 			for _, ie := range pk.Items {
 				w.bp.AddItem(ie)
 			}
@@ -56,8 +77,6 @@ func (w *worldsHandler) packetCB(_pk packet.Packet, toServer bool, timeReceived
 				for _, be := range pk.Blocks {
 					w.bp.AddBlock(be)
 				}
-				// telling the chunk code what custom blocks there are so it can generate offsets
-				world.InsertCustomBlocks(pk.Blocks)
 				w.customBlocks = pk.Blocks
 			}
 
@@ -82,7 +101,7 @@ func (w *worldsHandler) packetCB(_pk packet.Packet, toServer bool, timeReceived
 					logrus.Info(locale.Loc("using_under_118", nil))
 					w.serverState.dimensions[0] = protocol.DimensionDefinition{
 						Name:      "minecraft:overworld",
-						Range:     [2]int32{0, 256},
+						Range:     [2]int32{256, 0},
 						Generator: 1,
 					}
 				}
@@ -91,13 +110,18 @@ func (w *worldsHandler) packetCB(_pk packet.Packet, toServer bool, timeReceived
 			w.currentWorld.SetDimension(dim)
 
 			w.openWorldState(w.settings.StartPaused)
+		} else if dim, _ := world.DimensionByID(int(pk.Dimension)); dim != w.currentWorld.Dimension() {
+			// reconnected into another dimension
+			w.SaveAndReset(false, dim)
 		}
 
 	case *packet.DimensionData:
 		for _, dd := range pk.Definitions {
-			if dd.Name == "minecraft:overworld" {
-				w.serverState.dimensions[0] = dd
-			}
+			worldstate.AddDimensionDefinition(w.serverState.dimensions, dd)
+		}
+		if w.currentWorld != nil && w.currentWorld.Dimension() != nil {
+			// the definitions may arrive after the dimension was set
+			w.currentWorld.SetDimension(w.currentWorld.Dimension())
 		}
 
 	case *packet.ItemComponent:
@@ -108,20 +132,13 @@ func (w *worldsHandler) packetCB(_pk packet.Packet, toServer bool, timeReceived
 		if err != nil {
 			logrus.Error(err)
 		}
-		for k, v := range w.serverState.biomes {
-			_, ok := world.BiomeByName(k)
-			if !ok {
-				world.RegisterBiome(&customBiome{
-					name: k,
-					data: v.(map[string]any),
-				})
-			}
-		}
+		w.registerBiomes(w.serverState.biomes)
 		w.bp.AddBiomes(w.serverState.biomes)
 	}
 
 	_pk = w.itemPackets(_pk)
 	_pk = w.mapPackets(_pk, toServer)
+	w.panelPackets(_pk, toServer)
 	w.playersPackets(_pk)
 	w.chunkPackets(_pk)
 
@@ -202,33 +219,21 @@ func (w *worldsHandler) playersPackets(_pk packet.Packet) {
 func (w *worldsHandler) entityPackets(_pk packet.Packet) {
 	switch pk := _pk.(type) {
 	case *packet.AddActor:
+		if !strings.HasPrefix(pk.EntityType, "minecraft:") {
+			// read when saving, on another goroutine
+			w.worldStateLock.Lock()
+			w.serverState.customEntities[pk.EntityType] = struct{}{}
+			w.worldStateLock.Unlock()
+		}
 		w.currentWorld.ProcessAddActor(pk, func(es *worldstate.EntityState) bool {
-			var ignore bool
-			if w.scripting.CB.OnEntityAdd != nil {
-				err := recovery.Call(func() error {
-					ignore = w.scripting.OnEntityAdd(es, es.Metadata)
-					return nil
-				})
-				if err != nil {
-					logrus.Errorf("scripting: %s", err)
-				}
-			}
-			return ignore
+			return w.scripting.OnEntityAdd(es, es.Metadata)
 		}, w.bp.AddEntity)
 
 	case *packet.SetActorData:
 		if e := w.getEntity(pk.EntityRuntimeID); e != nil {
 			metadata := make(protocol.EntityMetadata)
 			maps.Copy(metadata, pk.EntityMetadata)
-			if w.scripting.CB.OnEntityDataUpdate != nil {
-				err := recovery.Call(func() error {
-					w.scripting.OnEntityDataUpdate(e, metadata)
-					return nil
-				})
-				if err != nil {
-					logrus.Errorf("Scripting %s", err)
-				}
-			}
+			w.scripting.OnEntityDataUpdate(e, metadata)
 
 			maps.Copy(e.Metadata, metadata)
 			w.bp.AddEntity(behaviourpack.EntityIn{
@@ -238,6 +243,18 @@ func (w *worldsHandler) entityPackets(_pk packet.Packet) {
 			})
 		}
 
+	case *packet.UpdateAttributes:
+		if e := w.getEntity(pk.EntityRuntimeID); e != nil {
+			attr := make([]protocol.AttributeValue, 0, len(pk.Attributes))
+			for _, a := range pk.Attributes {
+				attr = append(attr, a.AttributeValue)
+			}
+			w.bp.AddEntity(behaviourpack.EntityIn{
+				Identifier: e.EntityType,
+				Attr:       attr,
+			})
+		}
+
 	case *packet.SetActorMotion:
 		if e := w.getEntity(pk.EntityRuntimeID); e != nil {
 			e.Velocity = pk.Velocity
@@ -300,22 +317,14 @@ func (w *worldsHandler) entityPackets(_pk packet.Packet) {
 
 func (w *worldsHandler) chunkPackets(_pk packet.Packet) {
 	// chunk
+	// chunks and dimension changes come from the proxy events
 	switch pk := _pk.(type) {
-	case *packet.ChangeDimension:
-		w.processChangeDimension(pk)
-
-	case *packet.LevelChunk:
-		w.processLevelChunk(pk)
-
-	case *packet.SubChunk:
-		if err := w.processSubChunk(pk); err != nil {
-			logrus.Error(err)
-		}
-
 	case *packet.BlockActorData:
 		p := pk.Position
 		pos := cube.Pos{int(p.X()), int(p.Y()), int(p.Z())}
-		w.currentWorld.SetBlockNBT(pos, pk.NBTData, false)
+		if !w.scripting.OnBlockEntity(pos, pk.NBTData) {
+			w.currentWorld.SetBlockNBT(pos, pk.NBTData, false)
+		}
 		/*
 			case *packet.UpdateBlock:
 				if w.settings.BlockUpdates {
@@ -472,18 +481,11 @@ func (w *worldsHandler) itemPackets(_pk packet.Packet) packet.Packet {
 				break
 			}
 
-			// create inventory
-			inv := inventory.New(len(existing.Content.Content), nil)
-			for i, c := range existing.Content.Content {
-				item := utils.StackToItem(c.Stack)
-				inv.SetItem(i, item)
-			}
-
 			// put into subchunk
 			p := existing.OpenPacket.ContainerPosition
 			pos := cube.Pos{int(p.X()), int(p.Y()), int(p.Z())}
 			w.currentWorld.SetBlockNBT(pos, map[string]any{
-				"Items": nbtconv.InvToNBT(inv),
+				"Items": w.serverState.itemNames.InstancesToNBT(existing.Content.Content),
 			}, true)
 
 			w.proxy.SendMessage(locale.Loc("saved_block_inv", nil))
@@ -9,11 +9,14 @@ import (
 
 	"github.com/bedrock-tool/bedrocktool/locale"
 	"github.com/bedrock-tool/bedrocktool/utils"
+	"github.com/bedrock-tool/bedrocktool/utils/resourcepack"
 	"github.com/flytam/filenamify"
 	"github.com/sirupsen/logrus"
 )
 
-func (w *worldsHandler) AddPacks(folder string) {
+// AddPacks adds the behaviour pack and resource packs to a saved world,
+// customEntities are the custom entities that were seen while it was captured
+func (w *worldsHandler) AddPacks(folder string, customEntities map[string]struct{}) {
 	type dep struct {
 		PackID  string `json:"pack_id"`
 		Version [3]int `json:"version"`
@@ -39,9 +42,17 @@ func (w *worldsHandler) AddPacks(folder string) {
 		packFolder := path.Join(folder, "behavior_packs", name)
 		_ = os.MkdirAll(packFolder, 0o755)
 
-		for _, p := range w.proxy.Server.ResourcePacks() {
-			p := utils.PackFromBase(p)
-			w.bp.CheckAddLink(p)
+		// force resource packs for worlds with custom blocks
+		if w.bp.HasBlocks() {
+			w.settings.WithPacks = true
+		}
+
+		// the server packs are only a dependency when they are bundled
+		if w.settings.WithPacks {
+			for _, p := range w.proxy.Server.ResourcePacks() {
+				p := utils.PackFromBase(p)
+				w.bp.CheckAddLink(p)
+			}
 		}
 
 		w.bp.Save(packFolder)
@@ -49,9 +60,20 @@ func (w *worldsHandler) AddPacks(folder string) {
 			PackID:  w.bp.Manifest.Header.UUID,
 			Version: w.bp.Manifest.Header.Version,
 		}})
+	}
 
-		// force resource packs for worlds with custom blocks
-		w.settings.WithPacks = true
+	var rdeps []dep
+	addGenerated := func(name string, rp *resourcepack.Pack) {
+		if rp == nil {
+			return
+		}
+		rpFolder := path.Join(folder, "resource_packs", name)
+		os.MkdirAll(rpFolder, 0755)
+		rp.WriteToDir(rpFolder)
+		rdeps = append(rdeps, dep{
+			PackID:  rp.Manifest.Header.UUID,
+			Version: rp.Manifest.Header.Version,
+		})
 	}
 
 	// add resource packs
@@ -61,7 +83,6 @@ func (w *worldsHandler) AddPacks(folder string) {
 			packNames[pack.Base().Name()] += 1
 		}
 
-		var rdeps []dep
 		for _, pack := range w.serverState.packs {
 			if pack.Base().Encrypted() && !pack.CanDecrypt() {
 				logrus.Warnf("Cant add %s, it is encrypted", pack.Base().Name())
@@ -88,19 +109,53 @@ func (w *worldsHandler) AddPacks(folder string) {
 		}
 
 		if len(w.rp.Files) > 0 && w.settings.Players {
-			btPlayersFolder := path.Join(folder, "resource_packs", "bt_players")
-			os.MkdirAll(btPlayersFolder, 0755)
-			w.rp.WriteToDir(btPlayersFolder)
-			rdeps = append(rdeps, dep{
-				PackID:  w.rp.Manifest.Header.UUID,
-				Version: w.rp.Manifest.Header.Version,
-			})
+			addGenerated("bt_players", w.rp)
 		}
+	} else if len(customEntities) > 0 || w.bp.HasItems() {
+		// without the server packs only what the custom entities and items need is taken from them
+		idx := resourcepack.NewPackIndex(w.serverState.packs)
+		addGenerated("bt_entities", customEntityPack(customEntities, idx))
+		addGenerated("bt_items", w.customItemPack(idx))
+	}
 
-		if len(rdeps) > 0 {
-			addPacksJSON("world_resource_packs.json", rdeps)
+	if len(rdeps) > 0 {
+		addPacksJSON("world_resource_packs.json", rdeps)
+	}
+}
+
+// customEntityPack collects the client side definitions of the custom entities that were seen from the server packs
+func customEntityPack(customEntities map[string]struct{}, idx *resourcepack.PackIndex) *resourcepack.Pack {
+	rp := resourcepack.New()
+	rp.Manifest.Header.Name = "bedrocktool custom entities"
+	for identifier := range customEntities {
+		if !rp.AddEntityFromPacks(identifier, idx) {
+			logrus.Debugf("no client entity for %s in the server packs", identifier)
+		}
+	}
+	if len(rp.Files) == 0 {
+		return nil
+	}
+	return rp
+}
+
+// customItemPack collects the icons and attachables of the custom items from the server packs
+func (w *worldsHandler) customItemPack(idx *resourcepack.PackIndex) *resourcepack.Pack {
+	if !w.bp.HasItems() {
+		return nil
+	}
+	rp := resourcepack.New()
+	rp.Manifest.Header.Name = "bedrocktool custom items"
+	for identifier, icon := range w.bp.ItemIcons() {
+		if !rp.AddItemFromPacks(identifier, icon, idx) && icon != "" {
+			// the icon from the item component still gets an atlas entry, its texture can be added later
+			logrus.Debugf("no icon for %s in the server packs", identifier)
+			rp.AddItemIcon(icon)
 		}
 	}
+	if len(rp.Files) == 0 {
+		return nil
+	}
+	return rp
 }
 
 func extractPack(p utils.Pack, folder string) error {
@@ -0,0 +1,93 @@
+package worlds
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bedrock-tool/bedrocktool/utils/proxy"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// map zoom levels in pixels per chunk, the same ones swinging cycles through
+var zoomLevels = []int{16, 8, 4, 2, 1}
+
+// using an item renamed to this opens the panel
+const panelItemName = "bedrocktool"
+
+// panelPackets opens the panel when the player uses an item named panelItemName from the hotbar
+func (w *worldsHandler) panelPackets(_pk packet.Packet, toServer bool) {
+	pk, ok := _pk.(*packet.InventoryTransaction)
+	if !ok || !toServer {
+		return
+	}
+	data, ok := pk.TransactionData.(*protocol.UseItemTransactionData)
+	if !ok || data.ActionType != protocol.UseItemActionClickAir {
+		return
+	}
+	display, _ := data.HeldItem.Stack.NBTData["display"].(map[string]any)
+	if name, _ := display["Name"].(string); strings.EqualFold(name, panelItemName) {
+		w.showPanel()
+	}
+}
+
+// showPanel opens the in-game control panel
+func (w *worldsHandler) showPanel() {
+	pause := !w.currentWorld.IsPaused()
+	captureText := "Pause capturing"
+	if !pause {
+		captureText = "Resume capturing"
+	}
+
+	w.proxy.ShowForm(&proxy.MenuForm{
+		Title:   "Bedrocktool",
+		Content: fmt.Sprintf("World: %s\nChunks: %d\n\nUse an item named %q to open this again.", w.currentWorld.Name, len(w.currentWorld.StoredChunks), panelItemName),
+		Buttons: []proxy.MenuButton{
+			{Text: captureText, OnClick: func() {
+				// capturing may have been paused or resumed with a command while the form was open
+				paused := w.currentWorld.IsPaused()
+				if pause && !paused {
+					w.pauseCapture()
+				} else if !pause && paused {
+					w.resumeCapture()
+				}
+			}},
+			{Text: "Settings", OnClick: w.showSettings},
+			{Text: "Save now", OnClick: func() {
+				w.SaveAndReset(false, nil)
+			}},
+		},
+	})
+}
+
+func (w *worldsHandler) showSettings() {
+	zoomOptions := make([]string, len(zoomLevels))
+	for i, level := range zoomLevels {
+		zoomOptions[i] = strconv.Itoa(level) + " pixels per chunk"
+	}
+	zoom := max(slices.Index(zoomLevels, w.mapUI.zoomLevel), 0)
+
+	w.proxy.ShowForm(&proxy.SettingsForm{
+		Title: "Capture settings",
+		Elements: []proxy.FormElement{
+			proxy.FormInput{Text: "World name", Default: w.currentWorld.Name},
+			proxy.FormToggle{Text: "Void generator", Default: w.currentWorld.VoidGen},
+			proxy.FormInput{Text: "Excluded mobs", Placeholder: "minecraft:zombie minecraft:bat", Default: strings.Join(w.settings.ExcludedMobs, " ")},
+			proxy.FormDropdown{Text: "Map zoom", Options: zoomOptions, Default: zoom},
+			proxy.FormDropdown{Text: "Map render mode", Options: renderModeNames, Default: int(w.mapUI.renderMode)},
+		},
+		OnSubmit: func(values []any) {
+			if name := strings.TrimSpace(values[0].(string)); name != "" && name != w.currentWorld.Name {
+				w.setWorldName(name, false)
+			}
+			if voidGen := values[1].(bool); voidGen != w.currentWorld.VoidGen {
+				w.setVoidGen(voidGen, false)
+			}
+			w.settings.ExcludedMobs = strings.Fields(values[2].(string))
+			w.mapUI.SetZoom(zoomLevels[values[3].(int)])
+			w.mapUI.SetRenderMode(renderMode(values[4].(int)))
+		},
+	})
+}
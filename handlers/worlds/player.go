@@ -1,11 +1,5 @@
 package worlds
 
-import (
-	"github.com/bedrock-tool/bedrocktool/utils"
-	"github.com/bedrock-tool/bedrocktool/utils/nbtconv"
-	"github.com/df-mc/dragonfly/server/item/inventory"
-)
-
 func (w *worldsHandler) playerData() (ret map[string]any) {
 	ret = map[string]any{
 		"format_version": "1.12.0",
@@ -13,11 +7,7 @@ func (w *worldsHandler) playerData() (ret map[string]any) {
 	}
 
 	if len(w.serverState.playerInventory) > 0 && w.settings.SaveInventories {
-		inv := inventory.New(len(w.serverState.playerInventory), nil)
-		for i, ii := range w.serverState.playerInventory {
-			inv.SetItem(i, utils.StackToItem(ii.Stack))
-		}
-		ret["Inventory"] = nbtconv.InvToNBT(inv)
+		ret["Inventory"] = w.serverState.itemNames.InstancesToNBT(w.serverState.playerInventory)
 	}
 
 	ret["abilities"] = map[string]any{
@@ -0,0 +1,67 @@
+package worlds
+
+import (
+	"github.com/bedrock-tool/bedrocktool/handlers/worlds/worldstate"
+	"github.com/bedrock-tool/bedrocktool/utils/scripting"
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+)
+
+// scriptWorld gives scripts access to the world currently being captured.
+// SaveAndReset replaces the world under worldStateLock, so every access holds it.
+type scriptWorld struct {
+	w *worldsHandler
+}
+
+func (s scriptWorld) Block(pos cube.Pos) (string, map[string]any, bool) {
+	s.w.worldStateLock.Lock()
+	defer s.w.worldStateLock.Unlock()
+	if s.w.currentWorld == nil {
+		return "", nil, false
+	}
+	b, ok := s.w.currentWorld.Block(pos)
+	if !ok {
+		return "", nil, false
+	}
+	name, properties := b.EncodeBlock()
+	return name, properties, true
+}
+
+func (s scriptWorld) SetBlock(pos cube.Pos, name string, properties map[string]any) bool {
+	b, ok := world.BlockByName(name, properties)
+	if !ok {
+		return false
+	}
+	s.w.worldStateLock.Lock()
+	defer s.w.worldStateLock.Unlock()
+	if s.w.currentWorld == nil {
+		return false
+	}
+	return s.w.currentWorld.SetBlock(pos, b)
+}
+
+func (s scriptWorld) Entities() []any {
+	s.w.worldStateLock.Lock()
+	defer s.w.worldStateLock.Unlock()
+	if s.w.currentWorld == nil {
+		return nil
+	}
+	entities := s.w.currentWorld.Entities()
+	ret := make([]any, 0, len(entities))
+	for _, es := range entities {
+		ret = append(ret, es)
+	}
+	return ret
+}
+
+func (w *worldsHandler) setupScripting() {
+	env := scripting.ProxyEnv(w.proxy)
+	env.World = func() scripting.World {
+		return scriptWorld{w}
+	}
+	w.scripting.SetEnv(env)
+}
+
+func (w *worldsHandler) postProcess(pw *worldstate.ProcessWorld) error {
+	return w.scripting.OnPostProcess(pw)
+}
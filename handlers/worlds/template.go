@@ -0,0 +1,75 @@
+package worlds
+
+import (
+	"image"
+	"image/jpeg"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/bedrock-tool/bedrocktool/utils"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/resource"
+)
+
+type worldTemplateHeader struct {
+	Name                string `json:"name"`
+	Description         string `json:"description"`
+	UUID                string `json:"uuid"`
+	Version             [3]int `json:"version"`
+	LockTemplateOptions bool   `json:"lock_template_options"`
+	BaseGameVersion     [3]int `json:"base_game_version"`
+}
+
+type worldTemplateManifest struct {
+	FormatVersion int                 `json:"format_version"`
+	Header        worldTemplateHeader `json:"header"`
+	Modules       []resource.Module   `json:"modules"`
+}
+
+// writeTemplateFiles adds the manifest and icon that turn a world folder into a world template
+func (w *worldsHandler) writeTemplateFiles(folder, name string, icon image.Image) error {
+	id := w.serverState.Name + "/" + name
+	manifest := worldTemplateManifest{
+		FormatVersion: 2,
+		Header: worldTemplateHeader{
+			Name:                name,
+			Description:         "Captured from " + w.serverState.Name,
+			UUID:                utils.RandSeededUUID(id + "_template"),
+			Version:             [3]int{1, 0, 0},
+			LockTemplateOptions: w.settings.LockTemplateOptions,
+			BaseGameVersion:     baseGameVersion(),
+		},
+		Modules: []resource.Module{
+			{
+				Type:    "world_template",
+				UUID:    utils.RandSeededUUID(id + "_template_module"),
+				Version: [3]int{1, 0, 0},
+			},
+		},
+	}
+	if err := utils.WriteManifest(&manifest, folder); err != nil {
+		return err
+	}
+
+	if icon != nil && !icon.Bounds().Empty() {
+		f, err := os.Create(path.Join(folder, "world_icon.jpeg"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := jpeg.Encode(f, icon, &jpeg.Options{Quality: 90}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// baseGameVersion is the version the template is made for, taken from the protocol version in use
+func baseGameVersion() (ver [3]int) {
+	for i, part := range strings.SplitN(protocol.CurrentVersion, ".", 3) {
+		ver[i], _ = strconv.Atoi(part)
+	}
+	return ver
+}
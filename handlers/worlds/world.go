@@ -3,27 +3,29 @@ package worlds
 import (
 	"context"
 	"fmt"
+	"image"
 	"image/png"
-	"math"
+	"maps"
 	"math/rand"
 	"net"
 	"os"
+	"path/filepath"
 	"slices"
-	"strings"
 	"sync"
 	"time"
 
-	"github.com/bedrock-tool/bedrocktool/handlers/worlds/scripting"
 	"github.com/bedrock-tool/bedrocktool/handlers/worlds/worldstate"
 	"github.com/bedrock-tool/bedrocktool/locale"
 	"github.com/bedrock-tool/bedrocktool/ui/messages"
 	"github.com/bedrock-tool/bedrocktool/utils"
 	"github.com/bedrock-tool/bedrocktool/utils/behaviourpack"
+	"github.com/bedrock-tool/bedrocktool/utils/nbtconv"
 	"github.com/bedrock-tool/bedrocktool/utils/proxy"
 	"github.com/bedrock-tool/bedrocktool/utils/resourcepack"
+	"github.com/bedrock-tool/bedrocktool/utils/scripting"
+	"github.com/flytam/filenamify"
 	"github.com/google/uuid"
 
-	"github.com/df-mc/dragonfly/server/block"
 	"github.com/df-mc/dragonfly/server/block/cube"
 	"github.com/df-mc/dragonfly/server/world"
 	_ "github.com/df-mc/dragonfly/server/world/biome"
@@ -45,8 +47,20 @@ type WorldSettings struct {
 	StartPaused     bool
 	PreloadReplay   string
 	ChunkRadius     int32
-	Script          string
 	Players         bool
+
+	// paths of the scripts to run
+	Scripts []string
+	// how long a script callback may run, 0 uses the default
+	ScriptTimeout time.Duration
+	// where scripts write files to, empty uses the default
+	ScriptOutput string
+
+	// save as a .mctemplate world template instead of a .mcworld
+	Template            bool
+	LockTemplateOptions bool
+
+	Output OutputSettings
 }
 
 type serverState struct {
@@ -60,9 +74,11 @@ type serverState struct {
 
 	openItemContainers map[byte]*itemContainer
 	playerInventory    []protocol.ItemInstance
+	itemNames          nbtconv.ItemNames
 	packs              []utils.Pack
 	dimensions         map[int]protocol.DimensionDefinition
 	playerSkins        map[uuid.UUID]*protocol.Skin
+	customEntities     map[string]struct{}
 
 	Name string
 }
@@ -85,6 +101,10 @@ type worldsHandler struct {
 	serverState  serverState
 	settings     WorldSettings
 	customBlocks []protocol.BlockEntry
+	// this session counts as a user of dragonflys globals
+	usingGlobals bool
+	// why the items and blocks of this server couldn't be added to dragonflys globals
+	globalsErr error
 }
 
 type itemContainer struct {
@@ -92,15 +112,6 @@ type itemContainer struct {
 	Content    *packet.InventoryContent
 }
 
-// resets dragonfly globals
-func resetGlobals() {
-	world.ClearStates()
-	world.LoadBlockStates()
-	block.InitBlocks()
-	world.FinaliseBlockRegistry()
-	world.ResetBiomes()
-}
-
 func NewWorldsHandler(settings WorldSettings) *proxy.Handler {
 	settings.ExcludedMobs = slices.DeleteFunc(settings.ExcludedMobs, func(mob string) bool {
 		return mob == ""
@@ -109,6 +120,7 @@ func NewWorldsHandler(settings WorldSettings) *proxy.Handler {
 	if settings.ChunkRadius == 0 {
 		settings.ChunkRadius = 80
 	}
+	settings.Output.setDefaults()
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -120,82 +132,49 @@ func NewWorldsHandler(settings WorldSettings) *proxy.Handler {
 			openItemContainers: make(map[byte]*itemContainer),
 			dimensions:         make(map[int]protocol.DimensionDefinition),
 			playerSkins:        make(map[uuid.UUID]*protocol.Skin),
+			customEntities:     make(map[string]struct{}),
 		},
 		settings: settings,
 	}
 	w.mapUI = NewMapUI(w)
 	w.scripting = scripting.New()
+	if settings.ScriptTimeout != 0 {
+		w.scripting.Timeout = settings.ScriptTimeout
+	}
+	w.scripting.OutputDir = settings.ScriptOutput
 
 	h := &proxy.Handler{
 		Name: "Worlds",
 		ProxyRef: func(pc *proxy.Context) {
 			w.proxy = pc
+			w.setupScripting()
+			if pc.Options.Session != "" {
+				// sessions running at the same time dont write into the same folder
+				dir := settings.ScriptOutput
+				if dir == "" {
+					dir = scripting.DefaultOutputDir
+				}
+				session, _ := filenamify.FilenamifyV2(pc.Options.Session)
+				w.scripting.OutputDir = filepath.Join(dir, session)
+			}
 
-			/*
-				w.proxy.PlayerMoveCB = append(w.proxy.PlayerMoveCB, func() {
-					ui.HandleMessage(&messages.Message{
-						Source: "worlds",
-						Data: messages.PlayerPosition{
-							Position: w.proxy.Player.Position,
-						},
-					})
-				})
-			*/
-
-			w.proxy.AddCommand(func(cmdline []string) bool {
-				return w.setWorldName(strings.Join(cmdline, " "), false)
-			}, protocol.Command{
-				Name:        "setname",
-				Description: locale.Loc("setname_desc", nil),
-			})
-
-			w.proxy.AddCommand(func(cmdline []string) bool {
-				return w.setVoidGen(!w.currentWorld.VoidGen, false)
-			}, protocol.Command{
-				Name:        "void",
-				Description: locale.Loc("void_desc", nil),
-			})
-
-			w.proxy.AddCommand(func(s []string) bool {
-				w.settings.ExcludedMobs = append(w.settings.ExcludedMobs, s...)
-				w.proxy.SendMessage(fmt.Sprintf("Exluding: %s", strings.Join(w.settings.ExcludedMobs, ", ")))
-				return true
-			}, protocol.Command{
-				Name:        "exclude-mob",
-				Description: "add a mob to the list of mobs to ignore",
-			})
-
-			w.proxy.AddCommand(func(s []string) bool {
-				w.currentWorld.PauseCapture()
-				w.proxy.SendMessage("Paused Capturing")
-				return true
-			}, protocol.Command{
-				Name:        "stop-capture",
-				Description: "stop capturing entities, chunks",
-			})
-
-			w.proxy.AddCommand(func(s []string) bool {
-				w.proxy.SendMessage("Restarted Capturing")
-				pos := cube.Pos{int(math.Floor(float64(w.proxy.Player.Position[0]))), int(math.Floor(float64(w.proxy.Player.Position[1]))), int(math.Floor(float64(w.proxy.Player.Position[2])))}
-				w.currentWorld.UnpauseCapture(pos, w.serverState.radius, func(cp world.ChunkPos, c *chunk.Chunk) {
-					w.mapUI.SetChunk(cp, c, false)
+			proxy.Subscribe(pc, func(e proxy.PlayerMoved) {
+				pc.UI(&messages.Message{
+					Source: "worlds",
+					Target: "ui",
+					Data: messages.PlayerPosition{
+						Position: e.Position,
+					},
 				})
-				return true
-			}, protocol.Command{
-				Name:        "start-capture",
-				Description: "start capturing entities, chunks",
 			})
+			proxy.Subscribe(pc, w.processChangeDimension)
+			proxy.Subscribe(pc, w.processChunk)
 
-			w.proxy.AddCommand(func(s []string) bool {
-				w.SaveAndReset(false, nil)
-				return true
-			}, protocol.Command{
-				Name:        "save-world",
-				Description: "immediately save and reset the world state",
-			})
+			w.registerCommands()
 		},
 
 		AddressAndName: func(address, hostname string) (err error) {
+			w.useGlobals()
 			w.bp = behaviourpack.New(hostname)
 			w.rp = resourcepack.New()
 			w.serverState.Name = hostname
@@ -210,11 +189,13 @@ func NewWorldsHandler(settings WorldSettings) *proxy.Handler {
 				w.currentWorld.PauseCapture()
 			}
 
-			if settings.Script != "" {
-				err := w.scripting.Load(settings.Script)
+			// scripts stay loaded when transferring to another server
+			if len(settings.Scripts) > 0 && !w.scripting.Loaded() {
+				err := w.scripting.Load(settings.Scripts)
 				if err != nil {
 					return err
 				}
+				go w.scripting.Watch(ctx)
 			}
 
 			err = w.preloadReplay()
@@ -225,18 +206,23 @@ func NewWorldsHandler(settings WorldSettings) *proxy.Handler {
 			return nil
 		},
 
+		OnServerConnect: func() (bool, error) {
+			// start game was read while connecting
+			return false, w.globalsErr
+		},
+
 		ToClientGameDataModifier: func(gd *minecraft.GameData) {
 			gd.ClientSideGeneration = false
 		},
 
 		ConnectCB: func() bool {
-			messages.Router.Handle(&messages.Message{
+			w.proxy.UI(&messages.Message{
 				Source: "subcommand",
 				Target: "ui",
 				Data:   messages.UIStateMain,
 			})
 
-			messages.Router.Handle(&messages.Message{
+			w.proxy.UI(&messages.Message{
 				Source: "subcommand",
 				Target: "ui",
 				Data: messages.SetValue{
@@ -245,11 +231,11 @@ func NewWorldsHandler(settings WorldSettings) *proxy.Handler {
 				},
 			})
 
-			w.proxy.ClientWritePacket(&packet.ChunkRadiusUpdated{
+			w.proxy.InjectToClient(&packet.ChunkRadiusUpdated{
 				ChunkRadius: w.settings.ChunkRadius,
 			})
 
-			w.proxy.Server.WritePacket(&packet.RequestChunkRadius{
+			w.proxy.InjectToServer(&packet.RequestChunkRadius{
 				ChunkRadius: w.settings.ChunkRadius,
 			})
 
@@ -268,13 +254,24 @@ func NewWorldsHandler(settings WorldSettings) *proxy.Handler {
 		},
 
 		PacketCB: w.packetCB,
+		OnReconnect: func() {
+			// the world keeps being captured into the same state after reconnecting
+			w.mapUI.Stop()
+			clear(w.serverState.openItemContainers)
+		},
 		OnEnd: func() {
+			w.mapUI.Stop()
 			w.SaveAndReset(true, nil)
 			w.wg.Wait()
-			resetGlobals()
+			w.scripting.Close()
+			w.releaseGlobals()
 		},
 		Deferred: cancel,
 	}
+	if len(settings.Scripts) == 0 {
+		// scripts are loaded after the proxy decides which packets to decode, they may want any
+		h.Packets = worldsPackets
+	}
 
 	return h
 }
@@ -333,7 +330,7 @@ func (w *worldsHandler) setVoidGen(val bool, fromUI bool) bool {
 			voidGen = "true"
 		}
 
-		messages.Router.Handle(&messages.Message{
+		w.proxy.UI(&messages.Message{
 			Source: "subcommand",
 			Target: "ui",
 			Data: messages.SetValue{
@@ -355,7 +352,7 @@ func (w *worldsHandler) setWorldName(val string, fromUI bool) bool {
 	w.proxy.SendMessage(locale.Loc("worldname_set", locale.Strmap{"Name": w.currentWorld.Name}))
 
 	if !fromUI {
-		messages.Router.Handle(&messages.Message{
+		w.proxy.UI(&messages.Message{
 			Source: "subcommand",
 			Target: "ui",
 			Data: messages.SetValue{
@@ -387,9 +384,13 @@ func (w *worldsHandler) SaveAndReset(end bool, dim world.Dimension) {
 	}
 
 	// save image of the map
+	var img image.Image
+	if w.settings.SaveImage || w.settings.Template {
+		img = w.mapUI.ToImage()
+	}
 	if w.settings.SaveImage {
 		f, _ := os.Create(w.currentWorld.Folder + ".png")
-		png.Encode(f, w.mapUI.ToImage())
+		png.Encode(f, img)
 		f.Close()
 	}
 
@@ -399,6 +400,7 @@ func (w *worldsHandler) SaveAndReset(end bool, dim world.Dimension) {
 
 	// swap states
 	worldState := w.currentWorld
+	customEntities := maps.Clone(w.serverState.customEntities)
 	if end {
 		w.currentWorld = nil
 	} else {
@@ -409,11 +411,14 @@ func (w *worldsHandler) SaveAndReset(end bool, dim world.Dimension) {
 	w.wg.Add(1)
 	go func() {
 		defer w.wg.Done()
-		w.saveWorldState(worldState)
+		err := w.saveWorldState(worldState, img, customEntities)
+		if err != nil {
+			logrus.Error(err)
+		}
 	}()
 }
 
-func (w *worldsHandler) saveWorldState(worldState *worldstate.World) error {
+func (w *worldsHandler) saveWorldState(worldState *worldstate.World, img image.Image, customEntities map[string]struct{}) error {
 	playerPos := w.proxy.Player.Position
 	spawnPos := cube.Pos{int(playerPos.X()), int(playerPos.Y()), int(playerPos.Z())}
 
@@ -422,8 +427,14 @@ func (w *worldsHandler) saveWorldState(worldState *worldstate.World) error {
 	w.proxy.SendMessage(text)
 
 	filename := worldState.Folder + ".mcworld"
+	if w.settings.Template {
+		filename = worldState.Folder + ".mctemplate"
+	}
+	if !w.settings.Output.zip() {
+		filename = worldState.Folder
+	}
 
-	messages.Router.Handle(&messages.Message{
+	w.proxy.UI(&messages.Message{
 		Source: "subcommand",
 		Target: "ui",
 		Data: messages.SavingWorld{
@@ -436,17 +447,36 @@ func (w *worldsHandler) saveWorldState(worldState *worldstate.World) error {
 		},
 	})
 
+	w.scripting.OnSave(worldState.Name, worldState.Folder)
+
 	err := worldState.Finish(w.playerData(), w.settings.ExcludedMobs, w.settings.Players, spawnPos, w.proxy.Server.GameData(), w.bp)
 	if err != nil {
 		return err
 	}
-	w.AddPacks(worldState.Folder)
+	w.AddPacks(worldState.Folder, customEntities)
+	if w.settings.Template {
+		err = w.writeTemplateFiles(worldState.Folder, worldState.Name, img)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !w.settings.Output.zip() {
+		logrus.Info(locale.Loc("saved", locale.Strmap{"Name": worldState.Folder}))
+		return nil
+	}
 
 	// zip it
 	err = utils.ZipFolder(filename, worldState.Folder)
 	if err != nil {
 		return err
 	}
+	if !w.settings.Output.keepFolder() {
+		err = os.RemoveAll(worldState.Folder)
+		if err != nil {
+			return err
+		}
+	}
 	logrus.Info(locale.Loc("saved", locale.Strmap{"Name": filename}))
 	return nil
 }
@@ -480,11 +510,19 @@ func (w *worldsHandler) defaultWorldName() string {
 
 func (w *worldsHandler) openWorldState(deferred bool) {
 	name := w.defaultWorldName()
-	folder := fmt.Sprintf("worlds/%s/%s", w.serverState.Name, name)
-	w.currentWorld.Open(name, folder, deferred)
+	w.currentWorld.PlayerData = w.playerData
+	w.currentWorld.GameData = w.proxy.Server.GameData
+	w.currentWorld.Experiments = func() bool {
+		return w.bp != nil && w.bp.HasContent()
+	}
+	w.currentWorld.PostProcess = w.postProcess
+	w.currentWorld.Open(name, w.worldFolder(name), deferred)
 }
 
 func (w *worldsHandler) renameWorldState(name string) error {
-	folder := fmt.Sprintf("worlds/%s/%s", w.serverState.Name, name)
-	return w.currentWorld.Rename(name, folder)
+	return w.currentWorld.Rename(name, w.worldFolder(name))
+}
+
+func (w *worldsHandler) worldFolder(name string) string {
+	return w.settings.Output.worldFolder(w.serverState.Name, name, w.currentWorld.DimensionName(), w.serverState.worldCounter, time.Now())
 }
@@ -0,0 +1,416 @@
+package worldstate
+
+import (
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/df-mc/dragonfly/server/world/chunk"
+)
+
+// blockEntityConverters rewrite the nbt of a block actor, as sent by the server, into the form the game stores on disk
+var blockEntityConverters = map[string]func(nbt map[string]any){
+	"Sign":              convertSign,
+	"HangingSign":       convertSign,
+	"Banner":            convertBanner,
+	"Lectern":           convertLectern,
+	"ItemFrame":         convertItemFrame,
+	"GlowItemFrame":     convertItemFrame,
+	"Beehive":           convertBeehive,
+	"BeeNest":           convertBeehive,
+	"Chest":             convertContainer,
+	"Barrel":            convertContainer,
+	"ShulkerBox":        convertContainer,
+	"Hopper":            convertContainer,
+	"Dispenser":         convertContainer,
+	"Dropper":           convertContainer,
+	"Furnace":           convertContainer,
+	"BlastFurnace":      convertContainer,
+	"Smoker":            convertContainer,
+	"BrewingStand":      convertContainer,
+	"ChiseledBookshelf": convertContainer,
+	"DecoratedPot":      convertDecoratedPot,
+	"Campfire":          convertCampfire,
+	"SoulCampfire":      convertCampfire,
+	"FlowerPot":         convertFlowerPot,
+	"Skull":             convertSkull,
+	"MobSpawner":        convertMobSpawner,
+	"JukeBox":           convertJukebox,
+	"CommandBlock":      convertCommandBlock,
+}
+
+// convertBlockEntity returns a copy of nbt in its disk form, the input is left untouched
+func convertBlockEntity(nbt map[string]any) map[string]any {
+	out := deepCopyNBT(nbt).(map[string]any)
+	id, _ := out["id"].(string)
+
+	out["isMovable"] = nbtByte(out["isMovable"], 1)
+	if name, ok := out["CustomName"].(string); ok && name == "" {
+		delete(out, "CustomName")
+	}
+	for _, k := range []string{"x", "y", "z"} {
+		out[k] = nbtInt32(out[k], 0)
+	}
+
+	if conv, ok := blockEntityConverters[id]; ok {
+		conv(out)
+	}
+	return out
+}
+
+// mergeBlockNBT combines a newly received block actor with one that already existed at the same position,
+// keeping container contents that were captured from the inventory when the new one doesnt contain any
+func mergeBlockNBT(old, new DummyBlock) DummyBlock {
+	if old.NBT == nil {
+		return new
+	}
+	if new.NBT == nil {
+		return old
+	}
+	if old.ID != "" && new.ID != "" && old.ID != new.ID {
+		return new
+	}
+	for _, k := range []string{"Items", "book", "Item"} {
+		if _, ok := new.NBT[k]; ok {
+			continue
+		}
+		if v, ok := old.NBT[k]; ok {
+			new.NBT[k] = v
+		}
+	}
+	if new.ID == "" {
+		new.ID = old.ID
+	}
+	return new
+}
+
+func convertSign(nbt map[string]any) {
+	// pre 1.19.80 signs only have one side
+	if text, ok := nbt["Text"].(string); ok {
+		front := map[string]any{
+			"Text":           text,
+			"SignTextColor":  nbtInt32(nbt["SignTextColor"], -0x1000000),
+			"IgnoreLighting": nbtByte(nbt["IgnoreLighting"], 0),
+			"TextOwner":      nbtString(nbt["TextOwner"]),
+		}
+		for _, k := range []string{"Text", "SignTextColor", "IgnoreLighting", "TextOwner", "TextIgnoreLegacyBugResolved"} {
+			delete(nbt, k)
+		}
+		nbt["FrontText"] = front
+	}
+
+	for _, side := range []string{"FrontText", "BackText"} {
+		m, ok := nbt[side].(map[string]any)
+		if !ok {
+			m = map[string]any{}
+		}
+		// some servers send the dragonfly style keys
+		if c, ok := m["Color"]; ok {
+			m["SignTextColor"] = c
+			delete(m, "Color")
+		}
+		if g, ok := m["GlowingText"]; ok {
+			m["IgnoreLighting"] = g
+			delete(m, "GlowingText")
+		}
+		if o, ok := m["Owner"]; ok {
+			m["TextOwner"] = o
+			delete(m, "Owner")
+		}
+		m["Text"] = nbtString(m["Text"])
+		m["TextOwner"] = nbtString(m["TextOwner"])
+		m["SignTextColor"] = nbtInt32(m["SignTextColor"], -0x1000000)
+		m["IgnoreLighting"] = nbtByte(m["IgnoreLighting"], 0)
+		m["HideGlowOutline"] = nbtByte(m["HideGlowOutline"], 0)
+		m["PersistFormatting"] = nbtByte(m["PersistFormatting"], 1)
+		nbt[side] = m
+	}
+	nbt["IsWaxed"] = nbtByte(nbt["IsWaxed"], 0)
+}
+
+func convertBanner(nbt map[string]any) {
+	nbt["Base"] = nbtInt32(nbt["Base"], 0)
+	nbt["Type"] = nbtInt32(nbt["Type"], 0)
+	var patterns []any
+	for _, p := range nbtList(nbt["Patterns"]) {
+		p, ok := p.(map[string]any)
+		if !ok {
+			continue
+		}
+		patterns = append(patterns, map[string]any{
+			"Color":   nbtInt32(p["Color"], 0),
+			"Pattern": nbtString(p["Pattern"]),
+		})
+	}
+	if len(patterns) > 0 {
+		nbt["Patterns"] = patterns
+	} else {
+		delete(nbt, "Patterns")
+	}
+}
+
+func convertLectern(nbt map[string]any) {
+	book, ok := nbt["book"].(map[string]any)
+	nbt["hasBook"] = nbtByte(nbt["hasBook"], boolByte(ok))
+	nbt["page"] = nbtInt32(nbt["page"], 0)
+	if ok {
+		nbt["book"] = convertItemNBT(book)
+		if _, ok := nbt["totalPages"]; !ok {
+			tag, _ := book["tag"].(map[string]any)
+			nbt["totalPages"] = int32(len(nbtList(tag["pages"])))
+		}
+		nbt["totalPages"] = nbtInt32(nbt["totalPages"], 0)
+	}
+}
+
+func convertItemFrame(nbt map[string]any) {
+	switch r := nbt["ItemRotation"].(type) {
+	case uint8:
+		nbt["ItemRotation"] = float32(r) * 45
+	case int32:
+		nbt["ItemRotation"] = float32(r) * 45
+	case float32:
+	default:
+		nbt["ItemRotation"] = float32(0)
+	}
+	if _, ok := nbt["ItemDropChance"].(float32); !ok {
+		nbt["ItemDropChance"] = float32(1)
+	}
+	if it, ok := nbt["Item"].(map[string]any); ok {
+		nbt["Item"] = convertItemNBT(it)
+	}
+}
+
+func convertBeehive(nbt map[string]any) {
+	var occupants []any
+	for _, o := range nbtList(nbt["Occupants"]) {
+		o, ok := o.(map[string]any)
+		if !ok {
+			continue
+		}
+		if _, ok := o["ActorIdentifier"]; !ok {
+			o["ActorIdentifier"] = "minecraft:bee<>"
+		}
+		o["TicksLeftToStay"] = nbtInt32(o["TicksLeftToStay"], 0)
+		if _, ok := o["SaveData"].(map[string]any); !ok {
+			o["SaveData"] = map[string]any{
+				"identifier": "minecraft:bee",
+			}
+		}
+		occupants = append(occupants, o)
+	}
+	nbt["Occupants"] = occupants
+	nbt["ShouldSpawnBees"] = nbtByte(nbt["ShouldSpawnBees"], 0)
+}
+
+func convertContainer(nbt map[string]any) {
+	var items []any
+	for i, it := range nbtList(nbt["Items"]) {
+		it, ok := it.(map[string]any)
+		if !ok {
+			continue
+		}
+		it = convertItemNBT(it)
+		it["Slot"] = nbtByte(it["Slot"], uint8(i))
+		items = append(items, it)
+	}
+	nbt["Items"] = items
+	nbt["Findable"] = nbtByte(nbt["Findable"], 0)
+	if _, ok := nbt["pairx"]; ok {
+		nbt["pairx"] = nbtInt32(nbt["pairx"], 0)
+		nbt["pairz"] = nbtInt32(nbt["pairz"], 0)
+		nbt["pairlead"] = nbtByte(nbt["pairlead"], 0)
+	}
+}
+
+func convertDecoratedPot(nbt map[string]any) {
+	var sherds []any
+	for _, s := range nbtList(nbt["sherds"]) {
+		sherds = append(sherds, nbtString(s))
+	}
+	if len(sherds) > 0 {
+		nbt["sherds"] = sherds
+	}
+	if it, ok := nbt["item"].(map[string]any); ok {
+		nbt["item"] = convertItemNBT(it)
+	}
+}
+
+func convertCampfire(nbt map[string]any) {
+	for i := 1; i <= 4; i++ {
+		k := "Item" + strconv.Itoa(i)
+		if it, ok := nbt[k].(map[string]any); ok {
+			nbt[k] = convertItemNBT(it)
+		}
+		tk := "ItemTime" + strconv.Itoa(i)
+		if _, ok := nbt[tk]; ok {
+			nbt[tk] = nbtInt32(nbt[tk], 0)
+		}
+	}
+}
+
+func convertFlowerPot(nbt map[string]any) {
+	if b, ok := nbt["PlantBlock"].(map[string]any); ok {
+		if _, ok := b["version"]; !ok {
+			b["version"] = chunk.CurrentBlockVersion
+		}
+		if _, ok := b["states"].(map[string]any); !ok {
+			b["states"] = map[string]any{}
+		}
+	}
+}
+
+func convertSkull(nbt map[string]any) {
+	nbt["Rotation"] = nbtFloat32(nbt["Rotation"], 0)
+	nbt["SkullType"] = nbtByte(nbt["SkullType"], 0)
+	nbt["MouthMoving"] = nbtByte(nbt["MouthMoving"], 0)
+	nbt["MouthTickCount"] = nbtInt32(nbt["MouthTickCount"], 0)
+}
+
+func convertMobSpawner(nbt map[string]any) {
+	if id, ok := nbt["EntityIdentifier"].(string); ok && !strings.Contains(id, ":") {
+		nbt["EntityIdentifier"] = "minecraft:" + id
+	}
+	for _, k := range []string{"Delay", "MinSpawnDelay", "MaxSpawnDelay", "SpawnCount", "MaxNearbyEntities", "RequiredPlayerRange", "SpawnRange"} {
+		if v, ok := nbt[k]; ok {
+			nbt[k] = nbtInt16(v, 0)
+		}
+	}
+}
+
+func convertJukebox(nbt map[string]any) {
+	if it, ok := nbt["RecordItem"].(map[string]any); ok {
+		nbt["RecordItem"] = convertItemNBT(it)
+	}
+}
+
+func convertCommandBlock(nbt map[string]any) {
+	nbt["Command"] = nbtString(nbt["Command"])
+	nbt["Version"] = nbtInt32(nbt["Version"], 36)
+	nbt["auto"] = nbtByte(nbt["auto"], 0)
+	nbt["powered"] = nbtByte(nbt["powered"], 0)
+	nbt["TrackOutput"] = nbtByte(nbt["TrackOutput"], 1)
+}
+
+// convertItemNBT fixes the types of an item compound nested in a block actor
+func convertItemNBT(it map[string]any) map[string]any {
+	it["Name"] = nbtString(it["Name"])
+	it["Count"] = nbtByte(it["Count"], 1)
+	it["Damage"] = nbtInt16(it["Damage"], 0)
+	it["WasPickedUp"] = nbtByte(it["WasPickedUp"], 0)
+	if b, ok := it["Block"].(map[string]any); ok {
+		if _, ok := b["version"]; !ok {
+			b["version"] = chunk.CurrentBlockVersion
+		}
+	}
+	return it
+}
+
+func deepCopyNBT(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, v2 := range v {
+			m[k] = deepCopyNBT(v2)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, v2 := range v {
+			s[i] = deepCopyNBT(v2)
+		}
+		return s
+	case []map[string]any:
+		s := make([]any, len(v))
+		for i, v2 := range v {
+			s[i] = deepCopyNBT(v2)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+func nbtList(v any) []any {
+	switch v := v.(type) {
+	case []any:
+		return v
+	case []map[string]any:
+		s := make([]any, len(v))
+		for i, m := range v {
+			s[i] = maps.Clone(m)
+		}
+		return s
+	}
+	return nil
+}
+
+func boolByte(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func nbtString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func nbtByte(v any, def uint8) uint8 {
+	switch v := v.(type) {
+	case uint8:
+		return v
+	case int8:
+		return uint8(v)
+	case bool:
+		return boolByte(v)
+	case int16:
+		return uint8(v)
+	case int32:
+		return uint8(v)
+	case int64:
+		return uint8(v)
+	}
+	return def
+}
+
+func nbtInt16(v any, def int16) int16 {
+	switch v := v.(type) {
+	case int16:
+		return v
+	case uint8:
+		return int16(v)
+	case int32:
+		return int16(v)
+	case int64:
+		return int16(v)
+	}
+	return def
+}
+
+func nbtInt32(v any, def int32) int32 {
+	switch v := v.(type) {
+	case int32:
+		return v
+	case uint8:
+		return int32(v)
+	case int16:
+		return int32(v)
+	case int64:
+		return int32(v)
+	}
+	return def
+}
+
+func nbtFloat32(v any, def float32) float32 {
+	switch v := v.(type) {
+	case float32:
+		return v
+	case float64:
+		return float32(v)
+	case int32:
+		return float32(v)
+	}
+	return def
+}
@@ -0,0 +1,198 @@
+package worldstate
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestConvertBlockEntity(t *testing.T) {
+	tests := []struct {
+		name string
+		in   map[string]any
+		want map[string]any
+	}{
+		{
+			name: "old sign",
+			in: map[string]any{
+				"id": "Sign", "x": int32(1), "y": int16(2), "z": int64(3),
+				"Text": "hello", "SignTextColor": int32(-1), "TextIgnoreLegacyBugResolved": uint8(1),
+				"CustomName": "",
+			},
+			want: map[string]any{
+				"id": "Sign", "x": int32(1), "y": int32(2), "z": int32(3), "isMovable": uint8(1),
+				"FrontText": map[string]any{
+					"Text": "hello", "SignTextColor": int32(-1), "IgnoreLighting": uint8(0), "TextOwner": "",
+					"HideGlowOutline": uint8(0), "PersistFormatting": uint8(1),
+				},
+				"BackText": map[string]any{
+					"Text": "", "SignTextColor": int32(-0x1000000), "IgnoreLighting": uint8(0), "TextOwner": "",
+					"HideGlowOutline": uint8(0), "PersistFormatting": uint8(1),
+				},
+				"IsWaxed": uint8(0),
+			},
+		},
+		{
+			name: "sign with dragonfly keys",
+			in: map[string]any{
+				"id": "HangingSign", "x": int32(0), "y": int32(0), "z": int32(0), "IsWaxed": true,
+				"FrontText": map[string]any{"Text": "front", "Color": int32(5), "GlowingText": uint8(1), "Owner": "me"},
+			},
+			want: map[string]any{
+				"id": "HangingSign", "x": int32(0), "y": int32(0), "z": int32(0), "isMovable": uint8(1),
+				"FrontText": map[string]any{
+					"Text": "front", "SignTextColor": int32(5), "IgnoreLighting": uint8(1), "TextOwner": "me",
+					"HideGlowOutline": uint8(0), "PersistFormatting": uint8(1),
+				},
+				"BackText": map[string]any{
+					"Text": "", "SignTextColor": int32(-0x1000000), "IgnoreLighting": uint8(0), "TextOwner": "",
+					"HideGlowOutline": uint8(0), "PersistFormatting": uint8(1),
+				},
+				"IsWaxed": uint8(1),
+			},
+		},
+		{
+			name: "banner",
+			in: map[string]any{
+				"id": "Banner", "x": int32(0), "y": int32(0), "z": int32(0), "Base": uint8(4),
+				"Patterns": []map[string]any{{"Color": int32(1), "Pattern": "bo"}},
+			},
+			want: map[string]any{
+				"id": "Banner", "x": int32(0), "y": int32(0), "z": int32(0), "isMovable": uint8(1),
+				"Base": int32(4), "Type": int32(0),
+				"Patterns": []any{map[string]any{"Color": int32(1), "Pattern": "bo"}},
+			},
+		},
+		{
+			name: "banner without patterns",
+			in:   map[string]any{"id": "Banner", "x": int32(0), "y": int32(0), "z": int32(0), "Patterns": []any{}},
+			want: map[string]any{
+				"id": "Banner", "x": int32(0), "y": int32(0), "z": int32(0), "isMovable": uint8(1),
+				"Base": int32(0), "Type": int32(0),
+			},
+		},
+		{
+			name: "lectern with a book",
+			in: map[string]any{
+				"id": "Lectern", "x": int32(0), "y": int32(0), "z": int32(0), "page": int16(1),
+				"book": map[string]any{
+					"Name": "minecraft:writable_book", "Count": int32(1),
+					"tag": map[string]any{"pages": []any{map[string]any{"text": "a"}, map[string]any{"text": "b"}}},
+				},
+			},
+			want: map[string]any{
+				"id": "Lectern", "x": int32(0), "y": int32(0), "z": int32(0), "isMovable": uint8(1),
+				"hasBook": uint8(1), "page": int32(1), "totalPages": int32(2),
+				"book": map[string]any{
+					"Name": "minecraft:writable_book", "Count": uint8(1), "Damage": int16(0), "WasPickedUp": uint8(0),
+					"tag": map[string]any{"pages": []any{map[string]any{"text": "a"}, map[string]any{"text": "b"}}},
+				},
+			},
+		},
+		{
+			name: "empty lectern",
+			in:   map[string]any{"id": "Lectern", "x": int32(0), "y": int32(0), "z": int32(0)},
+			want: map[string]any{
+				"id": "Lectern", "x": int32(0), "y": int32(0), "z": int32(0), "isMovable": uint8(1),
+				"hasBook": uint8(0), "page": int32(0),
+			},
+		},
+		{
+			name: "item frame",
+			in: map[string]any{
+				"id": "GlowItemFrame", "x": int32(0), "y": int32(0), "z": int32(0), "ItemRotation": uint8(3),
+				"Item": map[string]any{"Name": "minecraft:map", "Count": uint8(1), "Damage": int32(6)},
+			},
+			want: map[string]any{
+				"id": "GlowItemFrame", "x": int32(0), "y": int32(0), "z": int32(0), "isMovable": uint8(1),
+				"ItemRotation": float32(135), "ItemDropChance": float32(1),
+				"Item": map[string]any{"Name": "minecraft:map", "Count": uint8(1), "Damage": int16(6), "WasPickedUp": uint8(0)},
+			},
+		},
+		{
+			name: "container items",
+			in: map[string]any{
+				"id": "Chest", "x": int32(0), "y": int32(0), "z": int32(0), "pairx": int64(1), "pairz": int32(0),
+				"Items": []any{
+					map[string]any{"Name": "minecraft:stone", "Count": int32(64), "Slot": uint8(5)},
+					map[string]any{"Name": "minecraft:dirt"},
+					"not an item",
+				},
+			},
+			want: map[string]any{
+				"id": "Chest", "x": int32(0), "y": int32(0), "z": int32(0), "isMovable": uint8(1),
+				"Findable": uint8(0), "pairx": int32(1), "pairz": int32(0), "pairlead": uint8(0),
+				"Items": []any{
+					map[string]any{"Name": "minecraft:stone", "Count": uint8(64), "Damage": int16(0), "WasPickedUp": uint8(0), "Slot": uint8(5)},
+					map[string]any{"Name": "minecraft:dirt", "Count": uint8(1), "Damage": int16(0), "WasPickedUp": uint8(0), "Slot": uint8(1)},
+				},
+			},
+		},
+		{
+			name: "unknown block entity",
+			in:   map[string]any{"id": "Something", "x": int32(0), "y": int32(0), "z": int32(0), "isMovable": uint8(0), "Custom": "kept"},
+			want: map[string]any{"id": "Something", "x": int32(0), "y": int32(0), "z": int32(0), "isMovable": uint8(0), "Custom": "kept"},
+		},
+	}
+	for _, tt := range tests {
+		// printed maps are sorted, so this is enough to see if the input changed
+		before := fmt.Sprintf("%#v", tt.in)
+		got := convertBlockEntity(tt.in)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\ngot  %#v\nwant %#v", tt.name, got, tt.want)
+		}
+		if fmt.Sprintf("%#v", tt.in) != before {
+			t.Errorf("%s: the input was changed", tt.name)
+		}
+	}
+}
+
+func TestMergeBlockNBT(t *testing.T) {
+	items := []any{map[string]any{"Name": "minecraft:stone"}}
+	tests := []struct {
+		name     string
+		old, new DummyBlock
+		want     DummyBlock
+	}{
+		{
+			name: "keeps captured items",
+			old:  DummyBlock{ID: "Chest", NBT: map[string]any{"Items": items}},
+			new:  DummyBlock{ID: "Chest", NBT: map[string]any{"CustomName": "x"}},
+			want: DummyBlock{ID: "Chest", NBT: map[string]any{"CustomName": "x", "Items": items}},
+		},
+		{
+			name: "new items win",
+			old:  DummyBlock{ID: "Chest", NBT: map[string]any{"Items": items}},
+			new:  DummyBlock{ID: "Chest", NBT: map[string]any{"Items": []any{}}},
+			want: DummyBlock{ID: "Chest", NBT: map[string]any{"Items": []any{}}},
+		},
+		{
+			name: "different block replaces",
+			old:  DummyBlock{ID: "Chest", NBT: map[string]any{"Items": items}},
+			new:  DummyBlock{ID: "Sign", NBT: map[string]any{}},
+			want: DummyBlock{ID: "Sign", NBT: map[string]any{}},
+		},
+		{
+			name: "keeps id and book",
+			old:  DummyBlock{ID: "Lectern", NBT: map[string]any{"book": map[string]any{}}},
+			new:  DummyBlock{NBT: map[string]any{"page": int32(2)}},
+			want: DummyBlock{ID: "Lectern", NBT: map[string]any{"page": int32(2), "book": map[string]any{}}},
+		},
+		{
+			name: "nothing before",
+			new:  DummyBlock{ID: "Chest", NBT: map[string]any{}},
+			want: DummyBlock{ID: "Chest", NBT: map[string]any{}},
+		},
+		{
+			name: "nothing new",
+			old:  DummyBlock{ID: "ItemFrame", NBT: map[string]any{"Item": map[string]any{}}},
+			want: DummyBlock{ID: "ItemFrame", NBT: map[string]any{"Item": map[string]any{}}},
+		},
+	}
+	for _, tt := range tests {
+		got := mergeBlockNBT(tt.old, tt.new)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -20,6 +20,11 @@ type worldStateDefer struct {
 
 func (w *worldStateDefer) StoreChunk(pos world.ChunkPos, ch *chunk.Chunk, blockNBT map[cube.Pos]DummyBlock) {
 	w.chunks[pos] = ch
+	if old, ok := w.blockNBTs[pos]; ok {
+		for p, b := range blockNBT {
+			blockNBT[p] = mergeBlockNBT(old[p], b)
+		}
+	}
 	w.blockNBTs[pos] = blockNBT
 }
 
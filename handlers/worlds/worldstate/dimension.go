@@ -0,0 +1,83 @@
+package worldstate
+
+import (
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+var vanillaDimensionNames = map[int]string{
+	0: "minecraft:overworld",
+	1: "minecraft:nether",
+	2: "minecraft:the_end",
+}
+
+// DimensionIDForDefinition returns the id of the dimension a definition from DimensionData is stored as,
+// vanilla names map to their own dimension, anything else is picked by its generator
+func DimensionIDForDefinition(dd protocol.DimensionDefinition) (id int, vanilla bool) {
+	for id, name := range vanillaDimensionNames {
+		if dd.Name == name {
+			return id, true
+		}
+	}
+	switch dd.Generator {
+	case protocol.GeneratorNether:
+		return 1, false
+	case protocol.GeneratorEnd:
+		return 2, false
+	default:
+		return 0, false
+	}
+}
+
+// AddDimensionDefinition adds a definition to defs, custom definitions only apply when the server
+// didnt also send one for the vanilla dimension they are stored as
+func AddDimensionDefinition(defs map[int]protocol.DimensionDefinition, dd protocol.DimensionDefinition) {
+	id, vanilla := DimensionIDForDefinition(dd)
+	if existing, ok := defs[id]; ok && !vanilla {
+		if _, existingVanilla := DimensionIDForDefinition(existing); existingVanilla {
+			return
+		}
+	}
+	defs[id] = dd
+}
+
+// dimensionRange converts the range of a definition to a cube.Range,
+// the server sends the max first and the max is exclusive
+func dimensionRange(dd protocol.DimensionDefinition) cube.Range {
+	return cube.Range{int(dd.Range[1]), int(dd.Range[0]) - 1}
+}
+
+// definitionRange is the inverse of dimensionRange
+func definitionRange(r cube.Range) [2]int32 {
+	return [2]int32{int32(r.Max()) + 1, int32(r.Min())}
+}
+
+// dimensionMetadata is stored in the world db under bedrocktool_dimension so the dimension a world was
+// captured in can be identified when it is opened again.
+// level.dat has no field for this, bedrock reads custom dimension heights from packs and not from the world.
+// the range is in the same order as protocol.DimensionDefinition.
+type dimensionMetadata struct {
+	ID        int32    `nbt:"id"`
+	Name      string   `nbt:"name"`
+	Range     [2]int32 `nbt:"range"`
+	Generator int32    `nbt:"generator"`
+}
+
+func (w *World) dimensionMetadata() dimensionMetadata {
+	id, _ := world.DimensionID(w.dimension)
+	return dimensionMetadata{
+		ID:        int32(id),
+		Name:      w.dimensionName,
+		Range:     definitionRange(w.dimRange),
+		Generator: w.dimensionGenerator,
+	}
+}
+
+func (dm dimensionMetadata) definition() protocol.DimensionDefinition {
+	return protocol.DimensionDefinition{
+		Name:      dm.Name,
+		Range:     dm.Range,
+		Generator: dm.Generator,
+	}
+}
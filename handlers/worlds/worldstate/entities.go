@@ -55,15 +55,17 @@ func (w *worldEntities) SetBlockNBT(pos cube.Pos, m map[string]any, merge bool)
 	b, ok := chunkNBTs[pos]
 	if !ok {
 		b = DummyBlock{
-			ID:  m["id"].(string),
-			NBT: m,
+			NBT: make(map[string]any),
 		}
 	}
 
 	if merge {
 		maps.Copy(b.NBT, m)
 	} else {
-		b.NBT = m
+		b = mergeBlockNBT(b, DummyBlock{NBT: m})
+	}
+	if id, ok := b.NBT["id"].(string); ok {
+		b.ID = id
 	}
 	chunkNBTs[pos] = b
 }
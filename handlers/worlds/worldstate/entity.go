@@ -293,6 +293,17 @@ func vec3float32(x mgl32.Vec3) []float32 {
 	return []float32{float32(x[0]), float32(x[1]), float32(x[2])}
 }
 
+func linksTag(links []int64) []map[string]any {
+	var tag []map[string]any
+	for i, el := range links {
+		tag = append(tag, map[string]any{
+			"entityID": el,
+			"linkID":   int32(i),
+		})
+	}
+	return tag
+}
+
 func (s *EntityState) ToServerEntity(links []int64) serverEntity {
 	e := serverEntity{
 		EntityType: serverEntityType{
@@ -307,15 +318,8 @@ func (s *EntityState) ToServerEntity(links []int64) serverEntity {
 	}
 	s.toNBT(e.EntityType.NBT)
 
-	var linksTag []map[string]any
-	for i, el := range links {
-		linksTag = append(linksTag, map[string]any{
-			"entityID": el,
-			"linkID":   int32(i),
-		})
-	}
-	if len(linksTag) > 0 {
-		e.EntityType.NBT["LinksTag"] = linksTag
+	if len(links) > 0 {
+		e.EntityType.NBT["LinksTag"] = linksTag(links)
 	}
 
 	if false {
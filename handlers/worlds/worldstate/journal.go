@@ -0,0 +1,311 @@
+package worldstate
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/sandertv/gophertunnel/minecraft/nbt"
+	"golang.org/x/exp/maps"
+)
+
+// JournalFilename is the name of the journal file inside of a world folder.
+const JournalFilename = "bedrocktool_journal"
+
+type journalRecordType byte
+
+const (
+	journalRecordLevel journalRecordType = iota + 1
+	journalRecordPlayerData
+	journalRecordEntity
+	journalRecordEntityLinks
+	journalRecordBlockNBT
+	journalRecordMap
+)
+
+// journal is an append only log of everything a world keeps in memory until it is finished.
+// records are written when they have changed since the last time, later records replace earlier ones.
+type journal struct {
+	f       *os.File
+	w       *bufio.Writer
+	written map[string]uint64
+}
+
+type journalEntity struct {
+	RuntimeID int64
+	UniqueID  int64
+	Type      string
+	Position  []float32
+	NBT       map[string]any
+}
+
+type journalEntityLinks struct {
+	UniqueID int64
+	Riders   []int64
+}
+
+type journalBlock struct {
+	X, Y, Z int32
+	ID      string
+	NBT     map[string]any
+}
+
+type journalBlockNBT struct {
+	X, Z   int32
+	Blocks []journalBlock
+}
+
+func openJournal(folder string) (*journal, error) {
+	f, err := os.OpenFile(filepath.Join(folder, JournalFilename), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{
+		f:       f,
+		w:       bufio.NewWriter(f),
+		written: make(map[string]uint64),
+	}, nil
+}
+
+// write appends a record if its content is different from the last one written with the same key
+func (j *journal) write(key string, t journalRecordType, v any) error {
+	// nbt does not write maps in a stable order, json sorts the keys so it is used for comparing
+	h := fnv.New64a()
+	if err := json.NewEncoder(h).Encode(v); err == nil {
+		sum := h.Sum64()
+		if last, ok := j.written[key]; ok && last == sum {
+			return nil
+		}
+		j.written[key] = sum
+	}
+
+	data, err := nbt.MarshalEncoding(v, nbt.LittleEndian)
+	if err != nil {
+		return err
+	}
+
+	var hdr [5]byte
+	hdr[0] = byte(t)
+	binary.LittleEndian.PutUint32(hdr[1:], uint32(len(data)))
+	if _, err := j.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *journal) flush() error {
+	if err := j.w.Flush(); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+func (j *journal) Close() error {
+	err := j.w.Flush()
+	if err2 := j.f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// writeJournal appends everything that changed since the last call, has to be called with the lock held
+func (w *World) writeJournal() error {
+	if w.journal == nil {
+		var err error
+		w.journal, err = openJournal(w.Folder)
+		if err != nil {
+			return err
+		}
+	}
+	j := w.journal
+
+	info := w.levelInfo()
+	if w.PlayerData != nil {
+		playerData := w.PlayerData()
+		x, _ := playerData["SpawnX"].(int32)
+		y, _ := playerData["SpawnY"].(int32)
+		z, _ := playerData["SpawnZ"].(int32)
+		info.Spawn = []int32{x, y, z}
+		if err := j.write("player", journalRecordPlayerData, playerData); err != nil {
+			return err
+		}
+	}
+	if err := j.write("level", journalRecordLevel, info); err != nil {
+		return err
+	}
+
+	for _, es := range w.memState.entities {
+		se := es.ToServerEntity(nil)
+		err := j.write(fmt.Sprintf("entity_%d", es.RuntimeID), journalRecordEntity, journalEntity{
+			RuntimeID: int64(es.RuntimeID),
+			UniqueID:  es.UniqueID,
+			Type:      es.EntityType,
+			Position:  vec3float32(es.Position),
+			NBT:       se.EntityType.NBT,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for id, riders := range w.memState.entityLinks {
+		err := j.write(fmt.Sprintf("links_%d", id), journalRecordEntityLinks, journalEntityLinks{
+			UniqueID: id,
+			Riders:   riderIDs(riders),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for cp, blocks := range w.memState.blockNBTs {
+		rec := journalBlockNBT{X: cp[0], Z: cp[1]}
+		for pos, b := range blocks {
+			rec.Blocks = append(rec.Blocks, journalBlock{
+				X: int32(pos.X()), Y: int32(pos.Y()), Z: int32(pos.Z()),
+				ID:  b.ID,
+				NBT: b.NBT,
+			})
+		}
+		slices.SortFunc(rec.Blocks, func(a, b journalBlock) int {
+			if a.X != b.X {
+				return cmp.Compare(a.X, b.X)
+			}
+			if a.Y != b.Y {
+				return cmp.Compare(a.Y, b.Y)
+			}
+			return cmp.Compare(a.Z, b.Z)
+		})
+		if err := j.write(fmt.Sprintf("blocks_%d_%d", cp[0], cp[1]), journalRecordBlockNBT, rec); err != nil {
+			return err
+		}
+	}
+
+	for id, m := range w.memState.maps {
+		if err := j.write(fmt.Sprintf("map_%d", id), journalRecordMap, m); err != nil {
+			return err
+		}
+	}
+
+	return j.flush()
+}
+
+func riderIDs(riders map[EntityUniqueID]struct{}) []int64 {
+	ids := maps.Keys(riders)
+	slices.Sort(ids)
+	return ids
+}
+
+// closeJournal closes and removes the journal once the world was finished
+func (w *World) closeJournal() {
+	if w.journal == nil {
+		return
+	}
+	w.journal.Close()
+	w.journal = nil
+	os.Remove(filepath.Join(w.Folder, JournalFilename))
+}
+
+// journalState is the state of a world read back from its journal
+type journalState struct {
+	level      levelInfo
+	playerData map[string]any
+	entities   map[int64]journalEntity
+	links      map[int64][]int64
+	blockNBTs  map[world.ChunkPos]map[cube.Pos]DummyBlock
+	maps       map[int64]*Map
+}
+
+func readJournal(folder string) (*journalState, error) {
+	f, err := os.Open(filepath.Join(folder, JournalFilename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	s := &journalState{
+		entities:  make(map[int64]journalEntity),
+		links:     make(map[int64][]int64),
+		blockNBTs: make(map[world.ChunkPos]map[cube.Pos]DummyBlock),
+		maps:      make(map[int64]*Map),
+	}
+	for {
+		var hdr [5]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return s, nil
+			}
+			// the last record was only partly written
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return s, nil
+			}
+			return nil, err
+		}
+		data := make([]byte, binary.LittleEndian.Uint32(hdr[1:]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+				return s, nil
+			}
+			return nil, err
+		}
+		if err := s.apply(journalRecordType(hdr[0]), data); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *journalState) apply(t journalRecordType, data []byte) error {
+	unmarshal := func(v any) error {
+		return nbt.UnmarshalEncoding(data, v, nbt.LittleEndian)
+	}
+	switch t {
+	case journalRecordLevel:
+		return unmarshal(&s.level)
+	case journalRecordPlayerData:
+		s.playerData = nil
+		return unmarshal(&s.playerData)
+	case journalRecordEntity:
+		var e journalEntity
+		if err := unmarshal(&e); err != nil {
+			return err
+		}
+		s.entities[e.RuntimeID] = e
+	case journalRecordEntityLinks:
+		var l journalEntityLinks
+		if err := unmarshal(&l); err != nil {
+			return err
+		}
+		s.links[l.UniqueID] = l.Riders
+	case journalRecordBlockNBT:
+		var b journalBlockNBT
+		if err := unmarshal(&b); err != nil {
+			return err
+		}
+		blocks := make(map[cube.Pos]DummyBlock, len(b.Blocks))
+		for _, jb := range b.Blocks {
+			blocks[cube.Pos{int(jb.X), int(jb.Y), int(jb.Z)}] = DummyBlock{ID: jb.ID, NBT: jb.NBT}
+		}
+		s.blockNBTs[world.ChunkPos{b.X, b.Z}] = blocks
+	case journalRecordMap:
+		m := &Map{}
+		if err := unmarshal(m); err != nil {
+			return err
+		}
+		s.maps[m.MapID] = m
+	default:
+		return fmt.Errorf("unknown journal record %d", t)
+	}
+	return nil
+}
@@ -0,0 +1,454 @@
+package worldstate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/chunk"
+	"github.com/df-mc/dragonfly/server/world/mcdb"
+	"github.com/df-mc/goleveldb/leveldb"
+	"github.com/df-mc/goleveldb/leveldb/opt"
+	"github.com/sandertv/gophertunnel/minecraft/nbt"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
+)
+
+// ProcessWorld gives access to the blocks, entities and block entities of a world before it is written,
+// so they can be changed by post processing. Entities and block entities are in the form they are stored on disk.
+type ProcessWorld struct {
+	provider *mcdb.DB
+	dim      world.Dimension
+	r        cube.Range
+	chunks   []world.ChunkPos
+
+	entities  []map[string]any
+	blockNBTs map[world.ChunkPos]map[cube.Pos]DummyBlock
+
+	// chunks loaded by Block and SetBlock
+	cache map[world.ChunkPos]*chunk.Chunk
+	dirty map[world.ChunkPos]bool
+
+	// keys of the entities and block entities that were read from the db, only for worlds opened from disk
+	oldKeys [][]byte
+}
+
+func newProcessWorld(provider *mcdb.DB, dim world.Dimension, r cube.Range, chunks []world.ChunkPos, chunkEntities map[world.ChunkPos][]world.Entity, blockNBTs map[world.ChunkPos]map[cube.Pos]DummyBlock) *ProcessWorld {
+	p := &ProcessWorld{
+		provider:  provider,
+		dim:       dim,
+		r:         r,
+		chunks:    chunks,
+		blockNBTs: blockNBTs,
+		cache:     make(map[world.ChunkPos]*chunk.Chunk),
+		dirty:     make(map[world.ChunkPos]bool),
+	}
+	for _, entities := range chunkEntities {
+		for _, e := range entities {
+			se, ok := e.(serverEntity)
+			if !ok {
+				continue
+			}
+			// a copy, the entity is still used when the world keeps going
+			m := make(map[string]any, len(se.EntityType.NBT)+1)
+			maps.Copy(m, se.EntityType.NBT)
+			m["identifier"] = se.EntityType.Encoded
+			p.entities = append(p.entities, m)
+		}
+	}
+	return p
+}
+
+// Chunks returns the positions of all chunks in the world.
+func (p *ProcessWorld) Chunks() []world.ChunkPos {
+	return p.chunks
+}
+
+func (p *ProcessWorld) chunk(cp world.ChunkPos) (*chunk.Chunk, bool) {
+	if ch, ok := p.cache[cp]; ok {
+		return ch, true
+	}
+	col, err := p.provider.LoadColumn(cp, p.dim)
+	if err != nil {
+		if !errors.Is(err, leveldb.ErrNotFound) {
+			logrus.Warnf("loading chunk %v: %s", cp, err)
+		}
+		return nil, false
+	}
+	p.cache[cp] = col.Chunk
+	return col.Chunk, true
+}
+
+// Block returns the name and properties of the block at pos.
+func (p *ProcessWorld) Block(pos cube.Pos) (string, map[string]any, bool) {
+	if pos.OutOfBounds(p.r) {
+		return "", nil, false
+	}
+	ch, ok := p.chunk(world.ChunkPos{int32(pos[0] >> 4), int32(pos[2] >> 4)})
+	if !ok {
+		return "", nil, false
+	}
+	b, ok := world.BlockByRuntimeID(ch.Block(uint8(pos[0]&15), int16(pos[1]), uint8(pos[2]&15), 0))
+	if !ok {
+		return "", nil, false
+	}
+	name, properties := b.EncodeBlock()
+	return name, properties, true
+}
+
+// SetBlock replaces the block at pos, returns false if the block doesn't exist or the chunk wasn't saved.
+func (p *ProcessWorld) SetBlock(pos cube.Pos, name string, properties map[string]any) bool {
+	if pos.OutOfBounds(p.r) {
+		return false
+	}
+	b, ok := world.BlockByName(name, properties)
+	if !ok {
+		return false
+	}
+	cp := world.ChunkPos{int32(pos[0] >> 4), int32(pos[2] >> 4)}
+	ch, ok := p.chunk(cp)
+	if !ok {
+		return false
+	}
+	ch.SetBlock(uint8(pos[0]&15), int16(pos[1]), uint8(pos[2]&15), 0, world.BlockRuntimeID(b))
+	p.dirty[cp] = true
+	return true
+}
+
+// ReplaceBlocks calls replace once for every different block state in the world, every block it returns true for
+// is replaced with the block returned. The number of blocks replaced is returned.
+func (p *ProcessWorld) ReplaceBlocks(replace func(name string, properties map[string]any) (string, map[string]any, bool)) (int, error) {
+	replacements := make(map[uint32]uint32)
+	replacementFor := func(rid uint32) uint32 {
+		if r, ok := replacements[rid]; ok {
+			return r
+		}
+		replacements[rid] = rid
+		b, ok := world.BlockByRuntimeID(rid)
+		if !ok {
+			return rid
+		}
+		name, properties, ok := replace(b.EncodeBlock())
+		if !ok {
+			return rid
+		}
+		nb, ok := world.BlockByName(name, properties)
+		if !ok {
+			logrus.Warnf("replace blocks: unknown block %s %v", name, properties)
+			return rid
+		}
+		replacements[rid] = world.BlockRuntimeID(nb)
+		return replacements[rid]
+	}
+
+	count := 0
+	for _, cp := range p.chunks {
+		_, cached := p.cache[cp]
+		ch, ok := p.chunk(cp)
+		if !ok {
+			continue
+		}
+		changed := false
+		for i, sub := range ch.Sub() {
+			if sub.Empty() {
+				continue
+			}
+			baseY := p.r.Min() + i<<4
+			for layer := range sub.Layers() {
+				for x := uint8(0); x < 16; x++ {
+					for z := uint8(0); z < 16; z++ {
+						for y := 0; y < 16; y++ {
+							rid := ch.Block(x, int16(baseY+y), z, uint8(layer))
+							if r := replacementFor(rid); r != rid {
+								ch.SetBlock(x, int16(baseY+y), z, uint8(layer), r)
+								changed = true
+								count++
+							}
+						}
+					}
+				}
+			}
+		}
+		if changed {
+			p.dirty[cp] = true
+		}
+		// dont keep every chunk of the world in memory
+		if !cached {
+			if err := p.storeChunk(cp); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, nil
+}
+
+// ForEachEntity calls fn with the nbt of every entity, it can be modified. Entities fn returns false for are removed.
+func (p *ProcessWorld) ForEachEntity(fn func(nbt map[string]any) (keep bool)) {
+	kept := p.entities[:0]
+	for _, e := range p.entities {
+		if fn(e) {
+			kept = append(kept, e)
+		}
+	}
+	p.entities = kept
+}
+
+// ForEachBlockEntity calls fn with the nbt of every block entity, it can be modified. Block entities fn returns
+// false for are removed.
+func (p *ProcessWorld) ForEachBlockEntity(fn func(pos cube.Pos, nbt map[string]any) (keep bool)) {
+	for _, blocks := range p.blockNBTs {
+		for pos, b := range blocks {
+			if !fn(pos, b.NBT) {
+				delete(blocks, pos)
+			}
+		}
+	}
+}
+
+func (p *ProcessWorld) storeChunk(cp world.ChunkPos) error {
+	ch := p.cache[cp]
+	delete(p.cache, cp)
+	if !p.dirty[cp] {
+		return nil
+	}
+	delete(p.dirty, cp)
+	return p.provider.StoreColumn(cp, p.dim, &world.Column{Chunk: ch})
+}
+
+// flush writes all chunks that were changed
+func (p *ProcessWorld) flush() error {
+	for _, cp := range maps.Keys(p.cache) {
+		if err := p.storeChunk(cp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entitiesByChunk groups the entities by the chunk they are in now
+func (p *ProcessWorld) entitiesByChunk() map[world.ChunkPos][]world.Entity {
+	chunkEntities := make(map[world.ChunkPos][]world.Entity)
+	for _, m := range p.entities {
+		pos, ok := nbtVec3(m["Pos"])
+		if !ok {
+			continue
+		}
+		identifier, _ := m["identifier"].(string)
+		cp := world.ChunkPos{int32(pos[0]) >> 4, int32(pos[2]) >> 4}
+		chunkEntities[cp] = append(chunkEntities[cp], serverEntity{
+			EntityType: serverEntityType{
+				Encoded: identifier,
+				NBT:     m,
+			},
+		})
+	}
+	return chunkEntities
+}
+
+func nbtVec3(v any) ([3]float32, bool) {
+	var out [3]float32
+	switch v := v.(type) {
+	case []float32:
+		if len(v) != 3 {
+			return out, false
+		}
+		copy(out[:], v)
+	case []any:
+		if len(v) != 3 {
+			return out, false
+		}
+		for i, f := range v {
+			out[i] = nbtFloat32(f, 0)
+		}
+	default:
+		return out, false
+	}
+	return out, true
+}
+
+// OpenProcessWorld opens a world folder from disk for post processing, Close has to be called to write the changes.
+func OpenProcessWorld(folder string) (*ProcessWorld, error) {
+	provider, err := mcdb.Config{
+		Log:         logrus.StandardLogger(),
+		Compression: opt.DefaultCompression,
+	}.Open(folder)
+	if err != nil {
+		return nil, err
+	}
+	ldb := provider.LDB()
+
+	var dim world.Dimension = world.Overworld
+	r := dim.Range()
+	if data, err := ldb.Get([]byte("bedrocktool_dimension"), nil); err == nil {
+		var dm dimensionMetadata
+		if err := nbt.UnmarshalEncoding(data, &dm, nbt.LittleEndian); err == nil {
+			if d, ok := world.DimensionByID(int(dm.ID)); ok {
+				dim = d
+				r = dimensionRange(dm.definition())
+			}
+		}
+	}
+	dimID, _ := world.DimensionID(dim)
+
+	p := &ProcessWorld{
+		provider:  provider,
+		dim:       dim,
+		r:         r,
+		blockNBTs: make(map[world.ChunkPos]map[cube.Pos]DummyBlock),
+		cache:     make(map[world.ChunkPos]*chunk.Chunk),
+		dirty:     make(map[world.ChunkPos]bool),
+	}
+
+	if err := p.readDB(ldb, int32(dimID)); err != nil {
+		provider.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+const (
+	keyVersion       = 0x2c
+	keyVersionOld    = 0x76
+	keyBlockEntities = 0x31
+	keyEntities      = 0x32
+)
+
+// readDB reads the chunk positions, entities and block entities of a dimension from the db
+func (p *ProcessWorld) readDB(ldb *leveldb.DB, dimID int32) error {
+	it := ldb.NewIterator(nil, nil)
+	defer it.Release()
+
+	var entityIndexes [][]byte
+	for it.Next() {
+		key := it.Key()
+		if bytes.HasPrefix(key, []byte("digp")) {
+			if _, ok := parseChunkKey(key[4:], dimID); ok {
+				entityIndexes = append(entityIndexes, bytes.Clone(key))
+			}
+			continue
+		}
+		if len(key) != 9 && len(key) != 13 {
+			continue
+		}
+		cp, ok := parseChunkKey(key[:len(key)-1], dimID)
+		if !ok {
+			continue
+		}
+		switch key[len(key)-1] {
+		case keyVersion, keyVersionOld:
+			p.chunks = append(p.chunks, cp)
+		case keyBlockEntities:
+			p.oldKeys = append(p.oldKeys, bytes.Clone(key))
+			blocks := make(map[cube.Pos]DummyBlock)
+			err := readNBTList(it.Value(), func(m map[string]any) {
+				pos := cube.Pos{int(nbtInt32(m["x"], 0)), int(nbtInt32(m["y"], 0)), int(nbtInt32(m["z"], 0))}
+				id, _ := m["id"].(string)
+				blocks[pos] = DummyBlock{ID: id, NBT: m}
+			})
+			if err != nil {
+				return err
+			}
+			p.blockNBTs[cp] = blocks
+		case keyEntities:
+			p.oldKeys = append(p.oldKeys, bytes.Clone(key))
+			err := readNBTList(it.Value(), func(m map[string]any) {
+				p.entities = append(p.entities, m)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+
+	// entities are stored by their unique id since 1.18.30, digp lists the ids in a chunk
+	for _, key := range entityIndexes {
+		p.oldKeys = append(p.oldKeys, key)
+		ids, err := ldb.Get(key, nil)
+		if err != nil {
+			return err
+		}
+		for i := 0; i+8 <= len(ids); i += 8 {
+			actorKey := append([]byte("actorprefix"), ids[i:i+8]...)
+			data, err := ldb.Get(actorKey, nil)
+			if err != nil {
+				if errors.Is(err, leveldb.ErrNotFound) {
+					continue
+				}
+				return err
+			}
+			p.oldKeys = append(p.oldKeys, actorKey)
+			var m map[string]any
+			if err := nbt.UnmarshalEncoding(data, &m, nbt.LittleEndian); err != nil {
+				return err
+			}
+			p.entities = append(p.entities, m)
+		}
+	}
+	return nil
+}
+
+// parseChunkKey reads the position from a chunk key, false if it is not in the dimension
+func parseChunkKey(key []byte, dimID int32) (world.ChunkPos, bool) {
+	if len(key) != 8 && len(key) != 12 {
+		return world.ChunkPos{}, false
+	}
+	var keyDim int32
+	if len(key) == 12 {
+		keyDim = int32(binary.LittleEndian.Uint32(key[8:]))
+	}
+	if keyDim != dimID {
+		return world.ChunkPos{}, false
+	}
+	return world.ChunkPos{
+		int32(binary.LittleEndian.Uint32(key[0:])),
+		int32(binary.LittleEndian.Uint32(key[4:])),
+	}, true
+}
+
+// readNBTList decodes the concatenated compounds chunks store their entities and block entities as
+func readNBTList(data []byte, fn func(m map[string]any)) error {
+	// the decoder doesnt return io.EOF at the end, so stop once everything was read
+	buf := bytes.NewReader(data)
+	dec := nbt.NewDecoderWithEncoding(buf, nbt.LittleEndian)
+	for buf.Len() > 0 {
+		var m map[string]any
+		if err := dec.Decode(&m); err != nil {
+			return err
+		}
+		fn(m)
+	}
+	return nil
+}
+
+// Close writes all changes to a world opened with OpenProcessWorld and closes it.
+func (p *ProcessWorld) Close() error {
+	if err := p.flush(); err != nil {
+		p.provider.Close()
+		return err
+	}
+
+	// the entities and block entities are written again from what is in memory
+	batch := new(leveldb.Batch)
+	for _, key := range p.oldKeys {
+		batch.Delete(key)
+	}
+	if err := p.provider.LDB().Write(batch, nil); err != nil {
+		p.provider.Close()
+		return err
+	}
+	if err := storeEntities(p.provider, p.dim, p.entitiesByChunk(), p.blockNBTs); err != nil {
+		p.provider.Close()
+		return err
+	}
+	return p.provider.Close()
+}
+
+// Discard closes a world opened with OpenProcessWorld without writing the changes that are still in memory.
+func (p *ProcessWorld) Discard() error {
+	return p.provider.Close()
+}
@@ -0,0 +1,162 @@
+package worldstate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/goleveldb/leveldb"
+	"github.com/sandertv/gophertunnel/minecraft/nbt"
+)
+
+func chunkKey(x, z, dim int32, tag byte) []byte {
+	key := binary.LittleEndian.AppendUint32(nil, uint32(x))
+	key = binary.LittleEndian.AppendUint32(key, uint32(z))
+	if dim != 0 {
+		key = binary.LittleEndian.AppendUint32(key, uint32(dim))
+	}
+	if tag != 0 {
+		key = append(key, tag)
+	}
+	return key
+}
+
+func encodeNBTList(t *testing.T, compounds ...map[string]any) []byte {
+	var buf bytes.Buffer
+	enc := nbt.NewEncoderWithEncoding(&buf, nbt.LittleEndian)
+	for _, m := range compounds {
+		if err := enc.Encode(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestParseChunkKey(t *testing.T) {
+	tests := []struct {
+		key  []byte
+		dim  int32
+		want world.ChunkPos
+		ok   bool
+	}{
+		{key: chunkKey(1, -2, 0, 0), dim: 0, want: world.ChunkPos{1, -2}, ok: true},
+		{key: chunkKey(3, 4, 1, 0), dim: 1, want: world.ChunkPos{3, 4}, ok: true},
+		{key: chunkKey(3, 4, 1, 0), dim: 0},
+		{key: chunkKey(3, 4, 0, 0), dim: 1},
+		{key: []byte("short"), dim: 0},
+	}
+	for _, tt := range tests {
+		got, ok := parseChunkKey(tt.key, tt.dim)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseChunkKey(%x, %d) = %v, %v, want %v, %v", tt.key, tt.dim, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// TestReadDB writes the keys of a small world the way bedrock lays them out and reads them back
+func TestReadDB(t *testing.T) {
+	ldb, err := leveldb.OpenFile(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ldb.Close()
+
+	put := func(key, value []byte) {
+		if err := ldb.Put(key, value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	put(chunkKey(1, -2, 0, keyVersion), []byte{40})
+	put(chunkKey(5, 5, 0, keyVersionOld), []byte{10})
+	// the nether is not read when opening the overworld
+	put(chunkKey(7, 7, 1, keyVersion), []byte{40})
+	put(chunkKey(7, 7, 1, keyEntities), encodeNBTList(t, map[string]any{"identifier": "minecraft:ghast"}))
+
+	put(chunkKey(1, -2, 0, keyBlockEntities), encodeNBTList(t,
+		map[string]any{"id": "Sign", "x": int32(16), "y": int32(64), "z": int32(-32)},
+		map[string]any{"id": "Chest", "x": int32(17), "y": int32(-10), "z": int32(-31)},
+	))
+	// entities from before 1.18.30
+	put(chunkKey(1, -2, 0, keyEntities), encodeNBTList(t, map[string]any{"identifier": "minecraft:pig"}))
+
+	// newer entities are listed by id in digp and stored under actorprefix
+	ids := binary.LittleEndian.AppendUint64(nil, 1)
+	ids = binary.LittleEndian.AppendUint64(ids, 2)
+	digpKey := append([]byte("digp"), chunkKey(1, -2, 0, 0)...)
+	put(digpKey, ids)
+	put(append([]byte("actorprefix"), ids[:8]...), encodeNBTList(t, map[string]any{"identifier": "minecraft:cow"}))
+	// the second id has no actor, it is skipped
+
+	p := &ProcessWorld{blockNBTs: make(map[world.ChunkPos]map[cube.Pos]DummyBlock)}
+	if err := p.readDB(ldb, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	slices.SortFunc(p.chunks, func(a, b world.ChunkPos) int { return int(a[0] - b[0]) })
+	if want := []world.ChunkPos{{1, -2}, {5, 5}}; !slices.Equal(p.chunks, want) {
+		t.Errorf("chunks = %v, want %v", p.chunks, want)
+	}
+
+	blocks := p.blockNBTs[world.ChunkPos{1, -2}]
+	if len(p.blockNBTs) != 1 || len(blocks) != 2 {
+		t.Fatalf("block entities = %v", p.blockNBTs)
+	}
+	if b := blocks[cube.Pos{16, 64, -32}]; b.ID != "Sign" {
+		t.Errorf("sign = %+v", b)
+	}
+	if b := blocks[cube.Pos{17, -10, -31}]; b.ID != "Chest" {
+		t.Errorf("chest = %+v", b)
+	}
+
+	var identifiers []string
+	for _, e := range p.entities {
+		identifiers = append(identifiers, e["identifier"].(string))
+	}
+	slices.Sort(identifiers)
+	if want := []string{"minecraft:cow", "minecraft:pig"}; !slices.Equal(identifiers, want) {
+		t.Errorf("entities = %v, want %v", identifiers, want)
+	}
+
+	// everything that is written again on close has to be deleted first
+	wantKeys := [][]byte{
+		chunkKey(1, -2, 0, keyBlockEntities),
+		chunkKey(1, -2, 0, keyEntities),
+		digpKey,
+		append([]byte("actorprefix"), ids[:8]...),
+	}
+	for _, key := range wantKeys {
+		if !slices.ContainsFunc(p.oldKeys, func(k []byte) bool { return bytes.Equal(k, key) }) {
+			t.Errorf("old keys are missing %q", key)
+		}
+	}
+	if len(p.oldKeys) != len(wantKeys) {
+		t.Errorf("%d old keys, want %d", len(p.oldKeys), len(wantKeys))
+	}
+}
+
+func TestNewProcessWorldCopiesEntityNBT(t *testing.T) {
+	original := map[string]any{"Pos": []float32{1, 2, 3}}
+	chunkEntities := map[world.ChunkPos][]world.Entity{
+		{0, 0}: {
+			serverEntity{EntityType: serverEntityType{Encoded: "minecraft:pig", NBT: original}},
+			serverEntity{EntityType: serverEntityType{Encoded: "minecraft:cow"}},
+		},
+	}
+	p := newProcessWorld(nil, world.Overworld, world.Overworld.Range(), nil, chunkEntities, nil)
+
+	if _, ok := original["identifier"]; ok {
+		t.Error("the nbt of the entity was changed")
+	}
+	if len(p.entities) != 2 {
+		t.Fatalf("%d entities, want 2", len(p.entities))
+	}
+	for _, e := range p.entities {
+		if e["identifier"] == nil {
+			t.Errorf("entity without identifier %v", e)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package worldstate
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/mcdb"
+	"github.com/df-mc/goleveldb/leveldb/opt"
+	"github.com/sirupsen/logrus"
+)
+
+// HasJournal returns true if the world folder contains a journal of a capture that was not finished.
+func HasJournal(folder string) bool {
+	_, err := os.Stat(filepath.Join(folder, JournalFilename))
+	return err == nil
+}
+
+// Recover finishes a world folder whose capture was interrupted, using the journal that was written next to the
+// world db. The same steps as Finish are run, so the folder is a complete world afterwards. The name of the world is
+// returned.
+func Recover(folder string, excludedMobs []string) (string, error) {
+	s, err := readJournal(folder)
+	if err != nil {
+		return "", err
+	}
+
+	dim, ok := world.DimensionByID(int(s.level.Dimension.ID))
+	if !ok {
+		dim = world.Overworld
+	}
+
+	provider, err := mcdb.Config{
+		Log:         logrus.StandardLogger(),
+		Compression: opt.DefaultCompression,
+	}.Open(folder)
+	if err != nil {
+		return "", err
+	}
+
+	chunkEntities := make(map[world.ChunkPos][]world.Entity)
+	for _, e := range s.entities {
+		if isExcluded(excludedMobs, e.Type) || len(e.Position) != 3 {
+			continue
+		}
+		if e.NBT == nil {
+			e.NBT = make(map[string]any)
+		}
+		if links := s.links[e.UniqueID]; len(links) > 0 {
+			e.NBT["LinksTag"] = linksTag(links)
+		}
+		cp := world.ChunkPos{int32(e.Position[0]) >> 4, int32(e.Position[2]) >> 4}
+		chunkEntities[cp] = append(chunkEntities[cp], serverEntity{
+			EntityType: serverEntityType{
+				Encoded: e.Type,
+				NBT:     e.NBT,
+			},
+		})
+	}
+
+	err = writeWorld(provider, dim, s.level, chunkEntities, diskBlockNBTs(s.blockNBTs), s.maps, s.playerData)
+	if err != nil {
+		provider.Close()
+		return "", err
+	}
+	return s.level.Name, os.Remove(filepath.Join(folder, JournalFilename))
+}
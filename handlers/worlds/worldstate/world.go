@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -35,14 +36,24 @@ type worldStateInterface interface {
 type World struct {
 	// called when a chunk is added
 	ChunkFunc func(world.ChunkPos, *chunk.Chunk)
+	// used to keep the player data and level settings in the recovery journal
+	PlayerData func() map[string]any
+	GameData   func() minecraft.GameData
+	// whether the world needs the experiments for custom blocks and items turned on
+	Experiments func() bool
+	// called before the world is written, can change its blocks, entities and block entities
+	PostProcess func(pw *ProcessWorld) error
 
 	dimension            world.Dimension
+	dimensionName        string
+	dimensionGenerator   int32
 	dimRange             cube.Range
 	dimensionDefinitions map[int]protocol.DimensionDefinition
 	StoredChunks         map[world.ChunkPos]bool
 
 	memState *worldStateDefer
 	provider *mcdb.DB
+	journal  *journal
 	opened   bool
 	// state to be used while paused
 	paused      bool
@@ -81,6 +92,7 @@ type Map struct {
 
 func New(cf func(world.ChunkPos, *chunk.Chunk), dimensionDefinitions map[int]protocol.DimensionDefinition) (*World, error) {
 	w := &World{
+		ChunkFunc:            cf,
 		StoredChunks:         make(map[world.ChunkPos]bool),
 		dimensionDefinitions: dimensionDefinitions,
 		finish:               make(chan struct{}),
@@ -151,15 +163,22 @@ func (w *World) Dimension() world.Dimension {
 	return w.dimension
 }
 
+// DimensionName returns the name of the dimension definition this world uses
+func (w *World) DimensionName() string {
+	return w.dimensionName
+}
+
 func (w *World) SetDimension(dim world.Dimension) {
 	w.dimension = dim
 
-	w.dimRange = dim.Range()
 	id, _ := world.DimensionID(dim)
+	w.dimRange = dim.Range()
+	w.dimensionName = vanillaDimensionNames[id]
+	w.dimensionGenerator = 0
 	if d, ok := w.dimensionDefinitions[id]; ok {
-		w.dimRange = cube.Range{
-			int(d.Range[1]), int(d.Range[0]) - 1,
-		}
+		w.dimRange = dimensionRange(d)
+		w.dimensionName = d.Name
+		w.dimensionGenerator = d.Generator
 	}
 }
 
@@ -185,7 +204,10 @@ func (w *World) StoreChunk(pos world.ChunkPos, ch *chunk.Chunk, blockNBT map[cub
 func (w *World) LoadChunk(pos world.ChunkPos) (*chunk.Chunk, bool, error) {
 	w.l.Lock()
 	defer w.l.Unlock()
+	return w.loadChunk(pos)
+}
 
+func (w *World) loadChunk(pos world.ChunkPos) (*chunk.Chunk, bool, error) {
 	if w.paused {
 		ch, ok := w.pausedState.chunks[pos]
 		if ok {
@@ -212,6 +234,54 @@ func (w *World) LoadChunk(pos world.ChunkPos) (*chunk.Chunk, bool, error) {
 	return nil, false, nil
 }
 
+// Block returns the block at pos, false if the chunk it is in wasn't captured.
+func (w *World) Block(pos cube.Pos) (world.Block, bool) {
+	w.l.Lock()
+	defer w.l.Unlock()
+	if pos.OutOfBounds(w.dimRange) {
+		return nil, false
+	}
+	ch, ok, err := w.loadChunk(world.ChunkPos{int32(pos[0] >> 4), int32(pos[2] >> 4)})
+	if err != nil || !ok {
+		return nil, false
+	}
+	rid := ch.Block(uint8(pos[0]&15), int16(pos[1]), uint8(pos[2]&15), 0)
+	return world.BlockByRuntimeID(rid)
+}
+
+// SetBlock replaces the block at pos, false if the chunk it is in wasn't captured.
+func (w *World) SetBlock(pos cube.Pos, b world.Block) bool {
+	w.l.Lock()
+	if pos.OutOfBounds(w.dimRange) {
+		w.l.Unlock()
+		return false
+	}
+	cp := world.ChunkPos{int32(pos[0] >> 4), int32(pos[2] >> 4)}
+	ch, ok, err := w.loadChunk(cp)
+	if err != nil || !ok {
+		w.l.Unlock()
+		return false
+	}
+	ch.SetBlock(uint8(pos[0]&15), int16(pos[1]), uint8(pos[2]&15), 0, world.BlockRuntimeID(b))
+	w.l.Unlock()
+
+	if w.ChunkFunc != nil {
+		w.ChunkFunc(cp, ch)
+	}
+	return true
+}
+
+// Entities returns all entities that have been captured
+func (w *World) Entities() []*EntityState {
+	w.l.Lock()
+	defer w.l.Unlock()
+	entities := maps.Values(w.memState.entities)
+	if w.paused {
+		entities = append(entities, maps.Values(w.pausedState.entities)...)
+	}
+	return entities
+}
+
 func (w *World) SetBlockNBT(pos cube.Pos, nbt map[string]any, merge bool) {
 	w.l.Lock()
 	defer w.l.Unlock()
@@ -305,7 +375,18 @@ func (w *World) Open(name string, folder string, deferred bool) {
 				return
 			case <-t.C:
 				w.l.Lock()
+				select {
+				case <-w.finish:
+					w.l.Unlock()
+					return
+				default:
+				}
 				w.storeMemToProvider()
+				if w.provider != nil {
+					if err := w.writeJournal(); err != nil {
+						logrus.Errorf("writeJournal %s", err)
+					}
+				}
 				w.l.Unlock()
 			}
 		}
@@ -319,10 +400,15 @@ func (w *World) Rename(name, folder string) error {
 
 	os.RemoveAll(folder)
 	if w.provider != nil {
+		if w.journal != nil {
+			w.journal.Close()
+			w.journal = nil
+		}
 		err := w.provider.Close()
 		if err != nil {
 			return err
 		}
+		os.MkdirAll(filepath.Dir(folder), 0o777)
 		err = os.Rename(w.Folder, folder)
 		if err != nil {
 			return err
@@ -330,7 +416,7 @@ func (w *World) Rename(name, folder string) error {
 		w.provider, w.err = mcdb.Config{
 			Log:         logrus.StandardLogger(),
 			Compression: opt.DefaultCompression,
-		}.Open(w.Folder)
+		}.Open(folder)
 		if w.err != nil {
 			return w.err
 		}
@@ -340,6 +426,89 @@ func (w *World) Rename(name, folder string) error {
 	return nil
 }
 
+// levelInfo is everything besides chunks and entities needed to write a finished world
+type levelInfo struct {
+	Name         string
+	Dimension    dimensionMetadata
+	VoidGen      bool
+	Spawn        []int32
+	Time         int64
+	ElapsedTicks int64
+	CurrentTick  int64
+	Seed         int64
+	GameRules    map[string]any
+	Experiments  bool
+}
+
+func (w *World) levelInfo() levelInfo {
+	info := levelInfo{
+		Name:         w.Name,
+		Dimension:    w.dimensionMetadata(),
+		VoidGen:      w.VoidGen,
+		Spawn:        []int32{0, 0, 0},
+		Time:         int64(w.time),
+		ElapsedTicks: int64(time.Since(w.timeSync)/time.Millisecond) / 50,
+		GameRules:    map[string]any{},
+	}
+	if w.GameData != nil {
+		gd := w.GameData()
+		info.Seed = int64(gd.WorldSeed)
+		info.CurrentTick = gd.Time
+		info.GameRules = gameRulesMap(gd.GameRules)
+	}
+	if w.Experiments != nil {
+		info.Experiments = w.Experiments()
+	}
+	return info
+}
+
+// gameRulesMap converts the gamerules to values that can be stored as nbt
+func gameRulesMap(rules []protocol.GameRule) map[string]any {
+	m := make(map[string]any, len(rules))
+	for _, gr := range rules {
+		switch v := gr.Value.(type) {
+		case bool:
+			m[gr.Name] = boolByte(v)
+		case uint32:
+			m[gr.Name] = int32(v)
+		default:
+			m[gr.Name] = v
+		}
+	}
+	return m
+}
+
+func gameRuleBool(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case byte:
+		return v != 0
+	}
+	return false
+}
+
+func gameRuleInt(v any) int32 {
+	switch v := v.(type) {
+	case uint32:
+		return int32(v)
+	case int32:
+		return v
+	}
+	return 0
+}
+
+func isExcluded(excludedMobs []string, entityType string) bool {
+	for _, ex := range excludedMobs {
+		if ok, err := path.Match(ex, entityType); ok {
+			return true
+		} else if err != nil {
+			logrus.Warn(err)
+		}
+	}
+	return false
+}
+
 func (w *World) Finish(playerData map[string]any, excludedMobs []string, withPlayers bool, spawn cube.Pos, gd minecraft.GameData, bp *behaviourpack.Pack) error {
 	w.l.Lock()
 	defer w.l.Unlock()
@@ -362,48 +531,102 @@ func (w *World) Finish(playerData map[string]any, excludedMobs []string, withPla
 
 	chunkEntities := make(map[world.ChunkPos][]world.Entity)
 	for _, es := range w.memState.entities {
-		var ignore bool
-		for _, ex := range excludedMobs {
-			if ok, err := path.Match(ex, es.EntityType); ok {
-				logrus.Debugf("Excluding: %s %v", es.EntityType, es.Position)
-				ignore = true
-				break
-			} else if err != nil {
-				logrus.Warn(err)
-			}
+		if isExcluded(excludedMobs, es.EntityType) {
+			logrus.Debugf("Excluding: %s %v", es.EntityType, es.Position)
+			continue
+		}
+		cp := world.ChunkPos{int32(es.Position.X()) >> 4, int32(es.Position.Z()) >> 4}
+		links := maps.Keys(w.memState.entityLinks[es.UniqueID])
+		chunkEntities[cp] = append(chunkEntities[cp], es.ToServerEntity(links))
+	}
+
+	info := w.levelInfo()
+	info.Spawn = []int32{int32(spawn.X()), int32(spawn.Y()), int32(spawn.Z())}
+	info.Seed = int64(gd.WorldSeed)
+	info.CurrentTick = gd.Time
+	info.GameRules = gameRulesMap(gd.GameRules)
+	info.Experiments = bp.HasContent()
+
+	blockNBTs := diskBlockNBTs(w.memState.blockNBTs)
+	if w.PostProcess != nil {
+		pw := newProcessWorld(w.provider, w.dimension, w.dimRange, maps.Keys(w.StoredChunks), chunkEntities, blockNBTs)
+		if err := w.PostProcess(pw); err != nil {
+			logrus.Errorf("post processing: %s", err)
 		}
-		if !ignore {
-			cp := world.ChunkPos{int32(es.Position.X()) >> 4, int32(es.Position.Z()) >> 4}
-			links := maps.Keys(w.memState.entityLinks[es.UniqueID])
-			chunkEntities[cp] = append(chunkEntities[cp], es.ToServerEntity(links))
+		if err := pw.flush(); err != nil {
+			return err
 		}
+		chunkEntities = pw.entitiesByChunk()
 	}
 
+	err = writeWorld(w.provider, w.dimension, info, chunkEntities, blockNBTs, w.memState.maps, playerData)
+	if err != nil {
+		return err
+	}
+	w.closeJournal()
+	return nil
+}
+
+// diskBlockNBTs converts the block entities received from the server to the form they are stored in
+func diskBlockNBTs(blockNBTs map[world.ChunkPos]map[cube.Pos]DummyBlock) map[world.ChunkPos]map[cube.Pos]DummyBlock {
+	out := make(map[world.ChunkPos]map[cube.Pos]DummyBlock, len(blockNBTs))
+	for cp, blocks := range blockNBTs {
+		converted := make(map[cube.Pos]DummyBlock, len(blocks))
+		for pos, b := range blocks {
+			if b.ID == "" {
+				continue
+			}
+			converted[pos] = DummyBlock{
+				ID:  b.ID,
+				NBT: convertBlockEntity(b.NBT),
+			}
+		}
+		out[cp] = converted
+	}
+	return out
+}
+
+// storeEntities writes the entities and block entities of every chunk to the provider
+func storeEntities(provider *mcdb.DB, dim world.Dimension, chunkEntities map[world.ChunkPos][]world.Entity, blockNBTs map[world.ChunkPos]map[cube.Pos]DummyBlock) error {
 	for cp, v := range chunkEntities {
-		err := w.provider.StoreEntities(cp, w.dimension, v)
+		err := provider.StoreEntities(cp, dim, v)
 		if err != nil {
 			logrus.Error(err)
 		}
 	}
 
-	for cp, v := range w.memState.blockNBTs {
+	for cp, v := range blockNBTs {
 		vv := make(map[cube.Pos]world.Block, len(v))
 		for p, db := range v {
-			vv[p] = &db
+			vv[p] = &DummyBlock{
+				ID:  db.ID,
+				NBT: db.NBT,
+			}
 		}
-		err := w.provider.StoreBlockNBTs(cp, w.dimension, vv)
+		err := provider.StoreBlockNBTs(cp, dim, vv)
 		if err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	err = w.provider.SaveLocalPlayerData(playerData)
-	if err != nil {
+// writeWorld stores everything that is kept in memory until the end to the provider, writes the level.dat and closes it.
+// the block entities have to be converted with diskBlockNBTs already.
+func writeWorld(provider *mcdb.DB, dim world.Dimension, info levelInfo, chunkEntities map[world.ChunkPos][]world.Entity, blockNBTs map[world.ChunkPos]map[cube.Pos]DummyBlock, worldMaps map[int64]*Map, playerData map[string]any) error {
+	if err := storeEntities(provider, dim, chunkEntities, blockNBTs); err != nil {
 		return err
 	}
 
-	ldb := w.provider.LDB()
-	for id, m := range w.memState.maps {
+	if playerData != nil {
+		err := provider.SaveLocalPlayerData(playerData)
+		if err != nil {
+			return err
+		}
+	}
+
+	ldb := provider.LDB()
+	for id, m := range worldMaps {
 		d, err := nbt.MarshalEncoding(m, nbt.LittleEndian)
 		if err != nil {
 			return err
@@ -414,100 +637,110 @@ func (w *World) Finish(playerData map[string]any, excludedMobs []string, withPla
 		}
 	}
 
+	dimData, err := nbt.MarshalEncoding(info.Dimension, nbt.LittleEndian)
+	if err != nil {
+		return err
+	}
+	err = ldb.Put([]byte("bedrocktool_dimension"), dimData, nil)
+	if err != nil {
+		return err
+	}
+
 	// write metadata
-	s := w.provider.Settings()
-	s.Spawn = spawn
-	s.Name = w.Name
+	s := provider.Settings()
+	if len(info.Spawn) == 3 {
+		s.Spawn = cube.Pos{int(info.Spawn[0]), int(info.Spawn[1]), int(info.Spawn[2])}
+	}
+	s.Name = info.Name
 
 	// set gamerules
-	ld := w.provider.LevelDat()
+	ld := provider.LevelDat()
 	ld.CheatsEnabled = true
-	ld.RandomSeed = int64(gd.WorldSeed)
-	for _, gr := range gd.GameRules {
-		switch gr.Name {
+	ld.RandomSeed = info.Seed
+	for name, value := range info.GameRules {
+		switch name {
 		case "commandblockoutput":
-			ld.CommandBlockOutput = gr.Value.(bool)
+			ld.CommandBlockOutput = gameRuleBool(value)
 		case "maxcommandchainlength":
-			ld.MaxCommandChainLength = int32(gr.Value.(uint32))
+			ld.MaxCommandChainLength = gameRuleInt(value)
 		case "commandblocksenabled":
-			//ld.CommandsEnabled = gr.Value.(bool)
+			//ld.CommandsEnabled = gameRuleBool(value)
 		case "dodaylightcycle":
-			ld.DoDayLightCycle = gr.Value.(bool)
+			ld.DoDayLightCycle = gameRuleBool(value)
 		case "doentitydrops":
-			ld.DoEntityDrops = gr.Value.(bool)
+			ld.DoEntityDrops = gameRuleBool(value)
 		case "dofiretick":
-			ld.DoFireTick = gr.Value.(bool)
+			ld.DoFireTick = gameRuleBool(value)
 		case "domobloot":
-			ld.DoMobLoot = gr.Value.(bool)
+			ld.DoMobLoot = gameRuleBool(value)
 		case "domobspawning":
-			ld.DoMobSpawning = gr.Value.(bool)
+			ld.DoMobSpawning = gameRuleBool(value)
 		case "dotiledrops":
-			ld.DoTileDrops = gr.Value.(bool)
+			ld.DoTileDrops = gameRuleBool(value)
 		case "doweathercycle":
-			ld.DoWeatherCycle = gr.Value.(bool)
+			ld.DoWeatherCycle = gameRuleBool(value)
 		case "drowningdamage":
-			ld.DrowningDamage = gr.Value.(bool)
+			ld.DrowningDamage = gameRuleBool(value)
 		case "doinsomnia":
-			ld.DoInsomnia = gr.Value.(bool)
+			ld.DoInsomnia = gameRuleBool(value)
 		case "falldamage":
-			ld.FallDamage = gr.Value.(bool)
+			ld.FallDamage = gameRuleBool(value)
 		case "firedamage":
-			ld.FireDamage = gr.Value.(bool)
+			ld.FireDamage = gameRuleBool(value)
 		case "keepinventory":
-			ld.KeepInventory = gr.Value.(bool)
+			ld.KeepInventory = gameRuleBool(value)
 		case "mobgriefing":
-			ld.MobGriefing = gr.Value.(bool)
+			ld.MobGriefing = gameRuleBool(value)
 		case "pvp":
-			ld.PVP = gr.Value.(bool)
+			ld.PVP = gameRuleBool(value)
 		case "showcoordinates":
-			ld.ShowCoordinates = gr.Value.(bool)
+			ld.ShowCoordinates = gameRuleBool(value)
 		case "naturalregeneration":
-			ld.NaturalRegeneration = gr.Value.(bool)
+			ld.NaturalRegeneration = gameRuleBool(value)
 		case "tntexplodes":
-			ld.TNTExplodes = gr.Value.(bool)
+			ld.TNTExplodes = gameRuleBool(value)
 		case "sendcommandfeedback":
-			ld.SendCommandFeedback = gr.Value.(bool)
+			ld.SendCommandFeedback = gameRuleBool(value)
 		case "randomtickspeed":
-			ld.RandomTickSpeed = int32(gr.Value.(uint32))
+			ld.RandomTickSpeed = gameRuleInt(value)
 		case "doimmediaterespawn":
-			ld.DoImmediateRespawn = gr.Value.(bool)
+			ld.DoImmediateRespawn = gameRuleBool(value)
 		case "showdeathmessages":
-			ld.ShowDeathMessages = gr.Value.(bool)
+			ld.ShowDeathMessages = gameRuleBool(value)
 		case "functioncommandlimit":
-			ld.FunctionCommandLimit = int32(gr.Value.(uint32))
+			ld.FunctionCommandLimit = gameRuleInt(value)
 		case "spawnradius":
-			ld.SpawnRadius = int32(gr.Value.(uint32))
+			ld.SpawnRadius = gameRuleInt(value)
 		case "showtags":
-			ld.ShowTags = gr.Value.(bool)
+			ld.ShowTags = gameRuleBool(value)
 		case "freezedamage":
-			ld.FreezeDamage = gr.Value.(bool)
+			ld.FreezeDamage = gameRuleBool(value)
 		case "respawnblocksexplode":
-			ld.RespawnBlocksExplode = gr.Value.(bool)
+			ld.RespawnBlocksExplode = gameRuleBool(value)
 		case "showbordereffect":
-			ld.ShowBorderEffect = gr.Value.(bool)
+			ld.ShowBorderEffect = gameRuleBool(value)
 		// todo
 		default:
-			logrus.Warnf(locale.Loc("unknown_gamerule", locale.Strmap{"Name": gr.Name}))
+			logrus.Warnf(locale.Loc("unknown_gamerule", locale.Strmap{"Name": name}))
 		}
 	}
 
 	// void world
-	if w.VoidGen {
+	if info.VoidGen {
 		ld.FlatWorldLayers = `{"biome_id":1,"block_layers":[{"block_data":0,"block_id":0,"count":1},{"block_data":0,"block_id":0,"count":2},{"block_data":0,"block_id":0,"count":1}],"encoding_version":3,"structure_options":null}`
 		ld.Generator = 2
 	}
 
 	ld.RandomTickSpeed = 0
-	s.CurrentTick = gd.Time
+	s.CurrentTick = info.CurrentTick
 
-	ticksSince := int64(time.Since(w.timeSync)/time.Millisecond) / 50
-	s.Time = int64(w.time)
+	s.Time = info.Time
 	if ld.DoDayLightCycle {
-		s.Time += ticksSince
+		s.Time += info.ElapsedTicks
 		s.TimeCycle = true
 	}
 
-	if bp.HasContent() {
+	if info.Experiments {
 		if ld.Experiments == nil {
 			ld.Experiments = map[string]any{}
 		}
@@ -516,6 +749,6 @@ func (w *World) Finish(playerData map[string]any, excludedMobs []string, withPla
 		ld.Experiments["saved_with_toggled_experiments"] = true
 	}
 
-	w.provider.SaveSettings(s)
-	return w.provider.Close()
+	provider.SaveSettings(s)
+	return provider.Close()
 }
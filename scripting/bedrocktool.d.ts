@@ -2,6 +2,16 @@ declare const console: {
     log(data: any);
 };
 
+/** loads a module relative to the current file, only relative paths are supported */
+declare function require(path: string): any;
+declare const module: { exports: any };
+declare const exports: any;
+declare const __filename: string;
+declare const __dirname: string;
+
+/** kept when the scripts are reloaded after a file changed */
+declare let state: {[k: string]: any};
+
 declare type WindowID = number;
 declare type Slot = number;
 
@@ -33,6 +43,90 @@ declare type ItemStack = {
 }
 
 declare type ChunkPos = [number, number];
+declare type BlockPos = [number, number, number];
+
+declare type Block = {
+    Name: string;
+    Properties: {[k: string]: any};
+}
+
+/**
+ * registers a callback for packets with the name given, e.g. "Text" or "*" for all packets.
+ * the packet can be modified, returning false drops it.
+ */
+declare function OnPacket(name: string, fn: (packet: any, toServer: boolean) => boolean | void): void;
+
+/**
+ * the world passed to OnPostProcess(world), before it is written or when running process-world.
+ * entities and block entities are the nbt they are saved with.
+ * the proxy waits for the scripts while OnPostProcess runs.
+ */
+declare type ProcessWorld = {
+    Chunks(): ChunkPos[];
+    GetBlock(x: number, y: number, z: number): Block | null;
+    SetBlock(x: number, y: number, z: number, name: string, properties?: {[k: string]: any}): boolean;
+    /**
+     * replaces blocks by name, or with what the function returns for a block, null keeps it.
+     * the function is called once for every different block state.
+     * returns how many blocks were replaced.
+     */
+    ReplaceBlocks(replacements: {[name: string]: string | Block} | ((block: Block) => string | Block | null)): number;
+    /** returning false removes the entity */
+    ForEachEntity(fn: (nbt: {[k: string]: any}) => boolean | void): void;
+    /** returning false removes the block entity */
+    ForEachBlockEntity(fn: (pos: BlockPos, nbt: {[k: string]: any}) => boolean | void): void;
+};
+
+/** creates a packet by its name, e.g. "Text", fields are set from the object passed */
+declare function NewPacket(name: string, fields?: {[k: string]: any}): any;
+
+/** injects a packet into the connection to the client */
+declare function SendToClient(packet: any): void;
+
+/** injects a packet into the connection to the server */
+declare function SendToServer(packet: any): void;
+
+/** sends a chat message to the player */
+declare function SendMessage(text: string): void;
+
+/** registers a command that can be used ingame, args are the words after it with "quoted strings" as one word.
+ * return true if the command succeeded, false tells the player it failed */
+declare function AddCommand(name: string, description: string, fn: (args: string[]) => boolean): void;
+
+declare const Player: {
+    Position(): [number, number, number];
+};
+
+declare const World: {
+    /** returns null if the chunk of the block hasn't been captured */
+    GetBlock(x: number, y: number, z: number): Block | null;
+    SetBlock(x: number, y: number, z: number, name: string, properties?: {[k: string]: any}): boolean;
+    Entities(): Entity[];
+};
+
+/**
+ * files scripts write, they go into a folder per session in the script output directory.
+ * names are relative to that folder, the extension is added if missing.
+ */
+declare const Output: {
+    /** the folder of this session */
+    Folder(): string;
+    /** appends a row to a csv file, header is only written when the file is created */
+    AppendCSV(name: string, row: any[], header?: string[]): void;
+    /** appends a value as one line of json */
+    AppendJSONL(name: string, value: any): void;
+    /** writes a png from rgba values, 4 per pixel row by row, replaces the file if it exists */
+    WritePNG(name: string, width: number, height: number, pixels: Uint8Array | number[]): void;
+};
+
+/** values that are kept between sessions, they have to be json */
+declare const Store: {
+    Get(key: string): any;
+    Set(key: string, value: any): void;
+    Delete(key: string): void;
+    Keys(): string[];
+};
+
 
 
 
@@ -25,4 +25,32 @@ function OnChunkAdd(pos) {
 function OnEntityDataUpdate(entity, data) {
     console.log("OnEntityDataUpdate");
     console.log("entity name: "+data[EntityDataKey.Name]);
-}
\ No newline at end of file
+}
+
+/**
+ * @param {BlockPos} pos
+ * @param {{[k: string]: any}} nbt
+ * @returns {boolean} ignore block entity
+ */
+function OnBlockEntity(pos, nbt) {
+    return false;
+}
+
+/**
+ * @param {string} name
+ * @param {string} folder
+ */
+function OnSave(name, folder) {
+    SendMessage(`saving ${name}`);
+}
+
+OnPacket("Text", (packet, toServer) => {
+    console.log(packet.Message);
+});
+
+AddCommand("where", "show your position", (args) => {
+    const [x, y, z] = Player.Position();
+    const block = World.GetBlock(Math.floor(x), Math.floor(y) - 2, Math.floor(z));
+    SendMessage(`standing on ${block ? block.Name : "unknown"} with ${World.Entities().length} entities around`);
+    return true;
+});
@@ -0,0 +1,53 @@
+// counts the entities spawned per type and logs shop signs,
+// the files end up in script-output/<date>/
+
+/**
+ * @param {Entity} entity
+ * @param {EntityMetadata} metadata
+ * @returns {boolean}
+ */
+function OnEntityAdd(entity, metadata) {
+    const total = (Store.Get("spawned") || 0) + 1;
+    Store.Set("spawned", total);
+
+    Output.AppendCSV("entities", [Date.now(), entity.EntityType, entity.Position[0], entity.Position[1], entity.Position[2]],
+        ["time", "type", "x", "y", "z"]);
+    return false;
+}
+
+/**
+ * @param {BlockPos} pos
+ * @param {{[k: string]: any}} nbt
+ * @returns {boolean}
+ */
+function OnBlockEntity(pos, nbt) {
+    if (nbt.id == "Sign" && nbt.FrontText) {
+        const lines = nbt.FrontText.Text.split("\n");
+        if (lines[0].includes("[Shop]")) {
+            Output.AppendJSONL("shops", {pos: pos, lines: lines});
+        }
+    }
+    return false;
+}
+
+/**
+ * draws which blocks below the player are solid when a world is saved
+ * @param {string} name
+ * @param {string} folder
+ */
+function OnSave(name, folder) {
+    const pos = Player.Position();
+    const size = 64;
+    const pixels = new Uint8Array(size * size * 4);
+    for (let z = 0; z < size; z++) {
+        for (let x = 0; x < size; x++) {
+            const block = World.GetBlock(Math.floor(pos[0]) - size / 2 + x, Math.floor(pos[1]) - 1, Math.floor(pos[2]) - size / 2 + z);
+            const i = (z * size + x) * 4;
+            const solid = block && block.Name != "minecraft:air";
+            pixels[i] = pixels[i + 1] = pixels[i + 2] = solid ? 40 : 220;
+            pixels[i + 3] = 255;
+        }
+    }
+    Output.WritePNG(name + "-below-player", size, size, pixels);
+    console.log(`${Store.Get("spawned")} entities spawned in all sessions`);
+}
@@ -0,0 +1,21 @@
+// runs before a world is saved, or on a saved world with:
+// bedrocktool process-world -path worlds/server/world -script postprocess-example.js
+
+/**
+ * @param {ProcessWorld} world
+ */
+function OnPostProcess(world) {
+    // swap server specific blocks for vanilla ones and remove barrier walls
+    const replaced = world.ReplaceBlocks({
+        "myserver:spawn_stone": "minecraft:stone",
+        "minecraft:barrier": "minecraft:air",
+    });
+    console.log(`replaced ${replaced} blocks`);
+
+    // remove holograms, they are invisible armor stands with a name tag
+    world.ForEachEntity((entity) => {
+        if (entity.identifier == "minecraft:armor_stand" && entity.CustomName) {
+            return false;
+        }
+    });
+}
@@ -0,0 +1,48 @@
+// run with: bedrocktool script -script proxy-example.js
+// scripts can define these callbacks, all of them are optional
+
+/**
+ * @param {string} address
+ * @param {string} name
+ */
+function OnAddressAndName(address, name) {
+    console.log(`connecting to ${name} (${address})`);
+}
+
+/**
+ * @returns {boolean} cancel connecting
+ */
+function OnServerConnect() {
+    return false;
+}
+
+/**
+ * @returns {boolean} disconnect
+ */
+function OnConnect() {
+    SendToClient(NewPacket("Text", {
+        TextType: 0,
+        Message: "§aScripts loaded",
+    }));
+    return false;
+}
+
+function OnEnd() {
+    console.log(`saw ${state.chatMessages || 0} chat messages`);
+}
+
+// log chat and hide messages containing "spam"
+OnPacket("Text", (packet, toServer) => {
+    state.chatMessages = (state.chatMessages || 0) + 1;
+    console.log(`${toServer ? "SENT: " : ""}${packet.Message}`);
+    if (packet.Message.includes("spam")) {
+        return false;
+    }
+});
+
+AddCommand("day", "ask the server to set the time to day", (args) => {
+    SendToServer(NewPacket("CommandRequest", {
+        CommandLine: "/time set day",
+    }));
+    return true;
+});
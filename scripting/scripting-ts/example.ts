@@ -14,3 +14,23 @@ function OnEntityDataUpdate(entity: Entity, data: EntityMetadata) {
     console.log("OnEntityDataUpdate");
     console.log("entity name: "+data[EntityDataKey.Name]);
 }
+
+
+function OnBlockEntity(pos: BlockPos, nbt: {[k: string]: any}): boolean {
+    return false;
+}
+
+function OnSave(name: string, folder: string) {
+    SendMessage(`saving ${name}`);
+}
+
+OnPacket("Text", (packet, toServer) => {
+    console.log(packet.Message);
+});
+
+AddCommand("where", "show your position", (args) => {
+    const [x, y, z] = Player.Position();
+    const block = World.GetBlock(Math.floor(x), Math.floor(y) - 2, Math.floor(z));
+    SendMessage(`standing on ${block ? block.Name : "unknown"} with ${World.Entities().length} entities around`);
+    return true;
+});
@@ -5,6 +5,8 @@ import (
 	"flag"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/bedrock-tool/bedrocktool/utils"
@@ -43,17 +45,37 @@ func (c *BlindProxyCMD) Execute(ctx context.Context) error {
 		return err
 	}
 
-	listener, err := raknet.Listen("0.0.0.0:19132")
+	listen := utils.Options.Listen
+	listener, err := listen.ListenRaknet()
 	if err != nil {
 		return err
 	}
 	defer listener.Close()
-	logrus.Info("Listening on 0.0.0.0:19132")
+	logrus.Infof("Listening on %s", listener.Addr())
 
-	listener.PongData([]byte(fmt.Sprintf("MCPE;%v;%v;%v;%v;%v;%v;Gophertunnel;%v;%v;%v;%v;",
-		"Proxy For "+server.Name, protocol.CurrentProtocol, protocol.CurrentVersion, 0, 1,
-		listener.ID(), "Creative", 1, listener.Addr().(*net.UDPAddr).Port, listener.Addr().(*net.UDPAddr).Port,
-	)))
+	serverAddress := server.Address + ":" + server.Port
+	if listen.MirrorStatus {
+		// the pong of the server has its own ports in it, they are replaced with ours
+		if pong, err := raknet.Ping(serverAddress); err == nil {
+			listener.PongData(mirrorPong(pong, listener))
+		} else {
+			logrus.Warnf("mirror status: %s", err)
+		}
+	} else {
+		motd := listen.MOTD
+		if motd == "" {
+			motd = "Proxy For " + server.Name
+		}
+		maxPlayers := listen.MaxPlayers
+		if maxPlayers == 0 {
+			maxPlayers = 1
+		}
+		port := listener.Addr().(*net.UDPAddr).Port
+		listener.PongData([]byte(fmt.Sprintf("MCPE;%v;%v;%v;%v;%v;%v;Gophertunnel;%v;%v;%v;%v;",
+			motd, protocol.CurrentProtocol, protocol.CurrentVersion, listen.PlayerCount, maxPlayers,
+			listener.ID(), "Creative", 1, port, port,
+		)))
+	}
 
 	clientConn, err := listener.Accept()
 	if err != nil {
@@ -62,7 +84,7 @@ func (c *BlindProxyCMD) Execute(ctx context.Context) error {
 	defer clientConn.Close()
 	logrus.Info("Client Connected")
 
-	serverConn, err := raknet.DialContext(ctx, server.Address+":"+server.Port)
+	serverConn, err := raknet.DialContext(ctx, serverAddress)
 	if err != nil {
 		return err
 	}
@@ -97,6 +119,20 @@ func (c *BlindProxyCMD) Execute(ctx context.Context) error {
 	return nil
 }
 
+// mirrorPong returns the pong of a server with the id and ports of the listener
+func mirrorPong(pong []byte, listener *raknet.Listener) []byte {
+	fields := strings.Split(string(pong), ";")
+	if len(fields) > 6 {
+		fields[6] = strconv.FormatInt(listener.ID(), 10)
+	}
+	port := strconv.Itoa(listener.Addr().(*net.UDPAddr).Port)
+	if len(fields) > 11 {
+		fields[10] = port
+		fields[11] = port
+	}
+	return []byte(strings.Join(fields, ";"))
+}
+
 func init() {
 	commands.RegisterCommand(&BlindProxyCMD{})
 }
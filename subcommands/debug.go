@@ -5,7 +5,6 @@ import (
 	"flag"
 
 	"github.com/bedrock-tool/bedrocktool/locale"
-	"github.com/bedrock-tool/bedrocktool/utils"
 	"github.com/bedrock-tool/bedrocktool/utils/commands"
 	"github.com/bedrock-tool/bedrocktool/utils/proxy"
 )
@@ -25,7 +24,7 @@ func (c *DebugProxyCMD) Execute(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	utils.Options.Debug = true
+	proxy.Options.Debug = true
 	return proxy.Run(ctx, c.ServerAddress)
 }
 
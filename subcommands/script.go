@@ -0,0 +1,46 @@
+package subcommands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/bedrock-tool/bedrocktool/handlers"
+	"github.com/bedrock-tool/bedrocktool/utils/commands"
+	"github.com/bedrock-tool/bedrocktool/utils/proxy"
+	"github.com/bedrock-tool/bedrocktool/utils/scripting"
+)
+
+type ScriptCMD struct {
+	ServerAddress string
+	Scripts       string
+	Timeout       time.Duration
+	Output        string
+}
+
+func (*ScriptCMD) Name() string     { return "script" }
+func (*ScriptCMD) Synopsis() string { return "run javascript files on a proxy connection" }
+func (c *ScriptCMD) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.ServerAddress, "address", "", "remote server address")
+	f.StringVar(&c.Scripts, "script", "", "paths to scripts to run, seperated by comma")
+	f.DurationVar(&c.Timeout, "timeout", scripting.DefaultTimeout, "how long a script callback may run before it is stopped")
+	f.StringVar(&c.Output, "output", scripting.DefaultOutputDir, "directory scripts write their files to")
+}
+
+func (c *ScriptCMD) Execute(ctx context.Context) error {
+	if c.Scripts == "" {
+		return errors.New("no scripts given, use -script")
+	}
+	proxy, err := proxy.New(true)
+	if err != nil {
+		return err
+	}
+	proxy.AddHandler(handlers.NewScriptHandler(strings.Split(c.Scripts, ","), c.Timeout, c.Output))
+	return proxy.Run(ctx, c.ServerAddress)
+}
+
+func init() {
+	commands.RegisterCommand(&ScriptCMD{})
+}
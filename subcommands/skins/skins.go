@@ -33,7 +33,7 @@ func (c *SkinCMD) Execute(ctx context.Context) error {
 	}
 
 	p.AddHandler(handlers.NewSkinSaver(func(sa handlers.SkinAdd) {
-		messages.Router.Handle(&messages.Message{
+		p.UI(&messages.Message{
 			Source: "skins",
 			Target: "ui",
 			Data: messages.NewSkin{
@@ -46,7 +46,7 @@ func (c *SkinCMD) Execute(ctx context.Context) error {
 	p.AddHandler(&proxy.Handler{
 		Name: "Skin CMD",
 		ConnectCB: func() bool {
-			messages.Router.Handle(&messages.Message{
+			p.UI(&messages.Message{
 				Source: "skins",
 				Target: "ui",
 				Data:   messages.UIStateMain,
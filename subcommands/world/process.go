@@ -0,0 +1,88 @@
+package world
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/bedrock-tool/bedrocktool/handlers/worlds/worldstate"
+	"github.com/bedrock-tool/bedrocktool/locale"
+	"github.com/bedrock-tool/bedrocktool/utils"
+	"github.com/bedrock-tool/bedrocktool/utils/commands"
+	"github.com/bedrock-tool/bedrocktool/utils/scripting"
+	"github.com/sirupsen/logrus"
+)
+
+type ProcessWorldCMD struct {
+	Path    string
+	Scripts string
+	Timeout time.Duration
+	Output  string
+	Zip     bool
+}
+
+func (*ProcessWorldCMD) Name() string { return "process-world" }
+func (*ProcessWorldCMD) Synopsis() string {
+	return "run the OnPostProcess function of scripts on a saved world folder"
+}
+
+func (c *ProcessWorldCMD) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.Path, "path", "", "path to the world folder")
+	f.StringVar(&c.Scripts, "script", "", "paths to scripts to use, seperated by comma")
+	f.DurationVar(&c.Timeout, "script-timeout", scripting.DefaultPostProcessTimeout, "how long OnPostProcess may run before it is stopped, 0 for no limit")
+	f.StringVar(&c.Output, "script-output", scripting.DefaultOutputDir, "directory scripts write their files to")
+	f.BoolVar(&c.Zip, "zip", false, "write a .mcworld next to the folder")
+}
+
+func (c *ProcessWorldCMD) Execute(ctx context.Context) error {
+	if c.Path == "" {
+		return errors.New("missing -path")
+	}
+	if c.Scripts == "" {
+		return errors.New("missing -script")
+	}
+	folder := strings.TrimRight(c.Path, "/\\")
+	if worldstate.HasJournal(folder) {
+		return errors.New(folder + " was not finished, use recover-world first")
+	}
+
+	vm := scripting.New()
+	vm.PostProcessTimeout = c.Timeout
+	vm.OutputDir = c.Output
+	if err := vm.Load(strings.Split(c.Scripts, ",")); err != nil {
+		return err
+	}
+	defer vm.Close()
+
+	pw, err := worldstate.OpenProcessWorld(folder)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Processing %d chunks", len(pw.Chunks()))
+	if err := vm.OnPostProcess(pw); err != nil {
+		// blocks replaced so far are already written, everything else is left as it was
+		pw.Discard()
+		return err
+	}
+	if err := pw.Close(); err != nil {
+		return err
+	}
+	logrus.Info(locale.Loc("saved", locale.Strmap{"Name": folder}))
+
+	if !c.Zip {
+		return nil
+	}
+	filename := folder + ".mcworld"
+	err = utils.ZipFolder(filename, folder)
+	if err != nil {
+		return err
+	}
+	logrus.Info(locale.Loc("saved", locale.Strmap{"Name": filename}))
+	return nil
+}
+
+func init() {
+	commands.RegisterCommand(&ProcessWorldCMD{})
+}
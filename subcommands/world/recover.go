@@ -0,0 +1,62 @@
+package world
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"strings"
+
+	"github.com/bedrock-tool/bedrocktool/handlers/worlds/worldstate"
+	"github.com/bedrock-tool/bedrocktool/locale"
+	"github.com/bedrock-tool/bedrocktool/utils"
+	"github.com/bedrock-tool/bedrocktool/utils/commands"
+	"github.com/sirupsen/logrus"
+)
+
+type RecoverWorldCMD struct {
+	Path        string
+	ExcludeMobs string
+	Zip         bool
+}
+
+func (*RecoverWorldCMD) Name() string { return "recover-world" }
+func (*RecoverWorldCMD) Synopsis() string {
+	return "finish a world folder from a capture that was interrupted"
+}
+
+func (c *RecoverWorldCMD) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.Path, "path", "", "path to the world folder")
+	f.StringVar(&c.ExcludeMobs, "exclude-mobs", "", "list of mobs to exclude seperated by comma")
+	f.BoolVar(&c.Zip, "zip", true, "write a .mcworld next to the folder")
+}
+
+func (c *RecoverWorldCMD) Execute(ctx context.Context) error {
+	if c.Path == "" {
+		return errors.New("missing -path")
+	}
+	folder := strings.TrimRight(c.Path, "/\\")
+	if !worldstate.HasJournal(folder) {
+		return errors.New("no journal in " + folder + ", the world was either finished or not captured by this version")
+	}
+
+	name, err := worldstate.Recover(folder, strings.Split(c.ExcludeMobs, ","))
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Recovered %s", name)
+
+	if !c.Zip {
+		return nil
+	}
+	filename := folder + ".mcworld"
+	err = utils.ZipFolder(filename, folder)
+	if err != nil {
+		return err
+	}
+	logrus.Info(locale.Loc("saved", locale.Strmap{"Name": filename}))
+	return nil
+}
+
+func init() {
+	commands.RegisterCommand(&RecoverWorldCMD{})
+}
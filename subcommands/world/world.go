@@ -3,13 +3,16 @@ package world
 import (
 	"context"
 	"flag"
-	"os"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/bedrock-tool/bedrocktool/handlers/worlds"
 	"github.com/bedrock-tool/bedrocktool/locale"
+	"github.com/bedrock-tool/bedrocktool/utils"
 	"github.com/bedrock-tool/bedrocktool/utils/commands"
 	"github.com/bedrock-tool/bedrocktool/utils/proxy"
+	"github.com/bedrock-tool/bedrocktool/utils/scripting"
 )
 
 type WorldCMD struct {
@@ -24,13 +27,22 @@ type WorldCMD struct {
 	PreloadReplay   string
 	ChunkRadius     int
 	ScriptPath      string
+	ScriptTimeout   time.Duration
+	ScriptOutput    string
+	Template        bool
+	LockTemplate    bool
+	OutputDir       string
+	NameTemplate    string
+	OutputFormat    string
+	KeepFolder      bool
+	TokenFiles      string
 }
 
 func (*WorldCMD) Name() string     { return "worlds" }
 func (*WorldCMD) Synopsis() string { return locale.Loc("world_synopsis", nil) }
 
 func (c *WorldCMD) SetFlags(f *flag.FlagSet) {
-	f.StringVar(&c.ServerAddress, "address", "", locale.Loc("remote_address", nil))
+	f.StringVar(&c.ServerAddress, "address", "", locale.Loc("remote_address", nil)+", several seperated by comma capture in parallel")
 	f.BoolVar(&c.Packs, "packs", false, locale.Loc("save_packs_with_world", nil))
 	f.BoolVar(&c.EnableVoid, "void", true, locale.Loc("enable_void", nil))
 	f.BoolVar(&c.SaveImage, "image", false, locale.Loc("save_image", nil))
@@ -40,25 +52,30 @@ func (c *WorldCMD) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&c.StartPaused, "start-paused", false, "pause the capturing on startup (can be restarted using /start-capture ingame)")
 	f.StringVar(&c.PreloadReplay, "preload-replay", "", "preload from a replay")
 	f.IntVar(&c.ChunkRadius, "chunk-radius", 0, "the max chunk radius to force")
-	f.StringVar(&c.ScriptPath, "script", "", "path to script to use")
+	f.StringVar(&c.ScriptPath, "script", "", "paths to scripts to use, seperated by comma")
+	f.DurationVar(&c.ScriptTimeout, "script-timeout", scripting.DefaultTimeout, "how long a script callback may run before it is stopped")
+	f.StringVar(&c.ScriptOutput, "script-output", scripting.DefaultOutputDir, "directory scripts write their files to")
+	f.BoolVar(&c.Template, "template", false, "save as a .mctemplate world template instead of .mcworld")
+	f.BoolVar(&c.LockTemplate, "lock-template", true, "lock the world options of the template")
+	f.StringVar(&c.OutputDir, "output", "worlds", "directory to save worlds to")
+	f.StringVar(&c.NameTemplate, "name-template", "{server}/{world}", "path of saved worlds, can use {server} {world} {dimension} {date} {counter}")
+	f.StringVar(&c.OutputFormat, "output-format", "zip", "how to save worlds, zip, folder or both")
+	f.BoolVar(&c.KeepFolder, "keep-folder", true, "keep the world folder after zipping")
+	f.StringVar(&c.TokenFiles, "token-files", "", "token file for each address seperated by comma, to use a different account per session (empty uses the default login)")
 }
 
 func (c *WorldCMD) Execute(ctx context.Context) error {
-	var script string
-	if c.ScriptPath != "" {
-		data, err := os.ReadFile(c.ScriptPath)
-		if err != nil {
-			return err
-		}
-		script = string(data)
-	}
-
-	proxy, err := proxy.New(true)
+	format, err := worlds.ParseOutputFormat(c.OutputFormat)
 	if err != nil {
 		return err
 	}
 
-	proxy.AddHandler(worlds.NewWorldsHandler(worlds.WorldSettings{
+	var scripts []string
+	if c.ScriptPath != "" {
+		scripts = strings.Split(c.ScriptPath, ",")
+	}
+
+	settings := worlds.WorldSettings{
 		VoidGen:         c.EnableVoid,
 		WithPacks:       c.Packs,
 		SaveEntities:    c.SaveEntities,
@@ -68,14 +85,53 @@ func (c *WorldCMD) Execute(ctx context.Context) error {
 		StartPaused:     c.StartPaused,
 		PreloadReplay:   c.PreloadReplay,
 		ChunkRadius:     int32(c.ChunkRadius),
-		Script:          script,
-	}))
+		Scripts:         scripts,
+		ScriptTimeout:   c.ScriptTimeout,
+		ScriptOutput:    c.ScriptOutput,
 
-	err = proxy.Run(ctx, c.ServerAddress)
-	if err != nil {
-		return err
+		Template:            c.Template,
+		LockTemplateOptions: c.LockTemplate,
+
+		Output: worlds.OutputSettings{
+			BaseDir:      c.OutputDir,
+			NameTemplate: c.NameTemplate,
+			Format:       format,
+			KeepFolder:   c.KeepFolder,
+		},
+	}
+
+	// every server gets its own session, listening on the next port
+	addresses := strings.Split(c.ServerAddress, ",")
+	var tokenFiles []string
+	if c.TokenFiles != "" {
+		tokenFiles = strings.Split(c.TokenFiles, ",")
+		if len(tokenFiles) > len(addresses) {
+			return fmt.Errorf("%d token files for %d addresses", len(tokenFiles), len(addresses))
+		}
+	}
+	proxies := make([]*proxy.Context, 0, len(addresses))
+	for i := range addresses {
+		p, err := proxy.New(true)
+		if err != nil {
+			return err
+		}
+		p.Options.Listen.Address, err = proxy.SessionPort(p.Options.Listen.GetAddress(), i)
+		if err != nil {
+			return err
+		}
+		if i < len(tokenFiles) && tokenFiles[i] != "" {
+			p.Options.TokenSource, err = utils.Auth.TokenSourceFile(tokenFiles[i])
+			if err != nil {
+				return err
+			}
+		}
+		p.AddHandler(worlds.NewWorldsHandler(settings))
+		proxies = append(proxies, p)
+	}
+	if len(proxies) == 1 {
+		return proxies[0].Run(ctx, c.ServerAddress)
 	}
-	return nil
+	return proxy.RunSessions(ctx, proxies, addresses)
 }
 
 func init() {
@@ -3,6 +3,7 @@ package pages
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"reflect"
 	"sync"
@@ -218,6 +219,15 @@ func (r *Router) HandleMessage(msg *messages.Message) *messages.Message {
 	case messages.ShowPopup:
 		r.PushPopup(data.Popup.(popups.Popup))
 
+	case messages.HandlerFailed:
+		dump := data.Dump
+		// the full dump is in the log, chunks would not fit in a popup
+		if len(dump) > 2000 {
+			dump = dump[:2000] + "\n..."
+		}
+		err := fmt.Errorf("%s stopped working on %s and was disabled, the session goes on without it.\n\n%w\n\n%s", data.Handler, data.Packet, data.Err, dump)
+		r.PushPopup(popups.NewErrorPopup(err, func() {}, false))
+
 	case messages.StartSubcommand:
 		cmd := data.Command.(commands.Command)
 		r.SwitchTo(cmd.Name())
@@ -91,7 +91,9 @@ func (s *settingsPage) Init() {
 	s.f.VisitAll(visitFunc)
 
 	flag.CommandLine.VisitAll(func(f *flag.Flag) {
-		if f.Name == "debug" || f.Name == "capture" {
+		switch f.Name {
+		case "debug", "capture", "spectators", "reconnect",
+			"listen", "motd", "player-count", "max-players", "mirror-status", "hide-lan":
 			visitFunc(f)
 		}
 	})
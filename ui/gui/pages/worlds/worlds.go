@@ -21,27 +21,31 @@ type (
 
 const ID = "worlds"
 
-type Page struct {
+// session is what the page shows for one proxy session
+type session struct {
+	name     string
 	worldMap *Map2
 	//Map3       *Map3
-	worlds     []*messages.SavedWorld
-	worldsList widget.List
-	l          sync.Mutex
-
 	State      messages.UIState
 	chunkCount int
 	voidGen    bool
 	worldName  string
-	back       widget.Clickable
+	tab        widget.Clickable
+}
+
+type Page struct {
+	// sessions in the order their first message arrived
+	sessions   []*session
+	selected   int
+	worlds     []*messages.SavedWorld
+	worldsList widget.List
+	l          sync.Mutex
+
+	back widget.Clickable
 }
 
 func New() pages.Page {
 	return &Page{
-		worldMap: &Map2{
-			images:   make(map[image.Point]*image.RGBA),
-			imageOps: make(map[image.Point]paint.ImageOp),
-		},
-		//Map3: NewMap3(),
 		worldsList: widget.List{
 			List: layout.List{
 				Axis: layout.Vertical,
@@ -52,6 +56,29 @@ func New() pages.Page {
 
 var _ pages.Page = &Page{}
 
+func newSession(name string) *session {
+	return &session{
+		name: name,
+		worldMap: &Map2{
+			images:   make(map[image.Point]*image.RGBA),
+			imageOps: make(map[image.Point]paint.ImageOp),
+		},
+		//Map3: NewMap3(),
+	}
+}
+
+// session returns the state for the named session, creating it on its first message
+func (p *Page) session(name string) *session {
+	for _, s := range p.sessions {
+		if s.name == name {
+			return s
+		}
+	}
+	s := newSession(name)
+	p.sessions = append(p.sessions, s)
+	return s
+}
+
 func (p *Page) ID() string {
 	return ID
 }
@@ -89,6 +116,62 @@ func displayWorldEntry(gtx C, th *material.Theme, entry *messages.SavedWorld) D
 	})
 }
 
+// finished is true once every session has ended
+func (p *Page) finished() bool {
+	if len(p.sessions) == 0 {
+		return false
+	}
+	for _, s := range p.sessions {
+		if s.State != messages.UIStateFinished {
+			return false
+		}
+	}
+	return true
+}
+
+// layoutSessions shows the selected sessions map, with tabs to switch when there is more than one
+func (p *Page) layoutSessions(gtx C, th *material.Theme) D {
+	for i, s := range p.sessions {
+		if s.tab.Clicked(gtx) {
+			p.selected = i
+		}
+	}
+	p.selected = min(p.selected, len(p.sessions)-1)
+	current := p.sessions[p.selected]
+
+	if len(p.sessions) == 1 {
+		return current.worldMap.Layout(gtx)
+	}
+
+	tabs := make([]layout.FlexChild, 0, len(p.sessions))
+	for i, s := range p.sessions {
+		label := s.name
+		if s.worldName != "" {
+			label += ": " + s.worldName
+		}
+		label += fmt.Sprintf(" (%d)", s.chunkCount)
+		b := material.Button(th, &s.tab, label)
+		if i != p.selected {
+			b.Background = component.WithAlpha(b.Background, 100)
+		}
+		tabs = append(tabs, layout.Rigid(func(gtx C) D {
+			return layout.UniformInset(4).Layout(gtx, b.Layout)
+		}))
+	}
+
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{}.Layout(gtx, tabs...)
+		}),
+		layout.Flexed(1, func(gtx C) D {
+			if current.State != messages.UIStateMain {
+				return D{Size: gtx.Constraints.Max}
+			}
+			return current.worldMap.Layout(gtx)
+		}),
+	)
+}
+
 func (p *Page) Layout(gtx C, th *material.Theme) D {
 	if p.back.Clicked(gtx) {
 		messages.Router.Handle(&messages.Message{
@@ -98,10 +181,10 @@ func (p *Page) Layout(gtx C, th *material.Theme) D {
 		})
 	}
 
-	switch p.State {
-	case messages.UIStateMain:
-		return p.worldMap.Layout(gtx)
-	case messages.UIStateFinished:
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	if p.finished() {
 		return layout.UniformInset(25).Layout(gtx, func(gtx C) D {
 			return layout.Flex{
 				Axis:    layout.Vertical,
@@ -114,8 +197,6 @@ func (p *Page) Layout(gtx C, th *material.Theme) D {
 						}.Layout(gtx,
 							layout.Rigid(material.Label(th, 20, "Worlds Saved").Layout),
 							layout.Flexed(1, func(gtx C) D {
-								p.l.Lock()
-								defer p.l.Unlock()
 								return material.List(th, &p.worldsList).Layout(gtx, len(p.worlds), func(gtx C, index int) D {
 									entry := p.worlds[len(p.worlds)-index-1]
 									return displayWorldEntry(gtx, th, entry)
@@ -131,44 +212,53 @@ func (p *Page) Layout(gtx C, th *material.Theme) D {
 				}),
 			)
 		})
-	default:
-		return D{}
 	}
+
+	for _, s := range p.sessions {
+		if s.State == messages.UIStateMain {
+			return p.layoutSessions(gtx, th)
+		}
+	}
+	return D{}
 }
 
 func (u *Page) HandleMessage(msg *messages.Message) *messages.Message {
-	switch m := msg.Data.(type) {
-	case messages.HaveFinishScreen:
+	if _, ok := msg.Data.(messages.HaveFinishScreen); ok {
 		return &messages.Message{
 			Source: "worlds",
 			Data:   true,
 		}
+	}
+
+	u.l.Lock()
+	defer u.l.Unlock()
+	switch m := msg.Data.(type) {
 	case messages.UIState:
-		u.State = m
+		u.session(msg.Session).State = m
 	case messages.UpdateMap:
-		u.chunkCount = m.ChunkCount
-		u.worldMap.Update(&m)
-		//u.Map3.Update(&m)
+		s := u.session(msg.Session)
+		s.chunkCount = m.ChunkCount
+		s.worldMap.Update(&m)
+		//s.Map3.Update(&m)
 	case messages.PlayerPosition:
-		u.worldMap.mapInput.playerPosition = m.Position
+		u.session(msg.Session).worldMap.mapInput.playerPosition = m.Position
 	case messages.MapLookup:
-		//u.Map3.SetLookupTexture(m.Lookup)
+		//u.session(msg.Session).Map3.SetLookupTexture(m.Lookup)
 	case messages.SetValue:
+		s := u.session(msg.Session)
 		switch m.Name {
 		case "voidGen":
 			switch m.Value {
 			case "true":
-				u.voidGen = true
+				s.voidGen = true
 			case "false":
-				u.voidGen = true
+				s.voidGen = false
 			}
 		case "worldName":
-			u.worldName = m.Value
+			s.worldName = m.Value
 		}
 	case messages.SavingWorld:
-		u.l.Lock()
 		u.worlds = append(u.worlds, m.World)
-		u.l.Unlock()
 	}
 	return nil
 }
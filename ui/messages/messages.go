@@ -14,7 +14,9 @@ import (
 type Message struct {
 	Source string
 	Target string
-	Data   any
+	// the proxy session the message belongs to, empty when there is only one
+	Session string
+	Data    any
 }
 
 type HandlerFunc = func(msg *Message) *Message
@@ -117,6 +119,14 @@ type UpdateAvailable struct {
 	Version string
 }
 
+// HandlerFailed is sent when a handler panicked or returned an error and was disabled
+type HandlerFailed struct {
+	Handler string
+	Packet  string
+	Dump    string // the packet it failed on, decoded or as hex
+	Err     error
+}
+
 // close self
 type Close struct {
 	Type string
@@ -147,10 +157,11 @@ type ServerInput struct {
 
 func Decode(bytes []byte) (*Message, error) {
 	var dec struct {
-		Source string
-		Target string
-		Type   string
-		Data   json.RawMessage
+		Source  string
+		Target  string
+		Session string
+		Type    string
+		Data    json.RawMessage
 	}
 	err := json.Unmarshal(bytes, &dec)
 	if err != nil {
@@ -172,9 +183,10 @@ func Decode(bytes []byte) (*Message, error) {
 	}
 
 	return &Message{
-		Source: dec.Source,
-		Target: dec.Target,
-		Data:   data,
+		Source:  dec.Source,
+		Target:  dec.Target,
+		Session: dec.Session,
+		Data:    data,
 	}, nil
 }
 
@@ -182,15 +194,17 @@ func Encode(msg *Message) []byte {
 	msgType := reflect.TypeOf(msg.Data).String()
 
 	var enc = struct {
-		Source string
-		Target string
-		Type   string
-		Data   any
+		Source  string
+		Target  string
+		Session string
+		Type    string
+		Data    any
 	}{
-		Source: msg.Source,
-		Target: msg.Target,
-		Type:   msgType,
-		Data:   msg.Data,
+		Source:  msg.Source,
+		Target:  msg.Target,
+		Session: msg.Session,
+		Type:    msgType,
+		Data:    msg.Data,
 	}
 
 	data, err := json.Marshal(&enc)
@@ -20,6 +20,14 @@ func (r *router) Handle(msg *Message) *Message {
 	return handler(msg)
 }
 
+// Session sends messages tagged with the name of a proxy session
+type Session string
+
+func (s Session) Handle(msg *Message) *Message {
+	msg.Session = string(s)
+	return Router.Handle(msg)
+}
+
 var Router = router{
 	handlers: make(map[string]func(msg *Message) *Message),
 }
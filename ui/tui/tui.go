@@ -68,11 +68,16 @@ func (c *TUI) Start(ctx context.Context, cancel context.CancelCauseFunc) error {
 }
 
 func (c *TUI) HandleMessage(msg *messages.Message) *messages.Message {
-	switch msg := msg.Data.(type) {
+	switch data := msg.Data.(type) {
 	case *messages.ServerInput:
-		_ = msg
+		_ = data
+		prompt := locale.Loc("enter_server", nil)
+		// say which session is asking when several run at once
+		if msg.Session != "" {
+			prompt = "[" + msg.Session + "] " + prompt
+		}
 		var cancelled bool
-		server, cancelled := utils.UserInput(context.Background(), locale.Loc("enter_server", nil), utils.ValidateServerInput)
+		server, cancelled := utils.UserInput(context.Background(), prompt, utils.ValidateServerInput)
 		if cancelled {
 			return &messages.Message{
 				Source: "gui",
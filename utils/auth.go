@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/sandertv/gophertunnel/minecraft/auth"
 	"github.com/sandertv/gophertunnel/minecraft/realms"
@@ -15,6 +16,8 @@ import (
 const TokenFile = "token.json"
 
 type authsrv struct {
+	// sessions running at the same time should only ask for login once
+	l         sync.Mutex
 	src       oauth2.TokenSource
 	baseCtx   context.Context
 	ctx       context.Context
@@ -39,8 +42,8 @@ func (a *authsrv) HaveToken() bool {
 	return err == nil
 }
 
-func (a *authsrv) writeToken(token *oauth2.Token) error {
-	f, err := os.Create(TokenFile)
+func writeToken(path string, token *oauth2.Token) error {
+	f, err := os.Create(path)
 	if err != nil {
 		return err
 	}
@@ -49,9 +52,9 @@ func (a *authsrv) writeToken(token *oauth2.Token) error {
 	return e.Encode(token)
 }
 
-func (a *authsrv) readToken() (*oauth2.Token, error) {
+func readToken(path string) (*oauth2.Token, error) {
 	var token oauth2.Token
-	f, err := os.Open(TokenFile)
+	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
@@ -65,13 +68,31 @@ func (a *authsrv) readToken() (*oauth2.Token, error) {
 }
 
 func (a *authsrv) GetTokenSource() (src oauth2.TokenSource, err error) {
+	a.l.Lock()
+	defer a.l.Unlock()
 	if a.src != nil {
 		return a.src, nil
 	}
+	a.src, err = a.tokenSource(TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	return a.src, nil
+}
+
+// TokenSourceFile returns a token source for the account saved in path,
+// asking for a login and saving it there if the file doesnt exist yet
+func (a *authsrv) TokenSourceFile(path string) (oauth2.TokenSource, error) {
+	a.l.Lock()
+	defer a.l.Unlock()
+	return a.tokenSource(path)
+}
+
+func (a *authsrv) tokenSource(path string) (src oauth2.TokenSource, err error) {
 	var token *oauth2.Token
-	if a.HaveToken() {
+	if _, err := os.Stat(path); err == nil {
 		// read the existing token
-		token, err = a.readToken()
+		token, err = readToken(path)
 		if err != nil {
 			return nil, err
 		}
@@ -81,27 +102,27 @@ func (a *authsrv) GetTokenSource() (src oauth2.TokenSource, err error) {
 		if err != nil {
 			return nil, err
 		}
-		err := a.writeToken(token)
+		err := writeToken(path, token)
 		if err != nil {
 			return nil, err
 		}
 	}
-	a.src = auth.RefreshTokenSource(token)
+	src = auth.RefreshTokenSource(token)
 
 	// if the old token isnt valid save the new one
 	if !token.Valid() {
 		logrus.Debug("Refreshing token")
-		token, err = a.src.Token()
+		token, err = src.Token()
 		if err != nil {
 			return nil, err
 		}
-		err = a.writeToken(token)
+		err = writeToken(path, token)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	return a.src, nil
+	return src, nil
 }
 
 var RealmsEnv string
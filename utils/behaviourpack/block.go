@@ -14,8 +14,9 @@ func (bp *Pack) AddBlock(block protocol.BlockEntry) {
 	if ns == "minecraft" {
 		return
 	}
+	entry, formatVersion := parseBlock(block)
 	bp.blocks[block.Name] = &blockBehaviour{
-		FormatVersion:  "1.14.0",
-		MinecraftBlock: parseBlock(block),
+		FormatVersion:  formatVersion,
+		MinecraftBlock: entry,
 	}
 }
@@ -1,24 +1,43 @@
 package behaviourpack
 
-import "github.com/sandertv/gophertunnel/minecraft/protocol"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+const (
+	// description.properties, conditions may still use query.block_property
+	blockFormatLegacy = "1.19.80"
+	// description.states and description.traits
+	blockFormatCurrent = "1.20.60"
+)
 
 type description struct {
 	Identifier             string         `json:"identifier"`
-	IsExperimental         bool           `json:"is_experimental"`
-	RegisterToCreativeMenu bool           `json:"register_to_creative_menu"`
+	IsExperimental         bool           `json:"is_experimental,omitempty"`
+	RegisterToCreativeMenu bool           `json:"register_to_creative_menu,omitempty"`
 	Properties             map[string]any `json:"properties,omitempty"`
-	MenuCategory           menuCategory   `json:"menu_category,omitempty"`
+	States                 map[string]any `json:"states,omitempty"`
+	Traits                 map[string]any `json:"traits,omitempty"`
+	MenuCategory           *menuCategory  `json:"menu_category,omitempty"`
 }
 
 type menuCategory struct {
-	Category string `json:"category"`
-	Group    string `json:"group"`
+	Category           string `json:"category"`
+	Group              string `json:"group,omitempty"`
+	IsHiddenInCommands bool   `json:"is_hidden_in_commands,omitempty"`
 }
 
-func menu_category_from_map(in map[string]any) menuCategory {
-	return menuCategory{
-		Category: in["category"].(string),
-		Group:    in["group"].(string),
+func menu_category_from_map(in map[string]any) *menuCategory {
+	category, _ := in["category"].(string)
+	group, _ := in["group"].(string)
+	hidden, _ := in["is_hidden_in_commands"].(uint8)
+	return &menuCategory{
+		Category:           category,
+		Group:              group,
+		IsHiddenInCommands: hidden != 0,
 	}
 }
 
@@ -28,9 +47,11 @@ type permutation struct {
 }
 
 func permutation_from_map(in map[string]any) permutation {
+	components, _ := in["components"].(map[string]any)
+	condition, _ := in["condition"].(string)
 	return permutation{
-		Components: in["components"].(map[string]any),
-		Condition:  in["condition"].(string),
+		Components: convertBlockComponents(components),
+		Condition:  condition,
 	}
 }
 
@@ -40,141 +61,406 @@ type MinecraftBlock struct {
 	Permutations []permutation  `json:"permutations,omitempty"`
 }
 
-func parseBlock(block protocol.BlockEntry) MinecraftBlock {
+// blockFormatVersion selects the format the block is written in.
+// query.block_property was removed from the newer formats, blocks that still use it have to stay on the old one.
+func blockFormatVersion(props map[string]any) string {
+	if perms, ok := props["permutations"].([]any); ok {
+		for _, v := range perms {
+			perm, _ := v.(map[string]any)
+			condition, _ := perm["condition"].(string)
+			if strings.Contains(condition, "block_property") {
+				return blockFormatLegacy
+			}
+		}
+	}
+	return blockFormatCurrent
+}
+
+func parseBlock(block protocol.BlockEntry) (MinecraftBlock, string) {
+	formatVersion := blockFormatVersion(block.Properties)
 	entry := MinecraftBlock{
 		Description: description{
-			Identifier:             block.Name,
-			IsExperimental:         true,
-			RegisterToCreativeMenu: true,
+			Identifier: block.Name,
 		},
 	}
 
 	if perms, ok := block.Properties["permutations"].([]any); ok {
 		for _, v := range perms {
-			perm := permutation_from_map(v.(map[string]any))
-			if v, ok := perm.Components["minecraft:transformation"].(map[string]any); ok {
-				// rotation
-				rx, _ := v["RX"].(int32)
-				ry, _ := v["RY"].(int32)
-				rz, _ := v["RZ"].(int32)
-
-				// scale
-				sx, _ := v["SX"].(float32)
-				sy, _ := v["SY"].(float32)
-				sz, _ := v["SZ"].(float32)
-
-				// translation
-				tx, _ := v["TX"].(float32)
-				ty, _ := v["TY"].(float32)
-				tz, _ := v["TZ"].(float32)
-
-				perm.Components["minecraft:transformation"] = map[string][]float32{
-					"translation": {tx, ty, tz},
-					"scale":       {sx, sy, sz},
-					"rotation":    {float32(rx) * 90, float32(ry) * 90, float32(rz) * 90},
-				}
-			}
-			if v, ok := perm.Components["minecraft:geometry"].(map[string]any); ok {
-				if identifier, ok := v["identifier"].(string); ok {
-					perm.Components["minecraft:geometry"] = identifier
-				}
+			if v, ok := v.(map[string]any); ok {
+				entry.Permutations = append(entry.Permutations, permutation_from_map(v))
 			}
-			entry.Permutations = append(entry.Permutations, perm)
 		}
 	}
 
 	if comps, ok := block.Properties["components"].(map[string]any); ok {
-		delete(comps, "minecraft:creative_category")
+		entry.Components = convertBlockComponents(comps)
+	}
 
-		for k, v := range comps {
-			if v, ok := v.(map[string]any); ok {
-				// fix {"value": 0.1} -> 0.1
-				if v, ok := v["value"]; ok {
-					comps[k] = v
-				}
-				// fix {"lightLevel": 15} -> 15
-				if v, ok := v["lightLevel"]; ok {
-					comps[k] = v
+	if menu, ok := block.Properties["menu_category"].(map[string]any); ok {
+		entry.Description.MenuCategory = menu_category_from_map(menu)
+	}
+
+	states := blockStates(block.Properties)
+	if formatVersion == blockFormatLegacy {
+		entry.Description.IsExperimental = true
+		entry.Description.RegisterToCreativeMenu = true
+		entry.Description.Properties = states
+	} else {
+		entry.Description.States = states
+		entry.Description.Traits = blockTraits(block.Properties)
+	}
+
+	return entry, formatVersion
+}
+
+// blockStates reads the custom states of the block, bool states are sent as bytes
+func blockStates(props map[string]any) map[string]any {
+	list, ok := props["properties"].([]any)
+	if !ok {
+		return nil
+	}
+	states := make(map[string]any)
+	for _, v := range list {
+		v, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _ := v["name"].(string)
+		// states added by traits are not declared by the block
+		if name == "" || strings.HasPrefix(name, "minecraft:") {
+			continue
+		}
+		switch a := v["enum"].(type) {
+		case []int32:
+			states[name] = a
+		case []bool:
+			states[name] = a
+		case []string:
+			states[name] = a
+		case []uint8:
+			values := make([]bool, len(a))
+			for i, b := range a {
+				values[i] = b != 0
+			}
+			states[name] = values
+		case []any:
+			values := make([]any, len(a))
+			for i, e := range a {
+				if b, ok := e.(uint8); ok {
+					values[i] = b != 0
+				} else {
+					values[i] = e
 				}
+			}
+			states[name] = values
+		}
+	}
+	if len(states) == 0 {
+		return nil
+	}
+	return states
+}
+
+// blockTraits converts the traits list, {"name": "placement_direction", "enabled_states": {"cardinal_direction": 1}}
+// to {"minecraft:placement_direction": {"enabled_states": ["minecraft:cardinal_direction"]}}
+func blockTraits(props map[string]any) map[string]any {
+	list, ok := props["traits"].([]any)
+	if !ok {
+		return nil
+	}
+	traits := make(map[string]any)
+	for _, v := range list {
+		v, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _ := v["name"].(string)
+		if name == "" {
+			continue
+		}
+		if !strings.Contains(name, ":") {
+			name = "minecraft:" + name
+		}
 
-				// fix missing * instance
-				if k == "minecraft:material_instances" {
-					if m, ok := v["materials"].(map[string]any); ok {
-						comps[k] = m
-					}
-					materials := comps[k].(map[string]any)
-					for _, material := range materials {
-						material, ok := material.(map[string]any)
-						if !ok {
-							continue
-						}
-						for prop, value := range material {
-							switch prop {
-							case "ambient_occlusion", "face_dimming":
-								if value, ok := value.(uint8); ok {
-									material[prop] = value > 0
-								}
-							}
-						}
-					}
-					if _, ok := materials["*"]; !ok {
-						up, ok := materials["up"]
-						if ok {
-							materials["*"] = up
-						} else {
-							for _, side := range materials {
-								materials["*"] = side
-								break
-							}
-						}
-
-					}
+		trait := make(map[string]any)
+		var enabled []string
+		if states, ok := v["enabled_states"].(map[string]any); ok {
+			for state, on := range states {
+				if b, _ := on.(uint8); b != 0 {
+					enabled = append(enabled, "minecraft:"+state)
 				}
-				// fix {"identifier": "name"} -> "name"
-				if v, ok := v["identifier"]; ok {
-					comps[k] = v
+			}
+		}
+		trait["enabled_states"] = enabled
+		if offset, ok := v["y_rotation_offset"].(float32); ok {
+			trait["y_rotation_offset"] = offset
+		}
+		traits[name] = trait
+	}
+	if len(traits) == 0 {
+		return nil
+	}
+	return traits
+}
+
+// convertBlockComponents converts the components of a block or permutation from the network format to json
+func convertBlockComponents(comps map[string]any) map[string]any {
+	out := make(map[string]any, len(comps))
+	for k, v := range comps {
+		m, ok := v.(map[string]any)
+		if !ok {
+			out[k] = v
+			continue
+		}
+		switch k {
+		case "minecraft:creative_category":
+			// moved to the menu_category of the description
+		case "minecraft:collision_box", "minecraft:selection_box":
+			out[k] = convertBox(m)
+		case "minecraft:geometry":
+			out[k] = convertGeometry(m)
+		case "minecraft:material_instances":
+			out[k] = convertMaterialInstances(m)
+		case "minecraft:transformation":
+			out[k] = convertTransformation(m)
+		case "minecraft:light_emission":
+			out[k] = int(nbtNumber(m["emission"], m["value"]))
+		case "minecraft:light_dampening":
+			out[k] = int(nbtNumber(m["lightLevel"], m["value"]))
+		case "minecraft:destructible_by_mining":
+			out[k] = map[string]any{
+				"seconds_to_destroy": nbtNumber(m["value"], m["seconds_to_destroy"]),
+			}
+		case "minecraft:destructible_by_explosion":
+			out[k] = map[string]any{
+				"explosion_resistance": nbtNumber(m["explosion_resistance"], m["value"]),
+			}
+		case "minecraft:friction":
+			friction := nbtNumber(m["value"])
+			// default
+			if friction != 0.4 {
+				out[k] = friction
+			}
+		case "minecraft:map_color":
+			switch c := m["color"].(type) {
+			case string:
+				out[k] = c
+			case int32:
+				out[k] = fmt.Sprintf("#%06x", uint32(c)&0xffffff)
+			default:
+				if v, ok := m["value"]; ok {
+					out[k] = v
 				}
-				// fix {"emission": "name"} -> "name"
-				if v, ok := v["emission"]; ok {
-					comps[k] = v
+			}
+		case "minecraft:display_name":
+			out[k] = m["value"]
+		case "minecraft:placement_filter":
+			out[k] = convertPlacementFilter(m)
+		default:
+			if v, ok := m["triggerType"]; ok {
+				// event triggers
+				out[k] = map[string]any{
+					"event": v,
 				}
+			} else if v, ok := m["value"]; ok && len(m) == 1 {
+				// {"value": 0.1} -> 0.1
+				out[k] = v
+			} else {
+				out[k] = m
+			}
+		}
+	}
+	return out
+}
+
+// nbtNumber returns the first of the values that is a number as a float
+func nbtNumber(values ...any) float32 {
+	for _, v := range values {
+		switch v := v.(type) {
+		case float32:
+			return v
+		case float64:
+			return float32(v)
+		case int32:
+			return float32(v)
+		case int16:
+			return float32(v)
+		case uint8:
+			return float32(v)
+		case int64:
+			return float32(v)
+		}
+	}
+	return 0
+}
+
+func vec3(v any) []float32 {
+	out := make([]float32, 3)
+	switch v := v.(type) {
+	case []float32:
+		copy(out, v)
+	case []any:
+		for i := 0; i < len(v) && i < 3; i++ {
+			out[i] = nbtNumber(v[i])
+		}
+	}
+	return out
+}
+
+func convertBox(m map[string]any) any {
+	if enabled, ok := m["enabled"].(uint8); ok && enabled == 0 {
+		return false
+	}
+	_, hasOrigin := m["origin"]
+	_, hasSize := m["size"]
+	if !hasOrigin && !hasSize {
+		return true
+	}
+	return map[string]any{
+		"origin": vec3(m["origin"]),
+		"size":   vec3(m["size"]),
+	}
+}
 
-				if v, ok := v["triggerType"]; ok {
-					comps[k] = map[string]any{
-						"event": v.(string),
-					}
+func convertGeometry(m map[string]any) any {
+	identifier, _ := m["identifier"].(string)
+	out := map[string]any{
+		"identifier": identifier,
+	}
+	if bones, ok := m["bone_visibility"].(map[string]any); ok && len(bones) > 0 {
+		visibility := make(map[string]any, len(bones))
+		for bone, v := range bones {
+			switch v := v.(type) {
+			case uint8:
+				visibility[bone] = v != 0
+			case map[string]any:
+				// molang expression
+				if expr, ok := v["expression"].(string); ok {
+					visibility[bone] = expr
+				} else {
+					visibility[bone] = v
 				}
+			default:
+				visibility[bone] = v
 			}
 		}
+		out["bone_visibility"] = visibility
+	}
+	if culling, ok := m["culling"].(string); ok && culling != "" {
+		out["culling"] = culling
+	}
+	if len(out) == 1 {
+		return identifier
+	}
+	return out
+}
 
-		if friction, ok := comps["minecraft:friction"].(float32); ok {
-			if friction == 0.4 {
-				delete(comps, "minecraft:friction")
+func convertMaterialInstances(m map[string]any) map[string]any {
+	materials := make(map[string]any)
+	if in, ok := m["materials"].(map[string]any); ok {
+		// faces that use the material of another face
+		if mappings, ok := m["mappings"].(map[string]any); ok {
+			for face, target := range mappings {
+				materials[face] = target
+			}
+		}
+		m = in
+	}
+	for face, material := range m {
+		material, ok := material.(map[string]any)
+		if !ok {
+			continue
+		}
+		out := make(map[string]any, len(material))
+		for prop, value := range material {
+			switch prop {
+			case "ambient_occlusion", "face_dimming":
+				if value, ok := value.(uint8); ok {
+					out[prop] = value > 0
+					continue
+				}
 			}
+			out[prop] = value
 		}
+		materials[face] = out
+	}
 
-		entry.Components = comps
+	// the * instance is required
+	if _, ok := materials["*"]; !ok {
+		if up, ok := materials["up"]; ok {
+			materials["*"] = up
+		} else {
+			for _, side := range materials {
+				materials["*"] = side
+				break
+			}
+		}
 	}
+	return materials
+}
 
-	if menu, ok := block.Properties["menu_category"].(map[string]any); ok {
-		entry.Description.MenuCategory = menu_category_from_map(menu)
+func convertTransformation(m map[string]any) map[string]any {
+	// rotation is sent in steps of 90 degrees
+	rx, _ := m["RX"].(int32)
+	ry, _ := m["RY"].(int32)
+	rz, _ := m["RZ"].(int32)
+
+	out := map[string]any{
+		"translation": []float32{nbtNumber(m["TX"]), nbtNumber(m["TY"]), nbtNumber(m["TZ"])},
+		"scale":       []float32{nbtNumber(m["SX"]), nbtNumber(m["SY"]), nbtNumber(m["SZ"])},
+		"rotation":    []float32{float32(rx) * 90, float32(ry) * 90, float32(rz) * 90},
+	}
+	if _, ok := m["RXP"]; ok {
+		out["rotation_pivot"] = []float32{nbtNumber(m["RXP"]), nbtNumber(m["RYP"]), nbtNumber(m["RZP"])}
 	}
+	if _, ok := m["SXP"]; ok {
+		out["scale_pivot"] = []float32{nbtNumber(m["SXP"]), nbtNumber(m["SYP"]), nbtNumber(m["SZP"])}
+	}
+	return out
+}
+
+var placementFaces = []string{"down", "up", "north", "south", "west", "east"}
 
-	if props, ok := block.Properties["properties"].([]any); ok {
-		entry.Description.Properties = make(map[string]any)
-		for _, v := range props {
-			v := v.(map[string]any)
-			name := v["name"].(string)
-			switch a := v["enum"].(type) {
-			case []int32:
-				entry.Description.Properties[name] = a
-			case []bool:
-				entry.Description.Properties[name] = a
-			case []any:
-				entry.Description.Properties[name] = a
+func convertPlacementFilter(m map[string]any) map[string]any {
+	conditions, _ := m["conditions"].([]any)
+	var out []any
+	for _, c := range conditions {
+		c, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		condition := make(map[string]any)
+		if faces, ok := c["allowed_faces"].(uint8); ok {
+			var allowed []string
+			for i, face := range placementFaces {
+				if faces&(1<<i) != 0 {
+					allowed = append(allowed, face)
+				}
+			}
+			if len(allowed) == len(placementFaces) {
+				allowed = []string{"all"}
 			}
+			condition["allowed_faces"] = allowed
 		}
+		if filter, ok := c["block_filter"].([]any); ok {
+			var blocks []any
+			for _, b := range filter {
+				b, ok := b.(map[string]any)
+				if !ok {
+					continue
+				}
+				// only a name can be written as a string
+				if name, ok := b["name"].(string); ok && len(b) == 1 {
+					blocks = append(blocks, name)
+				} else {
+					blocks = append(blocks, b)
+				}
+			}
+			condition["block_filter"] = blocks
+		}
+		out = append(out, condition)
+	}
+	return map[string]any{
+		"conditions": out,
 	}
-
-	return entry
 }
@@ -0,0 +1,311 @@
+package behaviourpack
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+func TestBlockFormatVersion(t *testing.T) {
+	tests := []struct {
+		name  string
+		props map[string]any
+		want  string
+	}{
+		{name: "no permutations", props: map[string]any{}, want: blockFormatCurrent},
+		{
+			name: "block_state conditions",
+			props: map[string]any{"permutations": []any{
+				map[string]any{"condition": "query.block_state('test:on') == true"},
+			}},
+			want: blockFormatCurrent,
+		},
+		{
+			name: "block_property conditions",
+			props: map[string]any{"permutations": []any{
+				map[string]any{"condition": "q.block_state('test:on')"},
+				map[string]any{"condition": "query.block_property('test:on') == 1"},
+			}},
+			want: blockFormatLegacy,
+		},
+	}
+	for _, tt := range tests {
+		if got := blockFormatVersion(tt.props); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseBlock(t *testing.T) {
+	properties := []any{
+		map[string]any{"name": "test:on", "enum": []any{uint8(0), uint8(1)}},
+		map[string]any{"name": "test:color", "enum": []string{"red", "blue"}},
+		map[string]any{"name": "test:level", "enum": []int32{0, 1, 2}},
+		// added by the trait
+		map[string]any{"name": "minecraft:cardinal_direction", "enum": []string{"north", "south"}},
+	}
+	states := map[string]any{
+		"test:on":    []any{false, true},
+		"test:color": []string{"red", "blue"},
+		"test:level": []int32{0, 1, 2},
+	}
+
+	tests := []struct {
+		name       string
+		block      protocol.BlockEntry
+		want       MinecraftBlock
+		wantFormat string
+	}{
+		{
+			name: "current format",
+			block: protocol.BlockEntry{
+				Name: "test:lamp",
+				Properties: map[string]any{
+					"properties": properties,
+					"traits": []any{map[string]any{
+						"name":              "placement_direction",
+						"enabled_states":    map[string]any{"cardinal_direction": uint8(1), "facing_direction": uint8(0)},
+						"y_rotation_offset": float32(180),
+					}},
+					"menu_category": map[string]any{"category": "construction", "group": "itemGroup.name.lamp"},
+					"components": map[string]any{
+						"minecraft:light_emission": map[string]any{"emission": uint8(15)},
+					},
+					"permutations": []any{map[string]any{
+						"condition":  "query.block_state('test:on')",
+						"components": map[string]any{"minecraft:display_name": map[string]any{"value": "On"}},
+					}},
+				},
+			},
+			want: MinecraftBlock{
+				Description: description{
+					Identifier: "test:lamp",
+					States:     states,
+					Traits: map[string]any{
+						"minecraft:placement_direction": map[string]any{
+							"enabled_states":    []string{"minecraft:cardinal_direction"},
+							"y_rotation_offset": float32(180),
+						},
+					},
+					MenuCategory: &menuCategory{Category: "construction", Group: "itemGroup.name.lamp"},
+				},
+				Components: map[string]any{"minecraft:light_emission": 15},
+				Permutations: []permutation{{
+					Condition:  "query.block_state('test:on')",
+					Components: map[string]any{"minecraft:display_name": "On"},
+				}},
+			},
+			wantFormat: blockFormatCurrent,
+		},
+		{
+			name: "legacy format",
+			block: protocol.BlockEntry{
+				Name: "test:old",
+				Properties: map[string]any{
+					"properties": properties,
+					"traits":     []any{map[string]any{"name": "placement_direction"}},
+					"permutations": []any{map[string]any{
+						"condition":  "query.block_property('test:on') == 1",
+						"components": map[string]any{},
+					}},
+				},
+			},
+			want: MinecraftBlock{
+				Description: description{
+					Identifier:             "test:old",
+					IsExperimental:         true,
+					RegisterToCreativeMenu: true,
+					Properties:             states,
+				},
+				Permutations: []permutation{{
+					Condition:  "query.block_property('test:on') == 1",
+					Components: map[string]any{},
+				}},
+			},
+			wantFormat: blockFormatLegacy,
+		},
+		{
+			name:       "no states",
+			block:      protocol.BlockEntry{Name: "test:plain", Properties: map[string]any{}},
+			want:       MinecraftBlock{Description: description{Identifier: "test:plain"}},
+			wantFormat: blockFormatCurrent,
+		},
+	}
+	for _, tt := range tests {
+		got, format := parseBlock(tt.block)
+		if format != tt.wantFormat {
+			t.Errorf("%s: format %s, want %s", tt.name, format, tt.wantFormat)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\ngot  %#v\nwant %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConvertBlockComponents(t *testing.T) {
+	tests := []struct {
+		name string
+		in   map[string]any
+		want map[string]any
+	}{
+		{
+			name: "creative category is dropped",
+			in:   map[string]any{"minecraft:creative_category": map[string]any{"category": "nature"}},
+			want: map[string]any{},
+		},
+		{
+			name: "collision box",
+			in: map[string]any{
+				"minecraft:collision_box": map[string]any{"enabled": uint8(1), "origin": []any{float32(-8), float32(0), int32(-8)}, "size": []float32{16, 8, 16}},
+				"minecraft:selection_box": map[string]any{"enabled": uint8(0)},
+			},
+			want: map[string]any{
+				"minecraft:collision_box": map[string]any{"origin": []float32{-8, 0, -8}, "size": []float32{16, 8, 16}},
+				"minecraft:selection_box": false,
+			},
+		},
+		{
+			name: "full box",
+			in:   map[string]any{"minecraft:collision_box": map[string]any{"enabled": uint8(1)}},
+			want: map[string]any{"minecraft:collision_box": true},
+		},
+		{
+			name: "geometry",
+			in: map[string]any{
+				"minecraft:geometry": map[string]any{"identifier": "geometry.lamp", "culling": ""},
+			},
+			want: map[string]any{"minecraft:geometry": "geometry.lamp"},
+		},
+		{
+			name: "geometry with bones",
+			in: map[string]any{
+				"minecraft:geometry": map[string]any{
+					"identifier": "geometry.lamp",
+					"bone_visibility": map[string]any{
+						"top":  uint8(0),
+						"side": map[string]any{"expression": "q.block_state('test:on')"},
+					},
+					"culling": "test:culling",
+				},
+			},
+			want: map[string]any{"minecraft:geometry": map[string]any{
+				"identifier":      "geometry.lamp",
+				"bone_visibility": map[string]any{"top": false, "side": "q.block_state('test:on')"},
+				"culling":         "test:culling",
+			}},
+		},
+		{
+			name: "material instances",
+			in: map[string]any{
+				"minecraft:material_instances": map[string]any{
+					"mappings": map[string]any{"north": "up"},
+					"materials": map[string]any{
+						"up": map[string]any{"texture": "lamp_top", "render_method": "opaque", "ambient_occlusion": uint8(1), "face_dimming": uint8(0)},
+					},
+				},
+			},
+			want: map[string]any{"minecraft:material_instances": map[string]any{
+				"north": "up",
+				"up":    map[string]any{"texture": "lamp_top", "render_method": "opaque", "ambient_occlusion": true, "face_dimming": false},
+				"*":     map[string]any{"texture": "lamp_top", "render_method": "opaque", "ambient_occlusion": true, "face_dimming": false},
+			}},
+		},
+		{
+			name: "transformation",
+			in: map[string]any{
+				"minecraft:transformation": map[string]any{
+					"TX": float32(1), "TY": float32(0), "TZ": float32(0),
+					"SX": float32(1), "SY": float32(2), "SZ": float32(1),
+					"RX": int32(0), "RY": int32(1), "RZ": int32(2),
+				},
+			},
+			want: map[string]any{"minecraft:transformation": map[string]any{
+				"translation": []float32{1, 0, 0},
+				"scale":       []float32{1, 2, 1},
+				"rotation":    []float32{0, 90, 180},
+			}},
+		},
+		{
+			name: "light and destruction",
+			in: map[string]any{
+				"minecraft:light_emission":            map[string]any{"emission": uint8(7)},
+				"minecraft:light_dampening":           map[string]any{"lightLevel": uint8(15)},
+				"minecraft:destructible_by_mining":    map[string]any{"value": float32(1.5)},
+				"minecraft:destructible_by_explosion": map[string]any{"explosion_resistance": int32(30)},
+			},
+			want: map[string]any{
+				"minecraft:light_emission":            7,
+				"minecraft:light_dampening":           15,
+				"minecraft:destructible_by_mining":    map[string]any{"seconds_to_destroy": float32(1.5)},
+				"minecraft:destructible_by_explosion": map[string]any{"explosion_resistance": float32(30)},
+			},
+		},
+		{
+			name: "default friction is left out",
+			in:   map[string]any{"minecraft:friction": map[string]any{"value": float32(0.4)}},
+			want: map[string]any{},
+		},
+		{
+			name: "friction",
+			in:   map[string]any{"minecraft:friction": map[string]any{"value": float32(0.1)}},
+			want: map[string]any{"minecraft:friction": float32(0.1)},
+		},
+		{
+			name: "map color",
+			in:   map[string]any{"minecraft:map_color": map[string]any{"color": int32(-0xff0100)}},
+			want: map[string]any{"minecraft:map_color": "#00ff00"},
+		},
+		{
+			name: "map color string",
+			in:   map[string]any{"minecraft:map_color": map[string]any{"color": "#123456"}},
+			want: map[string]any{"minecraft:map_color": "#123456"},
+		},
+		{
+			name: "placement filter",
+			in: map[string]any{"minecraft:placement_filter": map[string]any{"conditions": []any{
+				map[string]any{
+					"allowed_faces": uint8(0b10),
+					"block_filter": []any{
+						map[string]any{"name": "minecraft:dirt"},
+						map[string]any{"name": "minecraft:stone", "states": map[string]any{"stone_type": "granite"}},
+					},
+				},
+				map[string]any{"allowed_faces": uint8(0b111111)},
+			}}},
+			want: map[string]any{"minecraft:placement_filter": map[string]any{"conditions": []any{
+				map[string]any{
+					"allowed_faces": []string{"up"},
+					"block_filter": []any{
+						"minecraft:dirt",
+						map[string]any{"name": "minecraft:stone", "states": map[string]any{"stone_type": "granite"}},
+					},
+				},
+				map[string]any{"allowed_faces": []string{"all"}},
+			}}},
+		},
+		{
+			name: "event triggers, single values and the rest",
+			in: map[string]any{
+				"minecraft:on_interact":  map[string]any{"triggerType": "test:toggle", "condition": ""},
+				"minecraft:display_name": map[string]any{"value": "Lamp"},
+				"minecraft:flammable":    map[string]any{"value": uint8(1)},
+				"minecraft:loot":         "loot_tables/lamp.json",
+				"test:custom":            map[string]any{"a": int32(1), "b": int32(2)},
+			},
+			want: map[string]any{
+				"minecraft:on_interact":  map[string]any{"event": "test:toggle"},
+				"minecraft:display_name": "Lamp",
+				"minecraft:flammable":    uint8(1),
+				"minecraft:loot":         "loot_tables/lamp.json",
+				"test:custom":            map[string]any{"a": int32(1), "b": int32(2)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := convertBlockComponents(tt.in)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\ngot  %#v\nwant %#v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package behaviourpack
 
 import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
 	"github.com/sandertv/gophertunnel/minecraft/protocol"
 )
 
@@ -53,54 +56,139 @@ func (bp *Pack) AddEntity(entity EntityIn) {
 		}
 	}
 
+	components := entry.MinecraftEntity.Components
 	for _, av := range entity.Attr {
-		m := map[string]int{
-			"value": int(av.Value),
-			"min":   int(av.Min),
-		}
-
-		if av.Max > 0 && av.Max < 0xffffff {
-			m["max"] = int(av.Max)
+		if name, component := attributeComponent(av); component != nil {
+			components[name] = component
 		}
-
-		entry.MinecraftEntity.Components[av.Name] = m
 	}
 
-	if scale, ok := entity.Meta[protocol.EntityDataKeyScale].(float32); ok {
-		entry.MinecraftEntity.Components["minecraft:scale"] = map[string]any{
+	scale, ok := entity.Meta[protocol.EntityDataKeyScale].(float32)
+	if ok {
+		components["minecraft:scale"] = map[string]any{
 			"value": scale,
 		}
+	} else if old, ok := components["minecraft:scale"].(map[string]any); ok {
+		scale, _ = old["value"].(float32)
+	}
+	if scale <= 0 {
+		scale = 1
 	}
 
+	// the size the server sends is already scaled, the collision box is scaled by minecraft:scale again
 	width, widthOk := entity.Meta[protocol.EntityDataKeyWidth].(float32)
 	height, heightOk := entity.Meta[protocol.EntityDataKeyHeight].(float32)
 	if widthOk || heightOk {
-		entry.MinecraftEntity.Components["minecraft:collision_box"] = map[string]any{
-			"width":  width,
-			"height": height,
+		if old, ok := components["minecraft:collision_box"].(map[string]any); ok {
+			if w, ok := old["width"].(float32); ok && !widthOk {
+				width = w * scale
+			}
+			if h, ok := old["height"].(float32); ok && !heightOk {
+				height = h * scale
+			}
+		}
+		components["minecraft:collision_box"] = map[string]any{
+			"width":  width / scale,
+			"height": height / scale,
 		}
 	}
 
 	if _, ok := entity.Meta[protocol.EntityDataKeyFlags]; ok {
 		AlwaysShowName := entity.Meta.Flag(protocol.EntityDataKeyFlags, protocol.EntityDataFlagAlwaysShowName)
 		if AlwaysShowName {
-			entry.MinecraftEntity.Components["minecraft:nameable"] = map[string]any{
+			components["minecraft:nameable"] = map[string]any{
 				"always_show": true,
 			}
 		}
+
+		components["minecraft:physics"] = map[string]any{
+			"has_gravity":   entity.Meta.Flag(protocol.EntityDataKeyFlags, protocol.EntityDataFlagHasGravity),
+			"has_collision": entity.Meta.Flag(protocol.EntityDataKeyFlags, protocol.EntityDataFlagHasCollision),
+		}
+		if entity.Meta.Flag(protocol.EntityDataKeyFlags, protocol.EntityDataFlagFireImmune) {
+			components["minecraft:fire_immune"] = true
+		}
+	} else if _, ok := components["minecraft:physics"]; !ok {
+		components["minecraft:physics"] = map[string]any{}
+	}
+
+	if seat := seatFromMeta(entity.Meta); seat != nil {
+		rideable, ok := components["minecraft:rideable"].(map[string]any)
+		if !ok {
+			rideable = map[string]any{
+				"seat_count":   1,
+				"family_types": []string{"player"},
+				"seats":        []any{seat},
+			}
+			components["minecraft:rideable"] = rideable
+		} else {
+			rideable["seats"] = []any{seat}
+		}
 	}
 
-	entry.MinecraftEntity.Components["minecraft:pushable"] = map[string]any{
+	components["minecraft:pushable"] = map[string]any{
 		"is_pushable":           false,
 		"is_pushable_by_piston": false,
 	}
-	entry.MinecraftEntity.Components["minecraft:damage_sensor"] = map[string]any{
+	components["minecraft:damage_sensor"] = map[string]any{
 		"triggers": map[string]any{
 			"deals_damage": false,
 		},
 	}
-	entry.MinecraftEntity.Components["minecraft:is_stackable"] = map[string]any{}
-	entry.MinecraftEntity.Components["minecraft:push_through"] = 1
+	components["minecraft:is_stackable"] = map[string]any{}
+	components["minecraft:push_through"] = 1
 
 	bp.entities[entity.Identifier] = entry
 }
+
+// attributeComponent returns the component that gives an entity the attribute passed,
+// attributes that do not have a matching component return nil
+func attributeComponent(av protocol.AttributeValue) (string, any) {
+	switch av.Name {
+	case "minecraft:health":
+		m := map[string]any{
+			"value": int(math.Ceil(float64(av.Value))),
+		}
+		if av.Max > 0 && av.Max < 0xffffff {
+			m["max"] = int(math.Ceil(float64(av.Max)))
+		}
+		return av.Name, m
+	case "minecraft:follow_range":
+		m := map[string]any{
+			"value": int(av.Value),
+		}
+		if av.Max > 0 && av.Max < 0xffffff {
+			m["max"] = int(av.Max)
+		}
+		return av.Name, m
+	case "minecraft:movement", "minecraft:underwater_movement", "minecraft:lava_movement", "minecraft:knockback_resistance":
+		return av.Name, map[string]any{
+			"value": av.Value,
+		}
+	case "minecraft:attack_damage":
+		return "minecraft:attack", map[string]any{
+			"damage": av.Value,
+		}
+	}
+	return "", nil
+}
+
+// seatFromMeta creates a rideable seat from the seat metadata of an entity
+func seatFromMeta(meta protocol.EntityMetadata) map[string]any {
+	offset, ok := meta[protocol.EntityDataKeySeatOffset].(mgl32.Vec3)
+	if !ok {
+		return nil
+	}
+	seat := map[string]any{
+		"position": []float32{offset[0], offset[1], offset[2]},
+	}
+	if lock, ok := meta[protocol.EntityDataKeySeatLockPassengerRotation].(byte); ok && lock != 0 {
+		if degrees, ok := meta[protocol.EntityDataKeySeatLockPassengerRotationDegrees].(float32); ok {
+			seat["lock_rider_rotation"] = degrees
+		}
+	}
+	if degrees, ok := meta[protocol.EntityDataKeySeatRotationOffstDegrees].(float32); ok {
+		seat["rotate_rider_by"] = degrees
+	}
+	return seat
+}
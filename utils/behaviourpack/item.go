@@ -16,6 +16,8 @@ type minecraftItem struct {
 type itemBehaviour struct {
 	FormatVersion string        `json:"format_version"`
 	MinecraftItem minecraftItem `json:"minecraft:item"`
+
+	icon string
 }
 
 func (bp *Pack) AddItem(item protocol.ItemEntry) {
@@ -43,7 +45,47 @@ func (bp *Pack) ApplyComponentEntries(entries []protocol.ItemComponentEntry) {
 			continue
 		}
 		if components, ok := ice.Data["components"].(map[string]any); ok {
+			item.icon = itemIcon(components)
+			if props, ok := components["item_properties"].(map[string]any); ok {
+				// the icon is sent in item_properties but is a component of its own in the behaviour
+				if _, ok := props["minecraft:icon"]; ok && item.icon != "" {
+					components["minecraft:icon"] = map[string]any{
+						"texture": item.icon,
+					}
+				}
+			}
 			item.MinecraftItem.Components = components
 		}
 	}
 }
+
+// itemIcon returns the name of the icon the item uses,
+// {"texture": "name"} or {"textures": {"default": "name"}}
+func itemIcon(components map[string]any) string {
+	icon, ok := components["minecraft:icon"].(map[string]any)
+	if !ok {
+		props, _ := components["item_properties"].(map[string]any)
+		icon, _ = props["minecraft:icon"].(map[string]any)
+	}
+	if name, ok := icon["texture"].(string); ok {
+		return name
+	}
+	if textures, ok := icon["textures"].(map[string]any); ok {
+		if name, ok := textures["default"].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// ItemIcons returns the icon name of every custom item, empty if it has none
+func (bp *Pack) ItemIcons() map[string]string {
+	icons := make(map[string]string)
+	for name, item := range bp.items {
+		if _, ok := bp.blocks[name]; ok {
+			continue
+		}
+		icons[name] = item.icon
+	}
+	return icons
+}
@@ -172,3 +172,18 @@ func Chunk2Img(c *chunk.Chunk) *image.RGBA {
 	}
 	return img
 }
+
+// Chunk2HeightImg draws the height of the top block of every column, higher is brighter
+func Chunk2HeightImg(c *chunk.Chunk) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	hm := c.HeightMapWithWater()
+	r := c.Range()
+
+	for x := uint8(0); x < 16; x++ {
+		for z := uint8(0); z < 16; z++ {
+			v := uint8(min(max((int(hm.At(x, z))-r.Min())*0xff/max(r.Height(), 1), 0), 0xff))
+			img.SetRGBA(int(x), int(z), color.RGBA{R: v, G: v, B: v, A: 0xff})
+		}
+	}
+	return img
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/sandertv/go-raknet"
+	"github.com/sandertv/gophertunnel/minecraft"
+)
+
+// DefaultListenAddress listens on all ipv4 and ipv6 addresses
+const DefaultListenAddress = ":19132"
+
+// ListenConfig is how the proxy shows up for clients, it is shared by every subcommand that listens
+type ListenConfig struct {
+	// address and port to listen on, "[::1]:19132" for ipv6
+	Address string
+	// name shown in the server list, "<server> Proxy" if empty
+	MOTD string
+	// player counts shown in the server list, 0 shows the real ones
+	PlayerCount int
+	MaxPlayers  int
+	// show the name and player counts of the server instead
+	MirrorStatus bool
+	// dont answer status pings, so the proxy is not shown in the LAN tab.
+	// it can still be joined by adding it as a server.
+	HideFromLAN bool
+}
+
+// GetAddress returns the address to listen on
+func (c *ListenConfig) GetAddress() string {
+	if c.Address == "" {
+		return DefaultListenAddress
+	}
+	return c.Address
+}
+
+// Network returns the network minecraft.ListenConfig.Listen uses
+func (c *ListenConfig) Network() string {
+	if c.HideFromLAN {
+		return "raknet-hidden"
+	}
+	return "raknet"
+}
+
+// StatusProvider returns what is shown in the server list for a proxy to the server passed,
+// close has to be called when the listener is closed.
+func (c *ListenConfig) StatusProvider(serverName, serverAddress string) (provider minecraft.ServerStatusProvider, close func()) {
+	if c.MirrorStatus && serverAddress != "" {
+		foreign, err := minecraft.NewForeignStatusProvider(serverAddress)
+		if err == nil {
+			return foreign, func() { foreign.Close() }
+		}
+	}
+	motd := c.MOTD
+	if motd == "" {
+		motd = fmt.Sprintf("%s Proxy", serverName)
+	}
+	return statusProvider{motd: motd, playerCount: c.PlayerCount, maxPlayers: c.MaxPlayers}, func() {}
+}
+
+type statusProvider struct {
+	motd        string
+	playerCount int
+	maxPlayers  int
+}
+
+func (s statusProvider) ServerStatus(playerCount, maxPlayers int) minecraft.ServerStatus {
+	if s.playerCount != 0 {
+		playerCount = s.playerCount
+	}
+	if s.maxPlayers != 0 {
+		maxPlayers = s.maxPlayers
+	}
+	return minecraft.ServerStatus{
+		ServerName:  s.motd,
+		PlayerCount: playerCount,
+		MaxPlayers:  maxPlayers,
+	}
+}
+
+// ListenRaknet starts a raknet listener with the config, for proxies that dont use minecraft.Listener
+func (c *ListenConfig) ListenRaknet() (*raknet.Listener, error) {
+	cfg := raknet.ListenConfig{}
+	if c.HideFromLAN {
+		cfg.UpstreamPacketListener = hiddenPacketListener{}
+	}
+	return cfg.Listen(c.GetAddress())
+}
+
+// hiddenNetwork is raknet without answering unconnected pings
+type hiddenNetwork struct {
+	minecraft.RakNet
+}
+
+func (hiddenNetwork) Listen(address string) (minecraft.NetworkListener, error) {
+	return raknet.ListenConfig{UpstreamPacketListener: hiddenPacketListener{}}.Listen(address)
+}
+
+type hiddenPacketListener struct{}
+
+func (hiddenPacketListener) ListenPacket(network, address string) (net.PacketConn, error) {
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return hiddenPacketConn{conn}, nil
+}
+
+// hiddenPacketConn drops unconnected pings, the LAN tab and server list use them for the status
+type hiddenPacketConn struct {
+	net.PacketConn
+}
+
+func (c hiddenPacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	for {
+		n, addr, err = c.PacketConn.ReadFrom(b)
+		if err != nil || n == 0 {
+			return
+		}
+		// unconnected ping and unconnected ping open connections
+		if b[0] == 0x01 || b[0] == 0x02 {
+			continue
+		}
+		return
+	}
+}
+
+func init() {
+	minecraft.RegisterNetwork("raknet-hidden", hiddenNetwork{})
+}
@@ -0,0 +1,132 @@
+package nbtconv
+
+import (
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/df-mc/dragonfly/server/world/chunk"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// ItemNames maps the network runtime IDs of items to their identifiers. It is built from the item entries sent in
+// the StartGame packet, so it includes custom items that dragonfly has no implementation for.
+type ItemNames map[int32]string
+
+// NewItemNames creates an ItemNames table from the item entries passed.
+func NewItemNames(entries []protocol.ItemEntry) ItemNames {
+	n := make(ItemNames, len(entries))
+	for _, ie := range entries {
+		n[int32(ie.RuntimeID)] = ie.Name
+	}
+	return n
+}
+
+// Name returns the identifier of the item with the network ID passed. If the item is not in the table, dragonfly's
+// item registry is used as a fallback.
+func (n ItemNames) Name(networkID int32, meta int16) (string, bool) {
+	if name, ok := n[networkID]; ok {
+		return name, true
+	}
+	if it, ok := world.ItemByRuntimeID(networkID, meta); ok {
+		name, _ := it.EncodeItem()
+		return name, true
+	}
+	return "", false
+}
+
+// StackToNBT encodes a network item stack into the map the game stores on disk. The identifier and all NBT the
+// server sent with the item are kept as is, instead of being passed through a dragonfly item.Stack. Empty stacks
+// and items that cannot be resolved return nil.
+func (n ItemNames) StackToNBT(s protocol.ItemStack) map[string]any {
+	if s.NetworkID == 0 || s.Count == 0 {
+		return nil
+	}
+	name, ok := n.Name(s.NetworkID, int16(s.MetadataValue))
+	if !ok {
+		return nil
+	}
+
+	m := map[string]any{
+		"Name":        name,
+		"Count":       byte(s.Count),
+		"Damage":      int16(s.MetadataValue),
+		"WasPickedUp": byte(0),
+	}
+	if s.BlockRuntimeID > 0 {
+		if b, ok := world.BlockByRuntimeID(uint32(s.BlockRuntimeID)); ok {
+			m["Block"] = WriteBlock(b)
+		}
+	}
+	if len(s.NBTData) > 0 {
+		m["tag"] = n.convertTag(s.NBTData)
+	}
+	if len(s.CanBePlacedOn) > 0 {
+		m["CanPlaceOn"] = s.CanBePlacedOn
+	}
+	if len(s.CanBreak) > 0 {
+		m["CanDestroy"] = s.CanBreak
+	}
+	return m
+}
+
+// InstancesToNBT encodes a list of item instances, such as the content of a container, to a slice of item maps
+// that each have their Slot set. Empty slots are left out.
+func (n ItemNames) InstancesToNBT(items []protocol.ItemInstance) []map[string]any {
+	var out []map[string]any
+	for i, ii := range items {
+		m := n.StackToNBT(ii.Stack)
+		if m == nil {
+			continue
+		}
+		m["Slot"] = byte(i)
+		out = append(out, m)
+	}
+	return out
+}
+
+// convertTag copies the NBT of a network item. Most of it is identical to the disk format, but items nested inside
+// of it, such as the content of shulker boxes or bundles, may be sent with runtime IDs instead of names.
+func (n ItemNames) convertTag(tag map[string]any) map[string]any {
+	out := make(map[string]any, len(tag))
+	for k, v := range tag {
+		out[k] = v
+	}
+	if items, ok := out["Items"].([]any); ok {
+		converted := make([]any, 0, len(items))
+		for _, it := range items {
+			m, ok := it.(map[string]any)
+			if !ok {
+				continue
+			}
+			converted = append(converted, n.convertNestedItem(m))
+		}
+		out["Items"] = converted
+	}
+	if d, ok := out["Damage"].(int16); ok {
+		out["Damage"] = int32(d)
+	}
+	return out
+}
+
+// convertNestedItem fixes up an item compound found inside the NBT of another item.
+func (n ItemNames) convertNestedItem(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	if _, ok := out["Name"].(string); !ok {
+		if id, ok := out["id"].(int32); ok {
+			if name, ok := n.Name(id, Int16(out, "Damage")); ok {
+				out["Name"] = name
+			}
+			delete(out, "id")
+		}
+	}
+	if tag, ok := out["tag"].(map[string]any); ok {
+		out["tag"] = n.convertTag(tag)
+	}
+	if b, ok := out["Block"].(map[string]any); ok {
+		if _, ok := b["version"]; !ok {
+			b["version"] = chunk.CurrentBlockVersion
+		}
+	}
+	return out
+}
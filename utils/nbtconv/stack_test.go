@@ -0,0 +1,58 @@
+package nbtconv
+
+import (
+	"testing"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+func TestStackToNBTKeepsUnknownItems(t *testing.T) {
+	names := NewItemNames([]protocol.ItemEntry{
+		{Name: "custom:wand", RuntimeID: 1000, ComponentBased: true},
+		{Name: "minecraft:shulker_box", RuntimeID: 218},
+	})
+
+	m := names.StackToNBT(protocol.ItemStack{
+		ItemType: protocol.ItemType{NetworkID: 1000},
+		Count:    3,
+		NBTData: map[string]any{
+			"display": map[string]any{"Name": "Wand"},
+			"custom":  int32(5),
+		},
+	})
+	if m["Name"] != "custom:wand" {
+		t.Fatalf("unexpected name %v", m["Name"])
+	}
+	if m["Count"] != byte(3) {
+		t.Fatalf("unexpected count %v", m["Count"])
+	}
+	tag := m["tag"].(map[string]any)
+	if tag["custom"] != int32(5) {
+		t.Fatalf("nbt was not kept: %v", tag)
+	}
+
+	m = names.StackToNBT(protocol.ItemStack{
+		ItemType: protocol.ItemType{NetworkID: 218},
+		Count:    1,
+		NBTData: map[string]any{
+			"Items": []any{
+				map[string]any{"id": int32(1000), "Count": byte(1), "Slot": byte(0)},
+			},
+		},
+	})
+	nested := m["tag"].(map[string]any)["Items"].([]any)[0].(map[string]any)
+	if nested["Name"] != "custom:wand" {
+		t.Fatalf("nested item was not resolved: %v", nested)
+	}
+}
+
+func TestInstancesToNBTSkipsEmpty(t *testing.T) {
+	names := NewItemNames([]protocol.ItemEntry{{Name: "custom:gem", RuntimeID: 1001}})
+	out := names.InstancesToNBT([]protocol.ItemInstance{
+		{},
+		{Stack: protocol.ItemStack{ItemType: protocol.ItemType{NetworkID: 1001}, Count: 1}},
+	})
+	if len(out) != 1 || out[0]["Slot"] != byte(1) {
+		t.Fatalf("unexpected output %v", out)
+	}
+}
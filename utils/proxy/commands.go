@@ -0,0 +1,469 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// ParamType is what a command parameter accepts
+type ParamType int
+
+const (
+	// one word or a "quoted string"
+	ParamString ParamType = iota
+	// everything until the end of the line
+	ParamText
+	ParamInt
+	ParamFloat
+	ParamBool
+	// x y z, each can be relative to the player like ~ or ~-5
+	ParamPosition
+	// one of CommandParam.Enum
+	ParamEnum
+	// every word until the end of the line, a "quoted string" is one word
+	ParamWords
+)
+
+// CommandParam is a parameter of a command overload
+type CommandParam struct {
+	Name     string
+	Type     ParamType
+	Optional bool
+	// values a ParamEnum accepts
+	Enum []string
+}
+
+// CommandOverload is one way a command can be called
+type CommandOverload struct {
+	Params []CommandParam
+	// an error is shown to the player
+	Run func(args CommandArgs) error
+}
+
+// Command is an in-game command the proxy handles itself, the server never sees it
+type Command struct {
+	Name        string
+	Description string
+	Aliases     []string
+	// tried in order, the first one that the arguments fit is run
+	Overloads []CommandOverload
+}
+
+// CommandArgs are the parsed arguments of a command
+type CommandArgs struct {
+	values map[string]any
+}
+
+// Has is true if the optional parameter was given
+func (a CommandArgs) Has(name string) bool {
+	_, ok := a.values[name]
+	return ok
+}
+
+// String returns a ParamString, ParamText or ParamEnum parameter
+func (a CommandArgs) String(name string) string {
+	s, _ := a.values[name].(string)
+	return s
+}
+
+func (a CommandArgs) Int(name string) int {
+	i, _ := a.values[name].(int)
+	return i
+}
+
+func (a CommandArgs) Float(name string) float64 {
+	f, _ := a.values[name].(float64)
+	return f
+}
+
+func (a CommandArgs) Bool(name string) bool {
+	b, _ := a.values[name].(bool)
+	return b
+}
+
+// Words returns a ParamWords parameter
+func (a CommandArgs) Words(name string) []string {
+	w, _ := a.values[name].([]string)
+	return w
+}
+
+// Position returns a ParamPosition parameter, relative coordinates are already resolved
+func (a CommandArgs) Position(name string) mgl32.Vec3 {
+	v, _ := a.values[name].(mgl32.Vec3)
+	return v
+}
+
+// RegisterCommand adds a command, it replaces server commands with the same name
+func (p *Context) RegisterCommand(cmd Command) {
+	c := &cmd
+	p.commandsLock.Lock()
+	defer p.commandsLock.Unlock()
+	p.commands[cmd.Name] = c
+	for _, alias := range cmd.Aliases {
+		p.commands[alias] = c
+	}
+}
+
+// RemoveCommand removes a command added with RegisterCommand together with its aliases
+func (p *Context) RemoveCommand(name string) {
+	p.commandsLock.Lock()
+	defer p.commandsLock.Unlock()
+	cmd, ok := p.commands[name]
+	if !ok || cmd.Name != name {
+		return
+	}
+	delete(p.commands, name)
+	for _, alias := range cmd.Aliases {
+		if p.commands[alias] == cmd {
+			delete(p.commands, alias)
+		}
+	}
+}
+
+// command returns the command with the name or alias
+func (p *Context) command(name string) (*Command, bool) {
+	p.commandsLock.RLock()
+	defer p.commandsLock.RUnlock()
+	cmd, ok := p.commands[name]
+	return cmd, ok
+}
+
+// sortedCommands returns each command once, sorted by name
+func (p *Context) sortedCommands() []*Command {
+	p.commandsLock.RLock()
+	var cmds []*Command
+	for name, cmd := range p.commands {
+		if name == cmd.Name {
+			cmds = append(cmds, cmd)
+		}
+	}
+	p.commandsLock.RUnlock()
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].Name < cmds[j].Name
+	})
+	return cmds
+}
+
+func (p *Context) commandHandlerPacketCB(pk packet.Packet, toServer bool, _ time.Time, _ bool) (packet.Packet, error) {
+	switch pk := pk.(type) {
+	case *packet.CommandRequest:
+		name, rest, _ := strings.Cut(strings.TrimPrefix(pk.CommandLine, "/"), " ")
+		cmd, ok := p.command(name)
+		if !ok {
+			break
+		}
+		if err := p.runCommand(cmd, rest); err != nil {
+			p.SendMessage("§c" + err.Error())
+		}
+		return nil, nil
+	case *packet.AvailableCommands:
+		p.addAvailableCommands(pk)
+	}
+	return pk, nil
+}
+
+// runCommand runs the first overload the arguments fit
+func (p *Context) runCommand(cmd *Command, line string) error {
+	var parseErr error
+	for _, overload := range cmd.Overloads {
+		args, err := p.parseArgs(overload.Params, line)
+		if err != nil {
+			if parseErr == nil {
+				parseErr = err
+			}
+			continue
+		}
+		return overload.Run(args)
+	}
+	if len(cmd.Overloads) > 1 {
+		return fmt.Errorf("invalid arguments, usage:\n%s", commandUsage(cmd))
+	}
+	return parseErr
+}
+
+type token struct {
+	text  string
+	start int
+}
+
+// tokenize splits a command line into words, "quoted strings" are one word
+func tokenize(line string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(line); {
+		if line[i] == ' ' {
+			i++
+			continue
+		}
+		start := i
+		if line[i] != '"' {
+			for i < len(line) && line[i] != ' ' {
+				i++
+			}
+			tokens = append(tokens, token{line[start:i], start})
+			continue
+		}
+
+		var b strings.Builder
+		i++
+		for ; i < len(line) && line[i] != '"'; i++ {
+			if line[i] == '\\' && i+1 < len(line) {
+				i++
+			}
+			b.WriteByte(line[i])
+		}
+		if i == len(line) {
+			return nil, errors.New("missing closing quote")
+		}
+		i++
+		tokens = append(tokens, token{b.String(), start})
+	}
+	return tokens, nil
+}
+
+func (p *Context) parseArgs(params []CommandParam, line string) (CommandArgs, error) {
+	args := CommandArgs{values: make(map[string]any)}
+	tokens, err := tokenize(line)
+	if err != nil {
+		return args, err
+	}
+
+	for _, param := range params {
+		if len(tokens) == 0 {
+			if param.Optional {
+				break
+			}
+			return args, fmt.Errorf("missing %s", param.Name)
+		}
+		tok := tokens[0]
+		tokens = tokens[1:]
+
+		switch param.Type {
+		case ParamString:
+			args.values[param.Name] = tok.text
+		case ParamText:
+			args.values[param.Name] = strings.TrimSpace(line[tok.start:])
+			tokens = nil
+		case ParamWords:
+			words := []string{tok.text}
+			for _, t := range tokens {
+				words = append(words, t.text)
+			}
+			args.values[param.Name] = words
+			tokens = nil
+		case ParamInt:
+			i, err := strconv.Atoi(tok.text)
+			if err != nil {
+				return args, fmt.Errorf("%s: %q is not a whole number", param.Name, tok.text)
+			}
+			args.values[param.Name] = i
+		case ParamFloat:
+			f, err := strconv.ParseFloat(tok.text, 64)
+			if err != nil {
+				return args, fmt.Errorf("%s: %q is not a number", param.Name, tok.text)
+			}
+			args.values[param.Name] = f
+		case ParamBool:
+			b, err := strconv.ParseBool(tok.text)
+			if err != nil {
+				return args, fmt.Errorf("%s: expected true or false, got %q", param.Name, tok.text)
+			}
+			args.values[param.Name] = b
+		case ParamEnum:
+			i := slices.IndexFunc(param.Enum, func(s string) bool { return strings.EqualFold(s, tok.text) })
+			if i < 0 {
+				return args, fmt.Errorf("%s: expected one of %s", param.Name, strings.Join(param.Enum, ", "))
+			}
+			args.values[param.Name] = param.Enum[i]
+		case ParamPosition:
+			if len(tokens) < 2 {
+				return args, fmt.Errorf("%s: expected x y z", param.Name)
+			}
+			var pos mgl32.Vec3
+			for axis, t := range []token{tok, tokens[0], tokens[1]} {
+				v, err := parseCoordinate(t.text, p.Player.Position[axis])
+				if err != nil {
+					return args, fmt.Errorf("%s: %w", param.Name, err)
+				}
+				pos[axis] = v
+			}
+			tokens = tokens[2:]
+			args.values[param.Name] = pos
+		}
+	}
+	if len(tokens) > 0 {
+		return args, fmt.Errorf("too many arguments at %q", tokens[0].text)
+	}
+	return args, nil
+}
+
+// parseCoordinate parses a coordinate, ~ is relative to the player
+func parseCoordinate(s string, player float32) (float32, error) {
+	var base float32
+	if rest, ok := strings.CutPrefix(s, "~"); ok {
+		base = player
+		s = rest
+		if s == "" {
+			return base, nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 32)
+	if err != nil || math.IsNaN(f) {
+		return 0, fmt.Errorf("%q is not a coordinate", s)
+	}
+	return base + float32(f), nil
+}
+
+func (t ParamType) String() string {
+	switch t {
+	case ParamString:
+		return "string"
+	case ParamText:
+		return "text"
+	case ParamInt:
+		return "int"
+	case ParamFloat:
+		return "float"
+	case ParamBool:
+		return "bool"
+	case ParamPosition:
+		return "x y z"
+	case ParamEnum:
+		return "enum"
+	case ParamWords:
+		return "words"
+	}
+	return "unknown"
+}
+
+// commandUsage returns a line for every overload of the command
+func commandUsage(cmd *Command) string {
+	var lines []string
+	for _, overload := range cmd.Overloads {
+		line := "/" + cmd.Name
+		for _, param := range overload.Params {
+			typ := param.Type.String()
+			if param.Type == ParamEnum {
+				typ = strings.Join(param.Enum, "|")
+			}
+			if param.Optional {
+				line += fmt.Sprintf(" [%s: %s]", param.Name, typ)
+			} else {
+				line += fmt.Sprintf(" <%s: %s>", param.Name, typ)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// addAvailableCommands adds the commands to the ones the server sent, so the client can autocomplete them
+func (p *Context) addAvailableCommands(pk *packet.AvailableCommands) {
+	valueIndex := make(map[string]uint, len(pk.EnumValues))
+	for i, v := range pk.EnumValues {
+		valueIndex[v] = uint(i)
+	}
+	addEnum := func(typ string, values []string) uint32 {
+		indices := make([]uint, len(values))
+		for i, v := range values {
+			idx, ok := valueIndex[v]
+			if !ok {
+				idx = uint(len(pk.EnumValues))
+				pk.EnumValues = append(pk.EnumValues, v)
+				valueIndex[v] = idx
+			}
+			indices[i] = idx
+		}
+		pk.Enums = append(pk.Enums, protocol.CommandEnum{Type: typ, ValueIndices: indices})
+		return uint32(len(pk.Enums) - 1)
+	}
+
+	// ours replace the ones of the server
+	cmds := p.sortedCommands()
+	pk.Commands = slices.DeleteFunc(pk.Commands, func(c protocol.Command) bool {
+		return slices.ContainsFunc(cmds, func(cmd *Command) bool {
+			return cmd.Name == c.Name || slices.Contains(cmd.Aliases, c.Name)
+		})
+	})
+
+	var boolEnum uint32
+	haveBoolEnum := false
+	for _, cmd := range cmds {
+		pc := protocol.Command{
+			Name:          cmd.Name,
+			Description:   cmd.Description,
+			AliasesOffset: math.MaxUint32,
+		}
+		if len(cmd.Aliases) > 0 {
+			pc.AliasesOffset = addEnum(cmd.Name+"Aliases", append([]string{cmd.Name}, cmd.Aliases...))
+		}
+		for _, overload := range cmd.Overloads {
+			var po protocol.CommandOverload
+			for _, param := range overload.Params {
+				pp := protocol.CommandParameter{Name: param.Name, Optional: param.Optional}
+				switch param.Type {
+				case ParamString:
+					pp.Type = protocol.CommandArgValid | protocol.CommandArgTypeString
+				case ParamText, ParamWords:
+					pp.Type = protocol.CommandArgValid | protocol.CommandArgTypeRawText
+				case ParamInt:
+					pp.Type = protocol.CommandArgValid | protocol.CommandArgTypeInt
+				case ParamFloat:
+					pp.Type = protocol.CommandArgValid | protocol.CommandArgTypeFloat
+				case ParamPosition:
+					pp.Type = protocol.CommandArgValid | protocol.CommandArgTypePosition
+				case ParamBool:
+					if !haveBoolEnum {
+						boolEnum = addEnum("bt_bool", []string{"true", "false"})
+						haveBoolEnum = true
+					}
+					pp.Type = protocol.CommandArgValid | protocol.CommandArgEnum | boolEnum
+				case ParamEnum:
+					pp.Type = protocol.CommandArgValid | protocol.CommandArgEnum | addEnum("bt_"+cmd.Name+"_"+param.Name, param.Enum)
+				}
+				po.Parameters = append(po.Parameters, pp)
+			}
+			pc.Overloads = append(pc.Overloads, po)
+		}
+		pk.Commands = append(pk.Commands, pc)
+	}
+}
+
+// helpCommand is /bt help, it lists the commands of the proxy
+func (p *Context) helpCommand() Command {
+	return Command{
+		Name:        "bt",
+		Description: "bedrocktool commands",
+		Overloads: []CommandOverload{{
+			Params: []CommandParam{
+				{Name: "help", Type: ParamEnum, Enum: []string{"help"}, Optional: true},
+				{Name: "command", Type: ParamString, Optional: true},
+			},
+			Run: func(args CommandArgs) error {
+				if args.Has("command") {
+					cmd, ok := p.command(strings.TrimPrefix(args.String("command"), "/"))
+					if !ok {
+						return fmt.Errorf("unknown command %s", args.String("command"))
+					}
+					p.SendMessage(cmd.Description + "\n" + commandUsage(cmd))
+					return nil
+				}
+				var lines []string
+				for _, cmd := range p.sortedCommands() {
+					lines = append(lines, fmt.Sprintf("§b/%s§r %s", cmd.Name, cmd.Description))
+				}
+				p.SendMessage("Commands:\n" + strings.Join(lines, "\n"))
+				return nil
+			},
+		}},
+	}
+}
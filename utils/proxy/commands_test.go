@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{line: "", want: nil},
+		{line: "a b  c", want: []string{"a", "b", "c"}},
+		{line: `"hello world" x`, want: []string{"hello world", "x"}},
+		{line: `"say \"hi\""`, want: []string{`say "hi"`}},
+		{line: `""`, want: []string{""}},
+		{line: `"unterminated`, wantErr: true},
+	}
+	for _, tt := range tests {
+		tokens, err := tokenize(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("tokenize(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		var got []string
+		for _, tok := range tokens {
+			got = append(got, tok.text)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseCoordinate(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    float32
+		wantErr bool
+	}{
+		{s: "5", want: 5},
+		{s: "-2.5", want: -2.5},
+		{s: "~", want: 10},
+		{s: "~3", want: 13},
+		{s: "~-4", want: 6},
+		{s: "x", wantErr: true},
+		{s: "~x", wantErr: true},
+		{s: "NaN", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseCoordinate(tt.s, 10)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCoordinate(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseCoordinate(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	p := &Context{}
+	p.Player.Position = mgl32.Vec3{1, 2, 3}
+
+	tests := []struct {
+		name    string
+		params  []CommandParam
+		line    string
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			name:   "string and int",
+			params: []CommandParam{{Name: "s", Type: ParamString}, {Name: "i", Type: ParamInt}},
+			line:   `"a b" 7`,
+			want:   map[string]any{"s": "a b", "i": 7},
+		},
+		{
+			name:   "text takes the rest",
+			params: []CommandParam{{Name: "i", Type: ParamInt}, {Name: "t", Type: ParamText}},
+			line:   `1 hello   "world"`,
+			want:   map[string]any{"i": 1, "t": `hello   "world"`},
+		},
+		{
+			name:   "words keep quoted strings",
+			params: []CommandParam{{Name: "s", Type: ParamString}, {Name: "w", Type: ParamWords}},
+			line:   `go "a b"  c`,
+			want:   map[string]any{"s": "go", "w": []string{"a b", "c"}},
+		},
+		{
+			name:   "float and bool",
+			params: []CommandParam{{Name: "f", Type: ParamFloat}, {Name: "b", Type: ParamBool}},
+			line:   "0.5 true",
+			want:   map[string]any{"f": 0.5, "b": true},
+		},
+		{
+			name:   "enum is case insensitive",
+			params: []CommandParam{{Name: "e", Type: ParamEnum, Enum: []string{"on", "off"}}},
+			line:   "OFF",
+			want:   map[string]any{"e": "off"},
+		},
+		{
+			name:   "relative position",
+			params: []CommandParam{{Name: "pos", Type: ParamPosition}},
+			line:   "~ ~1 5",
+			want:   map[string]any{"pos": mgl32.Vec3{1, 3, 5}},
+		},
+		{
+			name:   "optional missing",
+			params: []CommandParam{{Name: "a", Type: ParamString}, {Name: "b", Type: ParamInt, Optional: true}},
+			line:   "x",
+			want:   map[string]any{"a": "x"},
+		},
+		{
+			name:    "required missing",
+			params:  []CommandParam{{Name: "a", Type: ParamString}},
+			line:    "",
+			wantErr: true,
+		},
+		{
+			name:    "not an int",
+			params:  []CommandParam{{Name: "i", Type: ParamInt}},
+			line:    "1.5",
+			wantErr: true,
+		},
+		{
+			name:    "not in enum",
+			params:  []CommandParam{{Name: "e", Type: ParamEnum, Enum: []string{"on", "off"}}},
+			line:    "maybe",
+			wantErr: true,
+		},
+		{
+			name:    "position too short",
+			params:  []CommandParam{{Name: "pos", Type: ParamPosition}},
+			line:    "1 2",
+			wantErr: true,
+		},
+		{
+			name:    "too many arguments",
+			params:  []CommandParam{{Name: "a", Type: ParamString}},
+			line:    "x y",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		args, err := p.parseArgs(tt.params, tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(args.values, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, args.values, tt.want)
+		}
+	}
+}
+
+func TestRunCommandOverloads(t *testing.T) {
+	p := &Context{}
+	var ran string
+	cmd := &Command{
+		Name: "test",
+		Overloads: []CommandOverload{
+			{
+				Params: []CommandParam{{Name: "n", Type: ParamInt}},
+				Run: func(args CommandArgs) error {
+					ran = "int"
+					return nil
+				},
+			},
+			{
+				Params: []CommandParam{{Name: "s", Type: ParamString}},
+				Run: func(args CommandArgs) error {
+					ran = "string " + args.String("s")
+					return nil
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		line    string
+		want    string
+		wantErr bool
+	}{
+		{line: "5", want: "int"},
+		{line: "five", want: "string five"},
+		{line: "a b", wantErr: true},
+	}
+	for _, tt := range tests {
+		ran = ""
+		err := p.runCommand(cmd, tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("runCommand(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if ran != tt.want {
+			t.Errorf("runCommand(%q) ran %q, want %q", tt.line, ran, tt.want)
+		}
+	}
+}
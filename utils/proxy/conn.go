@@ -2,8 +2,10 @@ package proxy
 
 import (
 	"context"
-	"fmt"
 	"net"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/bedrock-tool/bedrocktool/locale"
 	"github.com/bedrock-tool/bedrocktool/ui/messages"
@@ -15,7 +17,7 @@ import (
 )
 
 func (p *Context) onResourcePacksInfo() {
-	messages.Router.Handle(&messages.Message{
+	p.UI(&messages.Message{
 		Source: "proxy",
 		Target: "ui",
 		Data:   messages.ConnectStateReceivingResources,
@@ -23,7 +25,7 @@ func (p *Context) onResourcePacksInfo() {
 }
 
 func (p *Context) onFinishedPack(pack *resource.Pack) {
-	messages.Router.Handle(&messages.Message{
+	p.UI(&messages.Message{
 		Source: "proxy",
 		Target: "ui",
 		Data:   messages.FinishedPack{Pack: pack},
@@ -39,7 +41,7 @@ func (p *Context) connectServer(ctx context.Context) (err error) {
 		}
 	}
 
-	messages.Router.Handle(&messages.Message{
+	p.UI(&messages.Message{
 		Source: "proxy",
 		Target: "ui",
 		Data:   messages.ConnectStateServerConnecting,
@@ -75,12 +77,25 @@ func (p *Context) connectServer(ctx context.Context) (err error) {
 	}
 
 	server, err := d.DialContext(ctx, "raknet", p.serverAddress)
+	// when reconnecting the server may still be restarting, the client waits for it
+	for err != nil && p.reconnecting && p.reconnectAttempts < p.Options.Reconnect.Attempts {
+		delay := p.Options.Reconnect.backoff(p.reconnectAttempts)
+		p.reconnectAttempts++
+		logrus.Warnf("reconnecting failed (%s), trying again in %s", err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		server, err = d.DialContext(ctx, "raknet", p.serverAddress)
+	}
 	if err != nil {
 		return err
 	}
 	p.Server = server
+	p.connectedAt = time.Now()
 
-	messages.Router.Handle(&messages.Message{
+	p.UI(&messages.Message{
 		Source: "proxy",
 		Target: "ui",
 		Data:   messages.ConnectStateEstablished,
@@ -89,15 +104,26 @@ func (p *Context) connectServer(ctx context.Context) (err error) {
 	return nil
 }
 
-func (p *Context) connectClient(ctx context.Context, serverAddress string) (err error) {
+// listen starts the listener clients connect to, name is shown in the server list
+func (p *Context) listen(ctx context.Context, name string) (err error) {
 	var extraClientDebug func(pk packet.Packet)
 	var extraClientDebugEnd func()
-	if p.ExtraDebug {
+	if p.Options.ExtraDebug {
 		extraClientDebug, extraClientDebugEnd = newExtraDebug("packets-client.log")
 	}
 
+	mirrorAddress := p.serverAddress
+	if strings.HasPrefix(mirrorAddress, "PCAP!") {
+		mirrorAddress = ""
+	}
+	statusProvider, closeStatus := p.Options.Listen.StatusProvider(name, mirrorAddress)
+	go func() {
+		<-ctx.Done()
+		closeStatus()
+	}()
+
 	p.listener, err = minecraft.ListenConfig{
-		StatusProvider: minecraft.NewStatusProvider(fmt.Sprintf("%s Proxy", serverAddress)),
+		StatusProvider: statusProvider,
 		PacketFunc: func(header packet.Header, payload []byte, src, dst net.Addr) {
 			if extraClientDebug != nil {
 				pk, ok := DecodePacket(header, payload)
@@ -108,36 +134,53 @@ func (p *Context) connectClient(ctx context.Context, serverAddress string) (err
 			}
 		},
 		OnClientData: func(c *minecraft.Conn) {
+			if minecraft.IConn(c) != p.Client {
+				return
+			}
 			p.clientData = c.ClientData()
 			close(p.haveClientData)
 		},
 		EarlyConnHandler: func(c *minecraft.Conn) {
+			// the first client is the player, everyone after that is a spectator
+			if !p.clientTaken.CompareAndSwap(false, true) {
+				return
+			}
 			p.Client = c
 			p.rpHandler.SetClient(c)
 			c.ResourcePackHandler = p.rpHandler
 			close(p.clientConnecting)
 		},
-	}.Listen("raknet", ":19132")
+	}.Listen(p.Options.Listen.Network(), p.Options.Listen.GetAddress())
 	if err != nil {
 		return err
 	}
 
-	messages.Router.Handle(&messages.Message{
+	p.UI(&messages.Message{
 		Source: "proxy",
 		Target: "ui",
 		Data:   messages.ConnectStateListening,
 	})
 	logrus.Infof(locale.Loc("listening_on", locale.Strmap{"Address": p.listener.Addr()}))
-	logrus.Infof(locale.Loc("help_connect", nil))
 
-	var accepted = false
+	if extraClientDebugEnd != nil {
+		go func() {
+			<-ctx.Done()
+			extraClientDebugEnd()
+		}()
+	}
+	return nil
+}
+
+func (p *Context) connectClient(ctx context.Context, serverAddress string) (err error) {
+	if err = p.listen(ctx, serverAddress); err != nil {
+		return err
+	}
+	logrus.Infof(locale.Loc("help_connect", nil))
 
+	var accepted atomic.Bool
 	go func() {
 		<-ctx.Done()
-		if extraClientDebugEnd != nil {
-			extraClientDebugEnd()
-		}
-		if !accepted {
+		if !accepted.Load() {
 			_ = p.listener.Close()
 		}
 	}()
@@ -146,7 +189,36 @@ func (p *Context) connectClient(ctx context.Context, serverAddress string) (err
 	if err != nil {
 		return err
 	}
-	accepted = true
+	accepted.Store(true)
 	p.Client = c.(*minecraft.Conn)
+
+	if p.spectators != nil {
+		go p.acceptSpectators(ctx)
+	}
 	return nil
 }
+
+// acceptSpectators lets more clients join the session as spectators, until the listener is closed
+func (p *Context) acceptSpectators(ctx context.Context) {
+	for {
+		c, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		conn := c.(*minecraft.Conn)
+		if p.spectators.full() {
+			_ = p.listener.Disconnect(conn, "This session has no room for more spectators")
+			continue
+		}
+		go p.spectators.join(ctx, conn, func() {
+			name := conn.IdentityData().DisplayName
+			logrus.Infof("%s is spectating", name)
+			p.SendMessage(name + " is spectating")
+			for _, handler := range p.handlers {
+				if handler.OnSpectatorConnect != nil {
+					handler.OnSpectatorConnect(conn)
+				}
+			}
+		})
+	}
+}
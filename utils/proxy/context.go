@@ -13,13 +13,13 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bedrock-tool/bedrocktool/ui/messages"
 	"github.com/bedrock-tool/bedrocktool/utils"
 	"github.com/gregwebs/go-recovery"
 	"github.com/sandertv/gophertunnel/minecraft"
-	"github.com/sandertv/gophertunnel/minecraft/protocol"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
 	"github.com/sandertv/gophertunnel/minecraft/resource"
@@ -28,12 +28,12 @@ import (
 )
 
 type Context struct {
-	Server       minecraft.IConn
-	Client       minecraft.IConn
-	listener     *minecraft.Listener
-	Player       Player
-	ExtraDebug   bool
-	PlayerMoveCB []func()
+	Server   minecraft.IConn
+	Client   minecraft.IConn
+	listener *minecraft.Listener
+	Player   Player
+	// settings of this session, change them before calling Run
+	Options Options
 
 	withClient bool
 	addedPacks []*resource.Pack
@@ -44,33 +44,53 @@ type Context struct {
 	haveClientData   chan struct{}
 	clientData       login.ClientData
 	clientAddr       net.Addr
-	spawned          bool
+	clientTaken      atomic.Bool
+	spectators       *spectators
+	spawned          atomic.Bool
 	disconnectReason string
 	serverAddress    string
 	serverName       string
+	// the server connection was lost and this session continues the last one
+	reconnecting bool
+	// tries since the last stable connection, see ReconnectPolicy
+	reconnectAttempts int
+	connectedAt       time.Time
+
+	// commands can be registered from other goroutines, like when scripts are reloaded
+	commandsLock sync.RWMutex
+	commands     map[string]*Command
 
-	commands  map[string]ingameCommand
 	handlers  []*Handler
+	filter    *packetFilter
+	events    eventBus
 	transfer  *packet.Transfer
 	rpHandler *rpHandler
+
+	// packets being handled by the proxy loops, for injections ordered around them
+	handling           sync.Map
+	toClient, toServer *injectQueue
+
+	// forms shown by the proxy waiting for a response
+	formsLock  sync.Mutex
+	forms      map[uint32]*pendingForm
+	nextFormID uint32
 }
 
 // New creates a new proxy context
 func New(withClient bool) (*Context, error) {
 	p := &Context{
-		commands:         make(map[string]ingameCommand),
+		Options:          DefaultOptions(),
+		commands:         make(map[string]*Command),
+		toClient:         &injectQueue{},
+		toServer:         &injectQueue{},
+		forms:            make(map[uint32]*pendingForm),
 		withClient:       withClient,
 		disconnectReason: "Connection Lost",
 	}
+	p.RegisterCommand(p.helpCommand())
 	return p, nil
 }
 
-// AddCommand adds a command to the command handler
-func (p *Context) AddCommand(exec func([]string) bool, cmd protocol.Command) {
-	cmd.AliasesOffset = 0xffffffff
-	p.commands[cmd.Name] = ingameCommand{exec, cmd}
-}
-
 // ClientWritePacket sends a packet to the client, nop if no client connected
 func (p *Context) ClientWritePacket(pk packet.Packet) error {
 	if p.Client == nil {
@@ -81,7 +101,7 @@ func (p *Context) ClientWritePacket(pk packet.Packet) error {
 
 // SendMessage sends a chat message to the client
 func (p *Context) SendMessage(text string) {
-	_ = p.ClientWritePacket(&packet.Text{
+	p.InjectToClient(&packet.Text{
 		TextType: packet.TextTypeSystem,
 		Message:  "§8[§bBedrocktool§8]§r " + text,
 	})
@@ -89,7 +109,7 @@ func (p *Context) SendMessage(text string) {
 
 // SendPopup sends a toolbar popup to the client
 func (p *Context) SendPopup(text string) {
-	_ = p.ClientWritePacket(&packet.Text{
+	p.InjectToClient(&packet.Text{
 		TextType: packet.TextTypePopup,
 		Message:  text,
 	})
@@ -100,25 +120,6 @@ func (p *Context) AddHandler(handler *Handler) {
 	p.handlers = append(p.handlers, handler)
 }
 
-func (p *Context) commandHandlerPacketCB(pk packet.Packet, toServer bool, _ time.Time, _ bool) (packet.Packet, error) {
-	switch _pk := pk.(type) {
-	case *packet.CommandRequest:
-		cmd := strings.Split(_pk.CommandLine, " ")
-		name := cmd[0][1:]
-		if h, ok := p.commands[name]; ok {
-			pk = nil
-			h.Exec(cmd[1:])
-		}
-	case *packet.AvailableCommands:
-		cmds := make([]protocol.Command, 0, len(p.commands))
-		for _, ic := range p.commands {
-			cmds = append(cmds, ic.Cmd)
-		}
-		_pk.Commands = append(_pk.Commands, cmds...)
-	}
-	return pk, nil
-}
-
 func (p *Context) proxyLoop(ctx context.Context, toServer bool) (err error) {
 	var c1, c2 minecraft.IConn
 	if toServer {
@@ -128,6 +129,8 @@ func (p *Context) proxyLoop(ctx context.Context, toServer bool) (err error) {
 		c1 = p.Server
 		c2 = p.Client
 	}
+	// after spawning packets nobody wants are passed on without decoding them
+	raw := p.newRawReader(c1, c2, toServer)
 
 	if false {
 		defer func() {
@@ -146,8 +149,17 @@ func (p *Context) proxyLoop(ctx context.Context, toServer bool) (err error) {
 			return ctx.Err()
 		}
 
-		pk, err := c1.ReadPacket()
+		var pk packet.Packet
+		if raw != nil && p.spawned.Load() {
+			pk, err = raw.read()
+		} else {
+			pk, err = c1.ReadPacket()
+		}
 		if err != nil {
+			if !toServer && ctx.Err() == nil && p.canReconnect(err) {
+				logrus.Warnf("lost the connection to the server: %s", err)
+				return errReconnect
+			}
 			if errors.Is(err, net.ErrClosed) {
 				err = nil
 			}
@@ -155,35 +167,56 @@ func (p *Context) proxyLoop(ctx context.Context, toServer bool) (err error) {
 		}
 
 		pkName := reflect.TypeOf(pk).String()
-		for _, handler := range p.handlers {
-			if handler.PacketCB != nil {
-				pk, err = handler.PacketCB(pk, toServer, time.Now(), false)
-				if err != nil {
-					return err
-				}
+		ordered := &orderedInjections{}
+		handled := []packet.Packet{pk}
+		p.handling.Store(pk, ordered)
+		for i, handler := range p.handlers {
+			if handler.PacketCB != nil && !handler.failed.Load() && p.filter.wants(i, pk.ID()) {
+				pk = p.handlerPacketCB(handler, pk, toServer, time.Now(), false)
 				if pk == nil {
 					logrus.Tracef("Dropped Packet: %s", pkName)
 					break
 				}
+				// handlers after a replacement see the new packet
+				if pk != handled[len(handled)-1] {
+					handled = append(handled, pk)
+					p.handling.Store(pk, ordered)
+				}
 			}
 		}
+		for _, h := range handled {
+			p.handling.Delete(h)
+		}
+		before, after := ordered.take()
+		for _, inj := range before {
+			inj.deliver()
+		}
+
+		if pk != nil && p.spectators != nil {
+			p.spectators.handlePacket(pk, toServer)
+		}
 
 		switch _pk := pk.(type) {
 		case *packet.Transfer:
 			p.transfer = _pk
+			emit(p, Transferring{Address: _pk.Address, Port: _pk.Port})
 			if p.Client != nil {
-				host, port, err := net.SplitHostPort(p.Client.ClientData().ServerAddress)
+				pk, err = p.selfTransfer()
 				if err != nil {
 					return err
 				}
-				// transfer to self
-				_port, _ := strconv.Atoi(port)
-				pk = &packet.Transfer{Address: host, Port: uint16(_port)}
 			}
 		}
 
 		if pk != nil && c2 != nil {
-			if err := c2.WritePacket(pk); err != nil {
+			err := c2.WritePacket(pk)
+			for _, inj := range after {
+				inj.deliver()
+			}
+			if err != nil {
+				if toServer && ctx.Err() == nil && p.canReconnect(err) {
+					return errReconnect
+				}
 				if disconnect, ok := errors.Unwrap(err).(minecraft.DisconnectError); ok {
 					p.disconnectReason = disconnect.Error()
 				}
@@ -192,6 +225,10 @@ func (p *Context) proxyLoop(ctx context.Context, toServer bool) (err error) {
 				}
 				return err
 			}
+		} else {
+			for _, inj := range after {
+				inj.deliver()
+			}
 		}
 
 		if p.transfer != nil {
@@ -200,6 +237,45 @@ func (p *Context) proxyLoop(ctx context.Context, toServer bool) (err error) {
 	}
 }
 
+// selfTransfer returns a transfer packet that makes the client join the proxy again
+func (p *Context) selfTransfer() (*packet.Transfer, error) {
+	host, port, err := net.SplitHostPort(p.Client.ClientData().ServerAddress)
+	if err != nil {
+		return nil, err
+	}
+	_port, _ := strconv.Atoi(port)
+	return &packet.Transfer{Address: host, Port: uint16(_port)}, nil
+}
+
+// canReconnect is true if the session should go on after the server connection ended with err.
+// the server kicking the player is never reconnected.
+func (p *Context) canReconnect(err error) bool {
+	if p.Options.Reconnect.Attempts == 0 || p.Client == nil || strings.HasPrefix(p.serverAddress, "PCAP!") {
+		return false
+	}
+	var disconnect minecraft.DisconnectError
+	if errors.As(err, &disconnect) {
+		return false
+	}
+	return p.reconnectAttempts < p.Options.Reconnect.Attempts || p.connectionStable()
+}
+
+// connectionStable is true if the server connection was up long enough to reset the reconnect attempts
+func (p *Context) connectionStable() bool {
+	return !p.connectedAt.IsZero() && time.Since(p.connectedAt) >= reconnectStableAfter
+}
+
+// sendReconnecting shows the client the loading screen while the proxy connects to the server again
+func (p *Context) sendReconnecting() {
+	p.SendMessage("Lost the connection to the server, reconnecting")
+	pk, err := p.selfTransfer()
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	_ = p.Client.WritePacket(pk)
+}
+
 // Disconnect disconnects both the client and server
 func (p *Context) Disconnect() {
 	p.DisconnectClient()
@@ -237,16 +313,18 @@ func (p *Context) packetFunc(header packet.Header, payload []byte, src, dst net.
 		p.clientAddr = src
 	}
 	if header.PacketID == packet.IDSetLocalPlayerAsInitialised {
-		p.spawned = true
+		p.spawned.Store(true)
 	}
 
 	for _, h := range p.handlers {
-		if h.PacketRaw != nil {
-			h.PacketRaw(header, payload, src, dst)
+		if h.PacketRaw != nil && !h.failed.Load() {
+			p.handlerPacketRaw(h, header, payload, src, dst)
 		}
 	}
 
-	if !p.spawned {
+	spawned := p.spawned.Load()
+	if !spawned && (header.PacketID == packet.IDDimensionData || p.filter.anyWants(header.PacketID)) {
+		// decoded once for all handlers
 		pk, ok := DecodePacket(header, payload)
 		if !ok {
 			return
@@ -257,19 +335,26 @@ func (p *Context) packetFunc(header packet.Header, payload []byte, src, dst net.
 			p.dimensionData = pk
 		}
 
-		var err error
 		toServer := p.IsClient(src)
-		for _, handler := range p.handlers {
-			if handler.PacketCB != nil {
-				pk, err = handler.PacketCB(pk, toServer, time.Now(), !p.spawned)
-				if err != nil {
-					logrus.Error(err)
+		for i, handler := range p.handlers {
+			if handler.PacketCB != nil && !handler.failed.Load() && p.filter.wants(i, pk.ID()) {
+				pk = p.handlerPacketCB(handler, pk, toServer, time.Now(), !spawned)
+				if pk == nil {
+					break
 				}
 			}
 		}
 	}
 }
 
+func (p *Context) endHandlers() {
+	for _, handler := range p.handlers {
+		if handler.OnEnd != nil {
+			handler.OnEnd()
+		}
+	}
+}
+
 func (p *Context) onServerConnect() error {
 	for _, handler := range p.handlers {
 		if handler.OnServerConnect == nil {
@@ -288,10 +373,10 @@ func (p *Context) onServerConnect() error {
 
 func (p *Context) doSession(ctx context.Context, cancel context.CancelCauseFunc) (err error) {
 	defer func() {
-		for _, handler := range p.handlers {
-			if handler.OnEnd != nil {
-				handler.OnEnd()
-			}
+		// handlers keep their state for the next connection
+		emit(p, Disconnected{Reason: p.disconnectReason, Err: err})
+		if !errors.Is(err, errReconnect) {
+			p.endHandlers()
 		}
 	}()
 
@@ -300,24 +385,29 @@ func (p *Context) doSession(ctx context.Context, cancel context.CancelCauseFunc)
 		p.serverName = path.Base(p.serverName)
 	}
 
-	for _, handler := range p.handlers {
-		if handler.AddressAndName != nil {
-			err = handler.AddressAndName(p.serverAddress, p.serverName)
-			if err != nil {
-				return err
+	if !p.reconnecting {
+		for _, handler := range p.handlers {
+			if handler.AddressAndName != nil {
+				err = handler.AddressAndName(p.serverAddress, p.serverName)
+				if err != nil {
+					return err
+				}
 			}
 		}
 	}
 
 	if !isReplay {
 		// ask for login before listening
-		p.tokenSource, err = utils.Auth.GetTokenSource()
-		if err != nil {
-			return err
+		p.tokenSource = p.Options.TokenSource
+		if p.tokenSource == nil {
+			p.tokenSource, err = utils.Auth.GetTokenSource()
+			if err != nil {
+				return err
+			}
 		}
 	}
 
-	messages.Router.Handle(&messages.Message{
+	p.UI(&messages.Message{
 		Source: "proxy",
 		Target: "ui",
 		Data:   messages.ConnectStateBegin,
@@ -332,6 +422,15 @@ func (p *Context) doSession(ctx context.Context, cancel context.CancelCauseFunc)
 			return err
 		}
 		p.Server = server
+
+		// spectators can watch the replay as it plays at the speed it was recorded
+		if p.spectators != nil {
+			server.Realtime()
+			if err = p.listen(ctx, p.serverName); err != nil {
+				return err
+			}
+			go p.acceptSpectators(ctx)
+		}
 	} else {
 		p.rpHandler = newRpHandler(ctx, p.addedPacks)
 		p.rpHandler.OnResourcePacksInfoCB = p.onResourcePacksInfo
@@ -374,6 +473,9 @@ func (p *Context) doSession(ctx context.Context, cancel context.CancelCauseFunc)
 			if p.Client != nil {
 				_ = p.listener.Disconnect(p.Client.(*minecraft.Conn), p.disconnectReason)
 			}
+			if p.spectators != nil {
+				p.spectators.disconnect(p.listener, p.disconnectReason)
+			}
 			_ = p.listener.Close()
 		}()
 	}
@@ -446,9 +548,15 @@ func (p *Context) doSession(ctx context.Context, cancel context.CancelCauseFunc)
 				}
 			}
 		}
+
+		emit(p, Spawned{GameData: gd})
+
+		if p.spectators != nil {
+			p.spectators.start(gd, p.dimensionData)
+		}
 	}
 
-	messages.Router.Handle(&messages.Message{
+	p.UI(&messages.Message{
 		Source: "proxy",
 		Target: "ui",
 		Data:   messages.ConnectStateDone,
@@ -481,7 +589,9 @@ func (p *Context) doSession(ctx context.Context, cancel context.CancelCauseFunc)
 
 		wg.Wait()
 		err = context.Cause(ctx)
-		if err != nil {
+		if errors.Is(err, errReconnect) {
+			p.sendReconnecting()
+		} else if err != nil {
 			p.disconnectReason = err.Error()
 		}
 	}
@@ -490,24 +600,65 @@ func (p *Context) doSession(ctx context.Context, cancel context.CancelCauseFunc)
 }
 
 var errTransfer = errors.New("err transfer")
+var errReconnect = errors.New("reconnecting")
 
 func (p *Context) connect(ctx context.Context) (err error) {
-	p.spawned = false
+	for {
+		err = p.connectOnce(ctx)
+
+		if errors.Is(err, errTransfer) && p.transfer != nil {
+			p.reconnecting = false
+			p.reconnectAttempts = 0
+			p.serverAddress = fmt.Sprintf("%s:%d", p.transfer.Address, p.transfer.Port)
+			logrus.Infof("transferring to %s", p.serverAddress)
+			continue
+		}
+
+		if errors.Is(err, errReconnect) {
+			if ctx.Err() != nil {
+				// stopped while reconnecting
+				p.endHandlers()
+				return nil
+			}
+			if p.connectionStable() {
+				p.reconnectAttempts = 0
+			}
+			// a server that accepts the login and drops the connection again uses up the attempts too
+			p.reconnectAttempts++
+			p.reconnecting = true
+			logrus.Infof("reconnecting to %s (%d/%d)", p.serverAddress, p.reconnectAttempts, p.Options.Reconnect.Attempts)
+			emit(p, Reconnecting{Address: p.serverAddress})
+			for _, handler := range p.handlers {
+				if handler.OnReconnect != nil {
+					handler.OnReconnect()
+				}
+			}
+			continue
+		}
+
+		return err
+	}
+}
+
+// connectOnce runs one session with the server at p.serverAddress
+func (p *Context) connectOnce(ctx context.Context) error {
+	p.spawned.Store(false)
 	p.clientAddr = nil
 	p.transfer = nil
 	p.Client = nil
+	p.listener = nil
+	p.connectedAt = time.Time{}
+	p.spectators = nil
+	if p.Options.Spectators > 0 {
+		p.spectators = newSpectators(p.Options.Spectators)
+	}
+	// replays have no player, everyone connecting is a spectator
+	p.clientTaken.Store(!p.withClient || strings.HasPrefix(p.serverAddress, "PCAP!"))
 	p.clientConnecting = make(chan struct{})
 	p.haveClientData = make(chan struct{})
 	ctx2, cancel := context.WithCancelCause(ctx)
-	err = p.doSession(ctx2, cancel)
+	err := p.doSession(ctx2, cancel)
 	cancel(nil)
-
-	if errors.Is(err, errTransfer) && p.transfer != nil {
-		p.serverAddress = fmt.Sprintf("%s:%d", p.transfer.Address, p.transfer.Port)
-		logrus.Infof("transferring to %s", p.serverAddress)
-		return p.connect(ctx)
-	}
-
 	return err
 }
 
@@ -520,7 +671,7 @@ func (p *Context) Run(ctx context.Context, connectString string) (err error) {
 			return err
 		}
 	} else {
-		resp := messages.Router.Handle(&messages.Message{
+		resp := p.UI(&messages.Message{
 			Source: "proxy",
 			Target: "ui",
 			Data:   &messages.ServerInput{Request: true},
@@ -538,27 +689,28 @@ func (p *Context) Run(ctx context.Context, connectString string) (err error) {
 	}
 	p.serverName = serverInput.Name
 
-	if utils.Options.Debug || utils.Options.ExtraDebug {
-		p.ExtraDebug = utils.Options.ExtraDebug
-		p.AddHandler(NewDebugLogger(utils.Options.ExtraDebug))
+	if p.Options.Debug || p.Options.ExtraDebug {
+		p.AddHandler(NewDebugLogger(p.Options.ExtraDebug))
 	}
-	if utils.Options.Capture {
+	if p.Options.Capture {
 		p.AddHandler(NewPacketCapturer())
 	}
 	p.AddHandler(&Handler{
 		Name:     "Commands",
 		PacketCB: p.commandHandlerPacketCB,
+		Packets:  []uint32{packet.IDCommandRequest, packet.IDAvailableCommands},
 	})
 	p.AddHandler(&Handler{
-		Name: "Player",
-		PacketCB: func(pk packet.Packet, toServer bool, timeReceived time.Time, preLogin bool) (packet.Packet, error) {
-			haveMoved := p.Player.handlePackets(pk)
-			if haveMoved {
-				for _, cb := range p.PlayerMoveCB {
-					cb()
-				}
-			}
-			return pk, nil
+		Name:     "Forms",
+		PacketCB: p.formsPacketCB,
+		Packets:  []uint32{packet.IDModalFormResponse},
+	})
+	p.AddHandler(&Handler{
+		Name:     "Events",
+		PacketCB: p.eventsPacketCB,
+		Packets: []uint32{
+			packet.IDStartGame, packet.IDMovePlayer, packet.IDPlayerAuthInput,
+			packet.IDChangeDimension, packet.IDLevelChunk, packet.IDSubChunk,
 		},
 	})
 
@@ -567,6 +719,7 @@ func (p *Context) Run(ctx context.Context, connectString string) (err error) {
 			handler.ProxyRef(p)
 		}
 	}
+	p.filter = newPacketFilter(p.handlers)
 
 	defer func() {
 		for _, handler := range p.handlers {
@@ -574,7 +727,7 @@ func (p *Context) Run(ctx context.Context, connectString string) (err error) {
 				handler.Deferred()
 			}
 		}
-		messages.Router.Handle(&messages.Message{
+		p.UI(&messages.Message{
 			Source: "proxy",
 			Target: "ui",
 			Data:   messages.UIStateFinished,
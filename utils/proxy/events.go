@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// PlayerMoved is emitted when the position or rotation of the player changed
+type PlayerMoved struct {
+	Position            mgl32.Vec3
+	Pitch, Yaw, HeadYaw float32
+}
+
+// DimensionChanged is emitted when the server moves the player to another dimension
+type DimensionChanged struct {
+	Dimension int32
+	Position  mgl32.Vec3
+}
+
+// ChunkReceived is emitted for every chunk and sub chunk the server sends, one of Chunk and SubChunk is set
+type ChunkReceived struct {
+	Dimension int32
+	Chunk     *packet.LevelChunk
+	SubChunk  *packet.SubChunk
+}
+
+// Spawned is emitted when the player is in the world, after the handlers ConnectCB
+type Spawned struct {
+	GameData minecraft.GameData
+}
+
+// Transferring is emitted when the server sends the player to another server
+type Transferring struct {
+	Address string
+	Port    uint16
+}
+
+// Reconnecting is emitted when the server connection was lost and the proxy connects again
+type Reconnecting struct {
+	Address string
+}
+
+// Disconnected is emitted when the connection to a server ended, also before transferring or reconnecting.
+// Err is why it ended, nil if it ended normally.
+type Disconnected struct {
+	Reason string
+	Err    error
+}
+
+type subscriber struct {
+	id int
+	fn any
+}
+
+// eventBus passes events to the subscribers of their type
+type eventBus struct {
+	l      sync.Mutex
+	nextID int
+	subs   map[reflect.Type][]subscriber
+}
+
+// Subscribe calls fn with every event of type E the proxy emits, until unsubscribe is called.
+// fn runs on the goroutine that emitted the event, it shouldn't block.
+func Subscribe[E any](p *Context, fn func(E)) (unsubscribe func()) {
+	t := reflect.TypeOf((*E)(nil)).Elem()
+	b := &p.events
+	b.l.Lock()
+	defer b.l.Unlock()
+	if b.subs == nil {
+		b.subs = make(map[reflect.Type][]subscriber)
+	}
+	id := b.nextID
+	b.nextID++
+	b.subs[t] = append(b.subs[t], subscriber{id: id, fn: fn})
+
+	return func() {
+		b.remove(t, id)
+	}
+}
+
+// emit calls the subscribers of E in the order they subscribed,
+// a subscriber that panics is removed so the others keep getting events.
+func emit[E any](p *Context, event E) {
+	t := reflect.TypeOf((*E)(nil)).Elem()
+	p.events.l.Lock()
+	subs := p.events.subs[t]
+	p.events.l.Unlock()
+	for _, s := range subs {
+		if err := callSubscriber(s.fn.(func(E)), event); err != nil {
+			p.events.remove(t, s.id)
+			p.subscriberFailed(event, err)
+		}
+	}
+}
+
+func callSubscriber[E any](fn func(E), event E) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v\n%s", rec, debug.Stack())
+		}
+	}()
+	fn(event)
+	return nil
+}
+
+func (b *eventBus) remove(t reflect.Type, id int) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	subs := b.subs[t]
+	for i, s := range subs {
+		if s.id == id {
+			b.subs[t] = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+}
+
+// eventsPacketCB emits the events that come from packets
+func (p *Context) eventsPacketCB(pk packet.Packet, toServer bool, _ time.Time, _ bool) (packet.Packet, error) {
+	if p.Player.handlePackets(pk) {
+		emit(p, PlayerMoved{
+			Position: p.Player.Position,
+			Pitch:    p.Player.Pitch,
+			Yaw:      p.Player.Yaw,
+			HeadYaw:  p.Player.HeadYaw,
+		})
+	}
+	if toServer {
+		return pk, nil
+	}
+
+	switch pk := pk.(type) {
+	case *packet.ChangeDimension:
+		emit(p, DimensionChanged{Dimension: pk.Dimension, Position: pk.Position})
+	case *packet.LevelChunk:
+		emit(p, ChunkReceived{Dimension: pk.Dimension, Chunk: pk})
+	case *packet.SubChunk:
+		emit(p, ChunkReceived{Dimension: pk.Dimension, SubChunk: pk})
+	}
+	return pk, nil
+}
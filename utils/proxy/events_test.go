@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+func TestSubscribeOrderAndUnsubscribe(t *testing.T) {
+	p := &Context{}
+	var got []string
+	unsubscribeA := Subscribe(p, func(e Transferring) {
+		got = append(got, "a "+e.Address)
+	})
+	Subscribe(p, func(e Transferring) {
+		got = append(got, "b "+e.Address)
+	})
+	// other event types don't get it
+	Subscribe(p, func(e Reconnecting) {
+		got = append(got, "reconnecting")
+	})
+
+	emit(p, Transferring{Address: "one"})
+	unsubscribeA()
+	emit(p, Transferring{Address: "two"})
+	// unsubscribing twice does nothing
+	unsubscribeA()
+
+	want := []string{"a one", "b one", "b two"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestEmitWithoutSubscribers(t *testing.T) {
+	p := &Context{}
+	emit(p, Disconnected{Reason: "test"})
+}
+
+func TestPanickingSubscriberIsRemoved(t *testing.T) {
+	p := &Context{}
+	calls := 0
+	Subscribe(p, func(e Spawned) {
+		panic("broken")
+	})
+	Subscribe(p, func(e Spawned) {
+		calls++
+	})
+
+	emit(p, Spawned{})
+	emit(p, Spawned{})
+	if calls != 2 {
+		t.Fatalf("the working subscriber was called %d times, want 2", calls)
+	}
+	if n := len(p.events.subs[reflect.TypeOf(Spawned{})]); n != 1 {
+		t.Fatalf("%d subscribers left, want 1", n)
+	}
+}
+
+func TestEventsFromPackets(t *testing.T) {
+	p := &Context{}
+	var chunks []ChunkReceived
+	var dims []DimensionChanged
+	var moves []PlayerMoved
+	Subscribe(p, func(e ChunkReceived) { chunks = append(chunks, e) })
+	Subscribe(p, func(e DimensionChanged) { dims = append(dims, e) })
+	Subscribe(p, func(e PlayerMoved) { moves = append(moves, e) })
+
+	pks := []struct {
+		pk       packet.Packet
+		toServer bool
+	}{
+		{&packet.LevelChunk{Position: protocol.ChunkPos{1, 2}}, false},
+		{&packet.SubChunk{Dimension: 1}, false},
+		{&packet.ChangeDimension{Dimension: 2, Position: mgl32.Vec3{1, 2, 3}}, false},
+		{&packet.PlayerAuthInput{Position: mgl32.Vec3{4, 5, 6}}, true},
+		// what the client sends is only used for movement
+		{&packet.LevelChunk{}, true},
+	}
+	for _, tt := range pks {
+		if _, err := p.eventsPacketCB(tt.pk, tt.toServer, time.Time{}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(chunks) != 2 || chunks[0].Chunk == nil || chunks[1].SubChunk == nil || chunks[1].Dimension != 1 {
+		t.Fatalf("unexpected chunk events %+v", chunks)
+	}
+	if len(dims) != 1 || dims[0].Dimension != 2 || dims[0].Position != (mgl32.Vec3{1, 2, 3}) {
+		t.Fatalf("unexpected dimension events %+v", dims)
+	}
+	if len(moves) != 1 || moves[0].Position != (mgl32.Vec3{4, 5, 6}) {
+		t.Fatalf("unexpected move events %+v", moves)
+	}
+}
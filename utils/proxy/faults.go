@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/bedrock-tool/bedrocktool/ui/messages"
+	"github.com/bedrock-tool/bedrocktool/utils"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/sirupsen/logrus"
+)
+
+// a handler that panics or returns an error is disabled, the session keeps going without it.
+
+// handlerPacketCB calls the PacketCB of handler, returning the packet unchanged if the handler failed
+func (p *Context) handlerPacketCB(handler *Handler, pk packet.Packet, toServer bool, timeReceived time.Time, preLogin bool) (out packet.Packet) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			p.handlerFailed(handler, fmt.Sprintf("%T", pk), dumpPacket(pk), fmt.Errorf("panic: %v\n%s", rec, debug.Stack()))
+			out = pk
+		}
+	}()
+	out, err := handler.PacketCB(pk, toServer, timeReceived, preLogin)
+	if err != nil {
+		p.handlerFailed(handler, fmt.Sprintf("%T", pk), dumpPacket(pk), err)
+		return pk
+	}
+	return out
+}
+
+// handlerPacketRaw calls the PacketRaw of handler
+func (p *Context) handlerPacketRaw(handler *Handler, header packet.Header, payload []byte, src, dst net.Addr) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			p.handlerFailed(handler, fmt.Sprintf("packet 0x%02x", header.PacketID), hex.Dump(payload), fmt.Errorf("panic: %v\n%s", rec, debug.Stack()))
+		}
+	}()
+	handler.PacketRaw(header, payload, src, dst)
+}
+
+// dumpPacket writes out the fields of pk so the failure can be reproduced
+func dumpPacket(pk packet.Packet) (dump string) {
+	defer func() {
+		// a packet broken enough to crash the dump is still reported
+		if rec := recover(); rec != nil {
+			dump = fmt.Sprintf("%+v", pk)
+		}
+	}()
+	var b strings.Builder
+	utils.DumpStruct(&b, pk)
+	return b.String()
+}
+
+// handlerFailed disables the handler and tells the user, only the first failure is reported
+func (p *Context) handlerFailed(handler *Handler, packetName, dump string, err error) {
+	if !handler.failed.CompareAndSwap(false, true) {
+		return
+	}
+	logrus.Errorf("Handler %s failed on %s and was disabled: %s\n%s", handler.Name, packetName, err, dump)
+	p.SendMessage(fmt.Sprintf("§c%s stopped working, the session goes on without it", handler.Name))
+	p.UI(&messages.Message{
+		Source: "proxy",
+		Target: "ui",
+		Data: messages.HandlerFailed{
+			Handler: handler.Name,
+			Packet:  packetName,
+			Dump:    dump,
+			Err:     err,
+		},
+	})
+}
+
+// subscriberFailed tells the user that an event subscriber panicked and was removed
+func (p *Context) subscriberFailed(event any, err error) {
+	eventName := fmt.Sprintf("%T", event)
+	logrus.Errorf("A subscriber of %s failed and was removed: %s", eventName, err)
+	p.SendMessage(fmt.Sprintf("§cA subscriber of %s stopped working, the session goes on without it", eventName))
+	p.UI(&messages.Message{
+		Source: "proxy",
+		Target: "ui",
+		Data: messages.HandlerFailed{
+			Handler: eventName + " subscriber",
+			Packet:  eventName,
+			Err:     err,
+		},
+	})
+}
@@ -0,0 +1,238 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/sirupsen/logrus"
+)
+
+// forms of the proxy use ids far from the ones servers use
+const formIDBase = 0x7b740000
+
+// the client says it is busy while chat is open, the form is sent again this often before giving up
+const formBusyRetries = 20
+
+// Form is a form the proxy shows to the client, the response never reaches the server
+type Form interface {
+	formData() map[string]any
+	handleResponse(data []byte) error
+}
+
+// MenuButton is a button of a MenuForm
+type MenuButton struct {
+	Text    string
+	OnClick func()
+}
+
+// MenuForm is a list of buttons
+type MenuForm struct {
+	Title   string
+	Content string
+	Buttons []MenuButton
+}
+
+func (f *MenuForm) formData() map[string]any {
+	buttons := make([]map[string]any, len(f.Buttons))
+	for i, b := range f.Buttons {
+		buttons[i] = map[string]any{"text": b.Text}
+	}
+	return map[string]any{
+		"type":    "form",
+		"title":   f.Title,
+		"content": f.Content,
+		"buttons": buttons,
+	}
+}
+
+func (f *MenuForm) handleResponse(data []byte) error {
+	var index int
+	if err := json.Unmarshal(data, &index); err != nil {
+		return err
+	}
+	if index < 0 || index >= len(f.Buttons) {
+		return fmt.Errorf("no button %d", index)
+	}
+	if f.Buttons[index].OnClick != nil {
+		f.Buttons[index].OnClick()
+	}
+	return nil
+}
+
+// FormElement is an input of a SettingsForm
+type FormElement interface {
+	elementData() map[string]any
+	// value converts the response of the element, nil for elements without a value
+	value(raw json.RawMessage) (any, error)
+}
+
+// FormLabel is text, its value is nil
+type FormLabel struct {
+	Text string
+}
+
+// FormToggle is a switch, its value is a bool
+type FormToggle struct {
+	Text    string
+	Default bool
+}
+
+// FormInput is a text field, its value is a string
+type FormInput struct {
+	Text        string
+	Placeholder string
+	Default     string
+}
+
+// FormDropdown lets the player pick one option, its value is the index as int
+type FormDropdown struct {
+	Text    string
+	Options []string
+	Default int
+}
+
+func (e FormLabel) elementData() map[string]any {
+	return map[string]any{"type": "label", "text": e.Text}
+}
+
+func (e FormLabel) value(json.RawMessage) (any, error) {
+	return nil, nil
+}
+
+func (e FormToggle) elementData() map[string]any {
+	return map[string]any{"type": "toggle", "text": e.Text, "default": e.Default}
+}
+
+func (e FormToggle) value(raw json.RawMessage) (any, error) {
+	var b bool
+	err := json.Unmarshal(raw, &b)
+	return b, err
+}
+
+func (e FormInput) elementData() map[string]any {
+	return map[string]any{"type": "input", "text": e.Text, "placeholder": e.Placeholder, "default": e.Default}
+}
+
+func (e FormInput) value(raw json.RawMessage) (any, error) {
+	var s string
+	err := json.Unmarshal(raw, &s)
+	return s, err
+}
+
+func (e FormDropdown) elementData() map[string]any {
+	return map[string]any{"type": "dropdown", "text": e.Text, "options": e.Options, "default": e.Default}
+}
+
+func (e FormDropdown) value(raw json.RawMessage) (any, error) {
+	var i int
+	if err := json.Unmarshal(raw, &i); err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= len(e.Options) {
+		return nil, fmt.Errorf("%s: no option %d", e.Text, i)
+	}
+	return i, nil
+}
+
+// SettingsForm is a list of inputs, OnSubmit gets their values in the same order
+type SettingsForm struct {
+	Title    string
+	Elements []FormElement
+	OnSubmit func(values []any)
+}
+
+func (f *SettingsForm) formData() map[string]any {
+	content := make([]map[string]any, len(f.Elements))
+	for i, e := range f.Elements {
+		content[i] = e.elementData()
+	}
+	return map[string]any{
+		"type":    "custom_form",
+		"title":   f.Title,
+		"content": content,
+	}
+}
+
+func (f *SettingsForm) handleResponse(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) != len(f.Elements) {
+		return fmt.Errorf("expected %d values, got %d", len(f.Elements), len(raw))
+	}
+	values := make([]any, len(raw))
+	for i, e := range f.Elements {
+		v, err := e.value(raw[i])
+		if err != nil {
+			return err
+		}
+		values[i] = v
+	}
+	if f.OnSubmit != nil {
+		f.OnSubmit(values)
+	}
+	return nil
+}
+
+type pendingForm struct {
+	form  Form
+	data  []byte
+	tries int
+}
+
+// ShowForm shows a form to the client
+func (p *Context) ShowForm(form Form) {
+	data, err := json.Marshal(form.formData())
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	p.formsLock.Lock()
+	id := formIDBase + p.nextFormID
+	p.nextFormID++
+	p.forms[id] = &pendingForm{form: form, data: data}
+	p.formsLock.Unlock()
+	p.InjectToClient(&packet.ModalFormRequest{FormID: id, FormData: data})
+}
+
+// formsPacketCB takes the responses to the forms of the proxy out before they reach the server
+func (p *Context) formsPacketCB(pk packet.Packet, toServer bool, _ time.Time, _ bool) (packet.Packet, error) {
+	resp, ok := pk.(*packet.ModalFormResponse)
+	if !ok || !toServer {
+		return pk, nil
+	}
+	p.formsLock.Lock()
+	pending, ok := p.forms[resp.FormID]
+	delete(p.forms, resp.FormID)
+	p.formsLock.Unlock()
+	if !ok {
+		return pk, nil
+	}
+
+	if reason, cancelled := resp.CancelReason.Value(); cancelled {
+		if reason == packet.ModalFormCancelReasonUserBusy && pending.tries < formBusyRetries {
+			pending.tries++
+			p.formsLock.Lock()
+			p.forms[resp.FormID] = pending
+			p.formsLock.Unlock()
+			time.AfterFunc(500*time.Millisecond, func() {
+				p.InjectToClient(&packet.ModalFormRequest{FormID: resp.FormID, FormData: pending.data})
+			})
+		}
+		return nil, nil
+	}
+
+	data, ok := resp.ResponseData.Value()
+	// closing the form sends null
+	if !ok || string(bytes.TrimSpace(data)) == "null" {
+		return nil, nil
+	}
+	if err := pending.form.handleResponse(data); err != nil {
+		p.SendMessage("§c" + err.Error())
+	}
+	return nil, nil
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+var errNotConnected = errors.New("not connected")
+
+// Injection is a packet the proxy sends on its own, next to the packets it passes through
+type Injection struct {
+	Packet   packet.Packet
+	ToServer bool
+	// send it right before or after a packet that is being handled,
+	// when that packet isn't being handled it is queued like any other.
+	Before, After packet.Packet
+	// called when the packet was written, err is set if it couldn't be
+	Delivered func(err error)
+}
+
+// Inject sends a packet to the client or server without blocking.
+// queued packets are sent in the order they were injected, at most Options.InjectRate per second.
+func (p *Context) Inject(inj Injection) {
+	conn := p.Client
+	if inj.ToServer {
+		conn = p.Server
+	}
+	if conn == nil {
+		if inj.Delivered != nil {
+			inj.Delivered(errNotConnected)
+		}
+		return
+	}
+
+	if handled := inj.Before; handled != nil || inj.After != nil {
+		before := handled != nil
+		if !before {
+			handled = inj.After
+		}
+		if o, ok := p.handling.Load(handled); ok && o.(*orderedInjections).add(conn, inj, before) {
+			return
+		}
+	}
+
+	q := p.toClient
+	if inj.ToServer {
+		q = p.toServer
+	}
+	q.push(conn, inj, p.Options.InjectRate)
+}
+
+// InjectToClient queues a packet for the client
+func (p *Context) InjectToClient(pk packet.Packet) {
+	p.Inject(Injection{Packet: pk})
+}
+
+// InjectToServer queues a packet for the server
+func (p *Context) InjectToServer(pk packet.Packet) {
+	p.Inject(Injection{Packet: pk, ToServer: true})
+}
+
+type queuedInjection struct {
+	conn minecraft.IConn
+	Injection
+}
+
+func (q queuedInjection) deliver() {
+	err := q.conn.WritePacket(q.Packet)
+	if q.Delivered != nil {
+		q.Delivered(err)
+	}
+}
+
+// orderedInjections are sent by the proxy loop around the packet it is handling
+type orderedInjections struct {
+	l             sync.Mutex
+	done          bool
+	before, after []queuedInjection
+}
+
+func (o *orderedInjections) add(conn minecraft.IConn, inj Injection, before bool) bool {
+	o.l.Lock()
+	defer o.l.Unlock()
+	if o.done {
+		return false
+	}
+	if before {
+		o.before = append(o.before, queuedInjection{conn, inj})
+	} else {
+		o.after = append(o.after, queuedInjection{conn, inj})
+	}
+	return true
+}
+
+// take returns the injections and makes later ones go to the queue
+func (o *orderedInjections) take() (before, after []queuedInjection) {
+	o.l.Lock()
+	defer o.l.Unlock()
+	o.done = true
+	return o.before, o.after
+}
+
+// injectQueue writes injected packets one by one, it only runs while there is something queued
+type injectQueue struct {
+	l       sync.Mutex
+	queue   []queuedInjection
+	running bool
+	last    time.Time
+}
+
+func (q *injectQueue) push(conn minecraft.IConn, inj Injection, rate int) {
+	q.l.Lock()
+	defer q.l.Unlock()
+	q.queue = append(q.queue, queuedInjection{conn, inj})
+	if !q.running {
+		q.running = true
+		go q.run(rate)
+	}
+}
+
+func (q *injectQueue) run(rate int) {
+	for {
+		q.l.Lock()
+		if len(q.queue) == 0 {
+			q.running = false
+			q.l.Unlock()
+			return
+		}
+		inj := q.queue[0]
+		q.queue[0] = queuedInjection{}
+		q.queue = q.queue[1:]
+		q.l.Unlock()
+
+		if rate > 0 {
+			if wait := time.Second/time.Duration(rate) - time.Since(q.last); wait > 0 {
+				time.Sleep(wait)
+			}
+			q.last = time.Now()
+		}
+		inj.deliver()
+	}
+}
@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"bytes"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/sirupsen/logrus"
+)
+
+// packetFilter knows which handlers want which packets,
+// so packets are only decoded and passed to handlers when someone wants them.
+type packetFilter struct {
+	// per handler, nil if it wants every packet or has no PacketCB
+	handlers []map[uint32]struct{}
+	// packets any handler wants
+	wanted map[uint32]struct{}
+	// some handler wants every packet
+	all bool
+}
+
+func newPacketFilter(handlers []*Handler) *packetFilter {
+	f := &packetFilter{
+		handlers: make([]map[uint32]struct{}, len(handlers)),
+		wanted:   make(map[uint32]struct{}),
+	}
+	for i, h := range handlers {
+		if h.PacketCB == nil {
+			continue
+		}
+		if h.Packets == nil {
+			f.all = true
+			continue
+		}
+		ids := make(map[uint32]struct{}, len(h.Packets))
+		for _, id := range h.Packets {
+			ids[id] = struct{}{}
+			f.wanted[id] = struct{}{}
+		}
+		f.handlers[i] = ids
+	}
+	return f
+}
+
+// wants is true if the handler at index i wants packets with this id
+func (f *packetFilter) wants(i int, id uint32) bool {
+	ids := f.handlers[i]
+	if ids == nil {
+		return true
+	}
+	_, ok := ids[id]
+	return ok
+}
+
+// anyWants is true if any handler wants packets with this id
+func (f *packetFilter) anyWants(id uint32) bool {
+	if f.all {
+		return true
+	}
+	_, ok := f.wanted[id]
+	return ok
+}
+
+// packets bigger than this can't be read raw, they don't get near it
+const maxRawPacketSize = 1 << 24
+
+// rawReader reads the packets of a connection without decoding them,
+// only the ones a handler or the proxy itself needs are decoded.
+type rawReader struct {
+	p        *Context
+	src, dst minecraft.IConn
+	toServer bool
+	buf      []byte
+}
+
+// newRawReader returns nil if the packets of src can't be passed on raw,
+// that needs both sides to use the latest protocol since they aren't converted.
+func (p *Context) newRawReader(src, dst minecraft.IConn, toServer bool) *rawReader {
+	if _, ok := src.(*replayConnector); ok {
+		return nil
+	}
+	if src.Proto().ID() != protocol.CurrentProtocol {
+		return nil
+	}
+	if dst != nil && dst.Proto().ID() != protocol.CurrentProtocol {
+		return nil
+	}
+	return &rawReader{p: p, src: src, dst: dst, toServer: toServer}
+}
+
+// needsDecoded is true if a packet with this id has to be decoded
+func (p *Context) needsDecoded(id uint32) bool {
+	// the proxy handles transfers itself and spectators get most packets
+	return id == packet.IDTransfer || p.spectators != nil || p.filter.anyWants(id)
+}
+
+// read returns the next packet someone wants decoded, the ones before it are passed on to dst
+func (r *rawReader) read() (packet.Packet, error) {
+	if r.buf == nil {
+		r.buf = make([]byte, maxRawPacketSize)
+	}
+	for {
+		n, err := r.src.Read(r.buf)
+		if err != nil {
+			return nil, err
+		}
+		data := r.buf[:n]
+		buf := bytes.NewBuffer(data)
+		var header packet.Header
+		if err := header.Read(buf); err != nil {
+			logrus.Errorf("reading packet header: %s", err)
+			continue
+		}
+		payload := buf.Bytes()
+
+		if r.p.needsDecoded(header.PacketID) {
+			pk, ok := decodePacket(header, payload, r.src.ShieldID())
+			if !ok {
+				continue
+			}
+			return pk, nil
+		}
+		if r.dst == nil {
+			continue
+		}
+		if r.toServer {
+			// the server conn calls it for written packets, Write skips it
+			r.p.packetFunc(header, payload, r.dst.LocalAddr(), r.dst.RemoteAddr())
+		}
+		// the conn keeps the slice until it is flushed
+		if _, err := r.dst.Write(append([]byte(nil), data...)); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -9,12 +9,16 @@ type Player struct {
 	RuntimeID           uint64
 	Position            mgl32.Vec3
 	Pitch, Yaw, HeadYaw float32
+	Dimension           int32
 }
 
 func (p *Player) handlePackets(pk packet.Packet) bool {
 	switch pk := pk.(type) {
 	case *packet.StartGame:
 		p.RuntimeID = pk.EntityRuntimeID
+		p.Dimension = pk.Dimension
+	case *packet.ChangeDimension:
+		p.Dimension = pk.Dimension
 	case *packet.MovePlayer:
 		if pk.EntityRuntimeID == p.RuntimeID {
 			p.Position = pk.Position
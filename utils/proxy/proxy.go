@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/sandertv/gophertunnel/minecraft"
@@ -14,10 +15,6 @@ import (
 )
 
 type PacketFunc func(header packet.Header, payload []byte, src, dst net.Addr)
-type ingameCommand struct {
-	Exec func(cmdline []string) bool
-	Cmd  protocol.Command
-}
 
 type Handler struct {
 	Name     string
@@ -33,20 +30,30 @@ type Handler struct {
 
 	// called on every packet after login
 	PacketCB func(pk packet.Packet, toServer bool, timeReceived time.Time, preLogin bool) (packet.Packet, error)
+	// ids of the packets PacketCB is called with, nil for all of them.
+	// packets before spawn are only decoded when a handler wants them.
+	Packets []uint32
 
 	// called after client connected
 	OnClientConnect func(conn minecraft.IConn)
-	//SecondaryClientCB func(conn minecraft.IConn)
+	// called after a spectator joined the game
+	OnSpectatorConnect func(conn minecraft.IConn)
 
 	// called after server connected & downloaded resource packs
 	OnServerConnect func() (cancel bool, err error)
 	// called after game started
 	ConnectCB func() bool
 
-	// called when the proxy session stops or is reconnected
+	// called when the server connection was lost and the proxy connects again,
+	// the session goes on so OnEnd and AddressAndName are not called for it
+	OnReconnect func()
+	// called when the proxy session stops or is transferred
 	OnEnd func()
 	// called when the proxy ends
 	Deferred func()
+
+	// set when PacketCB or PacketRaw failed, the handler isn't called with packets anymore
+	failed atomic.Bool
 }
 
 var NewPacketCapturer func() *Handler
@@ -57,6 +64,11 @@ var serverPool = packet.NewServerPool()
 var clientPool = packet.NewClientPool()
 
 func DecodePacket(header packet.Header, payload []byte) (pk packet.Packet, ok bool) {
+	return decodePacket(header, payload, 0)
+}
+
+// decodePacket decodes a packet of a connection with the shield id passed, items depend on it
+func decodePacket(header packet.Header, payload []byte, shieldID int32) (pk packet.Packet, ok bool) {
 	pkFunc, ok := serverPool[header.PacketID]
 	if !ok {
 		pkFunc, ok = clientPool[header.PacketID]
@@ -75,6 +87,6 @@ func DecodePacket(header packet.Header, payload []byte) (pk packet.Packet, ok bo
 			ok = false
 		}
 	}()
-	pk.Marshal(protocol.NewReader(bytes.NewBuffer(payload), 0, false))
+	pk.Marshal(protocol.NewReader(bytes.NewBuffer(payload), shieldID, false))
 	return pk, ok
 }
@@ -44,12 +44,17 @@ type replayConnector struct {
 	packetFunc PacketFunc
 
 	resourcePackHandler *rpHandler
+
+	// play packets at the speed they were recorded at
+	realtime    atomic.Bool
+	firstPacket time.Time
+	playStart   time.Time
 }
 
-func (r *replayConnector) readPacket() (payload []byte, toServer bool, err error) {
+func (r *replayConnector) readPacket() (payload []byte, toServer bool, timeReceived time.Time, err error) {
 	var magic uint32 = 0
 	var packetLength uint32 = 0
-	timeReceived := time.Now()
+	timeReceived = time.Now()
 
 	err = binary.Read(r.packetF, binary.LittleEndian, &magic)
 	if err != nil {
@@ -58,12 +63,12 @@ func (r *replayConnector) readPacket() (payload []byte, toServer bool, err error
 		}
 		if errors.Is(err, io.EOF) {
 			logrus.Info("Reached End")
-			return nil, false, nil
+			return nil, false, timeReceived, nil
 		}
-		return nil, false, err
+		return nil, false, timeReceived, err
 	}
 	if magic != 0xAAAAAAAA {
-		return nil, toServer, fmt.Errorf("wrong Magic")
+		return nil, toServer, timeReceived, fmt.Errorf("wrong Magic")
 	}
 	binary.Read(r.packetF, binary.LittleEndian, &packetLength)
 	binary.Read(r.packetF, binary.LittleEndian, &toServer)
@@ -76,20 +81,45 @@ func (r *replayConnector) readPacket() (payload []byte, toServer bool, err error
 	payload = make([]byte, packetLength)
 	n, err := io.ReadFull(r.packetF, payload)
 	if err != nil {
-		return nil, toServer, err
+		return nil, toServer, timeReceived, err
 	}
 	if n != int(packetLength) {
-		return nil, toServer, fmt.Errorf("truncated")
+		return nil, toServer, timeReceived, fmt.Errorf("truncated")
 	}
 
 	var magic2 uint32
 	binary.Read(r.packetF, binary.LittleEndian, &magic2)
 	if magic2 != 0xBBBBBBBB {
-		return nil, toServer, fmt.Errorf("wrong Magic2")
+		return nil, toServer, timeReceived, fmt.Errorf("wrong Magic2")
 	}
 
-	_ = timeReceived
-	return payload, toServer, nil
+	return payload, toServer, timeReceived, nil
+}
+
+// Realtime makes the replay play at the speed it was recorded at, instead of as fast as possible
+func (r *replayConnector) Realtime() {
+	r.realtime.Store(true)
+}
+
+// wait sleeps until a packet received at t should be played, returns false if the replay was closed
+func (r *replayConnector) wait(t time.Time) bool {
+	if r.firstPacket.IsZero() {
+		r.firstPacket = t
+		r.playStart = time.Now()
+		return true
+	}
+	d := time.Until(r.playStart.Add(t.Sub(r.firstPacket)))
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.close:
+		return false
+	}
 }
 
 func (r *replayConnector) handleLoginSequence(pk packet.Packet) (bool, error) {
@@ -149,7 +179,7 @@ func (r *replayConnector) loop() {
 	gameStarted := false
 	defer r.Close()
 	for {
-		payload, toServer, err := r.readPacket()
+		payload, toServer, timeReceived, err := r.readPacket()
 		if err != nil {
 			r.err = err
 			r.Close()
@@ -183,6 +213,9 @@ func (r *replayConnector) loop() {
 					return
 				}
 			} else {
+				if r.realtime.Load() && !r.wait(timeReceived) {
+					return
+				}
 				if r.closed.Load() {
 					return
 				}
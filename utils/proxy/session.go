@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bedrock-tool/bedrocktool/ui/messages"
+	"github.com/bedrock-tool/bedrocktool/utils"
+	"golang.org/x/oauth2"
+)
+
+// Options are the settings of one proxy session,
+// every Context has its own so several can run in the same process.
+type Options struct {
+	// how the client connects to the proxy
+	Listen     utils.ListenConfig
+	Debug      bool
+	ExtraDebug bool
+	Capture    bool
+	// how many extra clients may join as spectators
+	Spectators int
+	// what to do when the server connection is lost
+	Reconnect ReconnectPolicy
+	// how many injected packets per second are sent to each side, 0 for no limit
+	InjectRate int
+	// account used to join the server, the logged in one if nil
+	TokenSource oauth2.TokenSource
+	// tags all messages to the ui, empty when there is only one session
+	Session string
+}
+
+// DefaultOptions returns the options that were set on the command line
+func DefaultOptions() Options {
+	return Options{
+		Listen:     utils.Options.Listen,
+		Debug:      utils.Options.Debug,
+		ExtraDebug: utils.Options.ExtraDebug,
+		Capture:    utils.Options.Capture,
+		Spectators: utils.Options.Spectators,
+		InjectRate: utils.Options.InjectRate,
+		Reconnect: ReconnectPolicy{
+			Attempts: utils.Options.Reconnect,
+			Delay:    time.Second,
+			MaxDelay: 30 * time.Second,
+		},
+	}
+}
+
+// ReconnectPolicy is how the proxy reconnects to the server after losing the connection.
+// the client is sent back to the proxy and waits there until the server is back.
+type ReconnectPolicy struct {
+	// how often to try connecting again, 0 ends the session instead.
+	// the tries add up over reconnects until a connection stays up for a few minutes.
+	Attempts int
+	// wait before the second try, doubled after every failed one up to MaxDelay
+	Delay    time.Duration
+	MaxDelay time.Duration
+}
+
+// a connection that stays up this long gets all reconnect attempts again
+const reconnectStableAfter = 5 * time.Minute
+
+// backoff returns how long to wait before the try after attempt
+func (r ReconnectPolicy) backoff(attempt int) time.Duration {
+	delay := r.Delay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if r.MaxDelay > 0 && delay >= r.MaxDelay {
+			return r.MaxDelay
+		}
+	}
+	return delay
+}
+
+// UI sends a message to the ui, tagged with the session of this proxy
+func (p *Context) UI(msg *messages.Message) *messages.Message {
+	return messages.Session(p.Options.Session).Handle(msg)
+}
+
+// SessionPort returns listen with the port moved up by i, so sessions started together don't share it
+func SessionPort(listen string, i int) (string, error) {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(p+i)), nil
+}
+
+// RunSessions runs every proxy with the server address at the same index, until all of them ended.
+// sessions without a ui session name are named after their server.
+func RunSessions(ctx context.Context, proxies []*Context, addresses []string) error {
+	if len(proxies) != len(addresses) {
+		return fmt.Errorf("%d proxies for %d servers", len(proxies), len(addresses))
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(proxies))
+	for i, p := range proxies {
+		if p.Options.Session == "" {
+			p.Options.Session = addresses[i]
+		}
+		wg.Add(1)
+		go func(i int, p *Context) {
+			defer wg.Done()
+			if err := p.Run(ctx, addresses[i]); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", addresses[i], err)
+			}
+		}(i, p)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,473 @@
+package proxy
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/google/uuid"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/sirupsen/logrus"
+)
+
+// every spectator has its own connection, so they can all use the same id for themselves
+const spectatorEntityID = 1 << 40
+
+// spectators are extra clients that see what the player sees, without being able to interact with the server.
+// everything they send is dropped.
+type spectators struct {
+	max int
+
+	// closed once the player has spawned, spectators can only start after that
+	ready         chan struct{}
+	gameData      minecraft.GameData
+	dimensionData *packet.DimensionData
+
+	l     sync.Mutex
+	count int
+	conns []*minecraft.Conn
+	// spectators getting the cache, packets for them wait here so they arrive after it
+	joining map[*minecraft.Conn][]packet.Packet
+	cache   spectatorCache
+}
+
+func newSpectators(max int) *spectators {
+	return &spectators{
+		max:     max,
+		ready:   make(chan struct{}),
+		joining: make(map[*minecraft.Conn][]packet.Packet),
+		cache:   newSpectatorCache(),
+	}
+}
+
+// start lets spectators join the game, with what the player got
+func (s *spectators) start(gd minecraft.GameData, dimensionData *packet.DimensionData) {
+	s.l.Lock()
+	s.gameData = gd
+	s.dimensionData = dimensionData
+	s.cache.dimension = gd.Dimension
+	s.cache.playerPosition = gd.PlayerPosition
+	s.l.Unlock()
+	close(s.ready)
+}
+
+// full reserves a slot for a new spectator, returns true if there is none left
+func (s *spectators) full() bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.count >= s.max {
+		return true
+	}
+	s.count++
+	return false
+}
+
+// join spawns conn as a spectator and keeps it until it disconnects, onSpawn is called once it is in the game
+func (s *spectators) join(ctx context.Context, conn *minecraft.Conn, onSpawn func()) {
+	defer func() {
+		s.l.Lock()
+		s.count--
+		s.l.Unlock()
+	}()
+
+	select {
+	case <-s.ready:
+	case <-ctx.Done():
+		return
+	}
+
+	s.l.Lock()
+	gd := s.gameData
+	gd.EntityRuntimeID = spectatorEntityID
+	gd.EntityUniqueID = spectatorEntityID
+	gd.PlayerGameMode = packet.GameTypeSpectator
+	gd.Dimension = s.cache.dimension
+	gd.PlayerPosition = s.cache.playerPosition
+	dimensionData := s.dimensionData
+	s.l.Unlock()
+
+	if dimensionData != nil {
+		_ = conn.WritePacket(dimensionData)
+	}
+	if err := conn.StartGameContext(ctx, gd); err != nil {
+		logrus.Warnf("spectator %s: %s", conn.IdentityData().DisplayName, err)
+		return
+	}
+
+	// the cache is copied so writing it doesnt hold up the player
+	s.l.Lock()
+	pks := s.cache.packets(s.gameData)
+	s.joining[conn] = nil
+	s.l.Unlock()
+	defer s.remove(conn)
+	for {
+		if err := writePackets(conn, pks); err != nil {
+			return
+		}
+		s.l.Lock()
+		pks = s.joining[conn]
+		if len(pks) == 0 {
+			delete(s.joining, conn)
+			s.conns = append(s.conns, conn)
+			s.l.Unlock()
+			break
+		}
+		s.joining[conn] = nil
+		s.l.Unlock()
+	}
+	onSpawn()
+
+	for {
+		if _, err := conn.ReadPacket(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *spectators) remove(conn *minecraft.Conn) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	delete(s.joining, conn)
+	for i, c := range s.conns {
+		if c == conn {
+			s.conns = append(s.conns[:i], s.conns[i+1:]...)
+			break
+		}
+	}
+}
+
+// handlePacket passes a packet the player got to all spectators,
+// from what the player sends only the movement is used.
+func (s *spectators) handlePacket(pk packet.Packet, toServer bool) {
+	s.l.Lock()
+	if input, ok := pk.(*packet.PlayerAuthInput); ok {
+		// the player is shown as a normal player to spectators
+		s.cache.playerPosition = input.Position
+		pk = &packet.MovePlayer{
+			EntityRuntimeID: s.gameData.EntityRuntimeID,
+			Position:        input.Position,
+			Pitch:           input.Pitch,
+			Yaw:             input.Yaw,
+			HeadYaw:         input.HeadYaw,
+			Mode:            packet.MoveModeNormal,
+			OnGround:        true,
+		}
+	} else if toServer {
+		s.l.Unlock()
+		return
+	} else {
+		s.cache.handlePacket(pk)
+		if !forSpectators(pk) {
+			s.l.Unlock()
+			return
+		}
+	}
+	for conn, pks := range s.joining {
+		s.joining[conn] = append(pks, pk)
+	}
+	conns := slices.Clone(s.conns)
+	s.l.Unlock()
+
+	// written without the lock, a slow spectator shouldnt hold up the others
+	for _, conn := range conns {
+		if err := conn.WritePacket(pk); err != nil {
+			_ = conn.Close()
+			s.remove(conn)
+		}
+	}
+}
+
+func writePackets(conn *minecraft.Conn, pks []packet.Packet) error {
+	for _, pk := range pks {
+		if err := conn.WritePacket(pk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// disconnect kicks all spectators
+func (s *spectators) disconnect(listener *minecraft.Listener, reason string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	for _, conn := range s.conns {
+		_ = listener.Disconnect(conn, reason)
+	}
+	s.conns = nil
+	for conn := range s.joining {
+		_ = listener.Disconnect(conn, reason)
+	}
+	clear(s.joining)
+}
+
+// forSpectators returns false for packets that only make sense for the player themselves
+func forSpectators(pk packet.Packet) bool {
+	// replays also contain what the player sent
+	if _, ok := serverPool[pk.ID()]; !ok {
+		return false
+	}
+	switch pk.(type) {
+	case *packet.Transfer, *packet.Disconnect, *packet.PlayStatus, *packet.StartGame, *packet.Respawn,
+		*packet.ResourcePacksInfo, *packet.ResourcePackStack, *packet.ResourcePackDataInfo, *packet.ResourcePackChunkData,
+		*packet.SetPlayerGameType, *packet.SetHealth, *packet.CorrectPlayerMovePrediction, *packet.ChunkRadiusUpdated,
+		*packet.ContainerOpen, *packet.ContainerClose, *packet.ContainerSetData, *packet.InventoryContent, *packet.InventorySlot,
+		*packet.ItemStackResponse, *packet.PlayerHotBar, *packet.ModalFormRequest, *packet.ServerSettingsResponse,
+		*packet.AvailableCommands, *packet.NetworkStackLatency, *packet.UpdateAbilities, *packet.UpdateAdventureSettings:
+		return false
+	}
+	return true
+}
+
+// a chunk keeps this many block updates for spectators joining later, the oldest ones are dropped first
+const maxBlockUpdatesPerChunk = 256
+
+// spectatorCache keeps what a spectator needs to see the world as it is when they join late.
+// chunks outside of the radius the server last published are dropped.
+type spectatorCache struct {
+	dimension      int32
+	playerPosition mgl32.Vec3
+
+	time           *packet.SetTime
+	chunkPublisher *packet.NetworkChunkPublisherUpdate
+	chunks         map[protocol.ChunkPos]*packet.LevelChunk
+	blockUpdates   map[protocol.ChunkPos][]*packet.UpdateBlock
+	subChunks      map[protocol.SubChunkPos]protocol.SubChunkEntry
+	subChunkCache  bool
+
+	entities   map[uint64]packet.Packet
+	uniqueIDs  map[int64]uint64
+	playerList map[uuid.UUID]protocol.PlayerListEntry
+}
+
+func newSpectatorCache() spectatorCache {
+	return spectatorCache{
+		chunks:       make(map[protocol.ChunkPos]*packet.LevelChunk),
+		blockUpdates: make(map[protocol.ChunkPos][]*packet.UpdateBlock),
+		subChunks:    make(map[protocol.SubChunkPos]protocol.SubChunkEntry),
+		entities:     make(map[uint64]packet.Packet),
+		uniqueIDs:    make(map[int64]uint64),
+		playerList:   make(map[uuid.UUID]protocol.PlayerListEntry),
+	}
+}
+
+func (c *spectatorCache) clearWorld() {
+	c.chunkPublisher = nil
+	clear(c.chunks)
+	clear(c.blockUpdates)
+	clear(c.subChunks)
+	clear(c.entities)
+	clear(c.uniqueIDs)
+}
+
+func (c *spectatorCache) handlePacket(pk packet.Packet) {
+	switch pk := pk.(type) {
+	case *packet.ChangeDimension:
+		c.dimension = pk.Dimension
+		c.playerPosition = pk.Position
+		c.clearWorld()
+	case *packet.SetTime:
+		c.time = pk
+	case *packet.NetworkChunkPublisherUpdate:
+		c.chunkPublisher = pk
+		c.evictChunks()
+	case *packet.LevelChunk:
+		c.chunks[pk.Position] = pk
+		delete(c.blockUpdates, pk.Position)
+	case *packet.UpdateBlock:
+		c.addBlockUpdate(pk)
+	case *packet.SubChunk:
+		c.subChunkCache = pk.CacheEnabled
+		for _, entry := range pk.SubChunkEntries {
+			pos := protocol.SubChunkPos{
+				pk.Position.X() + int32(entry.Offset[0]),
+				pk.Position.Y() + int32(entry.Offset[1]),
+				pk.Position.Z() + int32(entry.Offset[2]),
+			}
+			c.subChunks[pos] = entry
+		}
+
+	case *packet.AddActor:
+		c.addEntity(pk, pk.EntityRuntimeID, pk.EntityUniqueID)
+	case *packet.AddPlayer:
+		c.addEntity(pk, pk.EntityRuntimeID, pk.AbilityData.EntityUniqueID)
+	case *packet.AddItemActor:
+		c.addEntity(pk, pk.EntityRuntimeID, pk.EntityUniqueID)
+	case *packet.AddPainting:
+		c.addEntity(pk, pk.EntityRuntimeID, pk.EntityUniqueID)
+	case *packet.RemoveActor:
+		if rid, ok := c.uniqueIDs[pk.EntityUniqueID]; ok {
+			delete(c.entities, rid)
+			delete(c.uniqueIDs, pk.EntityUniqueID)
+		}
+	case *packet.MoveActorAbsolute:
+		c.moveEntity(pk.EntityRuntimeID, func(pos *mgl32.Vec3) {
+			*pos = pk.Position
+		})
+	case *packet.MovePlayer:
+		c.moveEntity(pk.EntityRuntimeID, func(pos *mgl32.Vec3) {
+			*pos = pk.Position
+		})
+	case *packet.MoveActorDelta:
+		c.moveEntity(pk.EntityRuntimeID, func(pos *mgl32.Vec3) {
+			if pk.Flags&packet.MoveActorDeltaFlagHasX != 0 {
+				pos[0] = pk.Position[0]
+			}
+			if pk.Flags&packet.MoveActorDeltaFlagHasY != 0 {
+				pos[1] = pk.Position[1]
+			}
+			if pk.Flags&packet.MoveActorDeltaFlagHasZ != 0 {
+				pos[2] = pk.Position[2]
+			}
+		})
+
+	case *packet.PlayerList:
+		for _, entry := range pk.Entries {
+			if pk.ActionType == packet.PlayerListActionAdd {
+				c.playerList[entry.UUID] = entry
+			} else {
+				delete(c.playerList, entry.UUID)
+			}
+		}
+	}
+}
+
+// addBlockUpdate keeps the latest update of every block, up to maxBlockUpdatesPerChunk per chunk
+func (c *spectatorCache) addBlockUpdate(pk *packet.UpdateBlock) {
+	pos := protocol.ChunkPos{pk.Position.X() >> 4, pk.Position.Z() >> 4}
+	updates := slices.DeleteFunc(c.blockUpdates[pos], func(u *packet.UpdateBlock) bool {
+		return u.Position == pk.Position && u.Layer == pk.Layer
+	})
+	if len(updates) >= maxBlockUpdatesPerChunk {
+		updates = slices.Delete(updates, 0, 1)
+	}
+	c.blockUpdates[pos] = append(updates, pk)
+}
+
+// inRadius is true if the chunk is within the radius of the last chunk publisher update
+func (c *spectatorCache) inRadius(pos protocol.ChunkPos) bool {
+	if c.chunkPublisher == nil {
+		return true
+	}
+	center := protocol.ChunkPos{c.chunkPublisher.Position.X() >> 4, c.chunkPublisher.Position.Z() >> 4}
+	// one chunk more, the client keeps the edge too
+	radius := int64(c.chunkPublisher.Radius>>4) + 1
+	dx, dz := int64(pos.X()-center.X()), int64(pos.Z()-center.Z())
+	return dx*dx+dz*dz <= radius*radius
+}
+
+// evictChunks drops the chunks the player can't see anymore
+func (c *spectatorCache) evictChunks() {
+	for pos := range c.chunks {
+		if !c.inRadius(pos) {
+			delete(c.chunks, pos)
+		}
+	}
+	for pos := range c.blockUpdates {
+		if !c.inRadius(pos) {
+			delete(c.blockUpdates, pos)
+		}
+	}
+	for pos := range c.subChunks {
+		if !c.inRadius(protocol.ChunkPos{pos.X(), pos.Z()}) {
+			delete(c.subChunks, pos)
+		}
+	}
+}
+
+func (c *spectatorCache) addEntity(pk packet.Packet, runtimeID uint64, uniqueID int64) {
+	c.entities[runtimeID] = pk
+	c.uniqueIDs[uniqueID] = runtimeID
+}
+
+func (c *spectatorCache) moveEntity(runtimeID uint64, move func(pos *mgl32.Vec3)) {
+	switch pk := c.entities[runtimeID].(type) {
+	case *packet.AddActor:
+		move(&pk.Position)
+	case *packet.AddPlayer:
+		move(&pk.Position)
+	case *packet.AddItemActor:
+		move(&pk.Position)
+	case *packet.AddPainting:
+		move(&pk.Position)
+	}
+}
+
+// packets returns everything cached for a spectator that just spawned, gd is the game data of the player.
+// packets the cache changes later are copied.
+func (c *spectatorCache) packets(gd minecraft.GameData) []packet.Packet {
+	var pks []packet.Packet
+	if c.time != nil {
+		pks = append(pks, c.time)
+	}
+
+	entries := make([]protocol.PlayerListEntry, 0, len(c.playerList))
+	var player *protocol.PlayerListEntry
+	for _, entry := range c.playerList {
+		entries = append(entries, entry)
+		if entry.EntityUniqueID == gd.EntityUniqueID {
+			player = &entries[len(entries)-1]
+		}
+	}
+	if len(entries) > 0 {
+		pks = append(pks, &packet.PlayerList{ActionType: packet.PlayerListActionAdd, Entries: entries})
+	}
+	if player != nil {
+		pks = append(pks, &packet.AddPlayer{
+			UUID:            player.UUID,
+			Username:        player.Username,
+			EntityRuntimeID: gd.EntityRuntimeID,
+			Position:        c.playerPosition,
+			AbilityData:     protocol.AbilityData{EntityUniqueID: gd.EntityUniqueID},
+		})
+	}
+
+	if c.chunkPublisher != nil {
+		pks = append(pks, c.chunkPublisher)
+	}
+	for pos, chunk := range c.chunks {
+		pks = append(pks, chunk)
+		for _, pk := range c.blockUpdates[pos] {
+			pks = append(pks, pk)
+		}
+	}
+
+	// one packet for every column of sub chunks
+	columns := make(map[protocol.ChunkPos]*packet.SubChunk)
+	for pos, entry := range c.subChunks {
+		col := protocol.ChunkPos{pos.X(), pos.Z()}
+		pk, ok := columns[col]
+		if !ok {
+			pk = &packet.SubChunk{
+				CacheEnabled: c.subChunkCache,
+				Dimension:    c.dimension,
+				Position:     protocol.SubChunkPos{pos.X(), 0, pos.Z()},
+			}
+			columns[col] = pk
+			pks = append(pks, pk)
+		}
+		entry.Offset = protocol.SubChunkOffset{0, int8(pos.Y()), 0}
+		pk.SubChunkEntries = append(pk.SubChunkEntries, entry)
+	}
+
+	// moving entities changes their cached packet
+	for _, pk := range c.entities {
+		switch pk := pk.(type) {
+		case *packet.AddActor:
+			pk2 := *pk
+			pks = append(pks, &pk2)
+		case *packet.AddPlayer:
+			pk2 := *pk
+			pks = append(pks, &pk2)
+		case *packet.AddItemActor:
+			pk2 := *pk
+			pks = append(pks, &pk2)
+		case *packet.AddPainting:
+			pk2 := *pk
+			pks = append(pks, &pk2)
+		}
+	}
+	return pks
+}
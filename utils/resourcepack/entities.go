@@ -0,0 +1,34 @@
+package resourcepack
+
+import (
+	"github.com/bedrock-tool/bedrocktool/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// AddEntityFromPacks copies the client entity with the identifier passed from the indexed packs,
+// together with the geometry, textures, render controllers and animations it uses.
+// returns false if none of the packs define the entity.
+func (p *Pack) AddEntityFromPacks(identifier string, idx *PackIndex) bool {
+	f, ok := idx.clientEntities[identifier]
+	if !ok {
+		return false
+	}
+	data, err := f.read()
+	if err != nil {
+		logrus.Warn(err)
+		return false
+	}
+	p.Files[f.name] = data
+
+	var content struct {
+		ClientEntity struct {
+			Description clientDescription `json:"description"`
+		} `json:"minecraft:client_entity"`
+	}
+	if err := utils.ParseJson(data, &content); err != nil {
+		logrus.Warnf("%s: %s", f.name, err)
+		return true
+	}
+	p.copyReferences(content.ClientEntity.Description, idx)
+	return true
+}
@@ -0,0 +1,204 @@
+package resourcepack
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/bedrock-tool/bedrocktool/utils"
+	"github.com/sirupsen/logrus"
+)
+
+type packFile struct {
+	fs   fs.FS
+	name string
+}
+
+func (f packFile) read() ([]byte, error) {
+	r, err := f.fs.Open(f.name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// PackIndex finds the client side definitions of entities and everything they reference in a set of packs.
+type PackIndex struct {
+	clientEntities    map[string]packFile
+	geometries        map[string]packFile
+	renderControllers map[string]packFile
+	animations        map[string]packFile
+	textures          map[string]packFile
+	attachables       map[string]packFile
+	// texture_data of item_texture.json
+	itemTextures map[string]any
+}
+
+// NewPackIndex reads all packs that can be opened, packs that come first take priority.
+func NewPackIndex(packs []utils.Pack) *PackIndex {
+	idx := &PackIndex{
+		clientEntities:    make(map[string]packFile),
+		geometries:        make(map[string]packFile),
+		renderControllers: make(map[string]packFile),
+		animations:        make(map[string]packFile),
+		textures:          make(map[string]packFile),
+		attachables:       make(map[string]packFile),
+		itemTextures:      make(map[string]any),
+	}
+	for _, pack := range packs {
+		if pack.Base().Encrypted() && !pack.CanDecrypt() {
+			continue
+		}
+		fsys, names, err := pack.FS()
+		if err != nil {
+			logrus.Warnf("%s: %s", pack.Base().Name(), err)
+			continue
+		}
+		for _, name := range names {
+			idx.add(fsys, name)
+		}
+	}
+	return idx
+}
+
+func setFirst(m map[string]packFile, key string, f packFile) {
+	if _, ok := m[key]; !ok {
+		m[key] = f
+	}
+}
+
+func (idx *PackIndex) add(fsys fs.FS, name string) {
+	f := packFile{fs: fsys, name: name}
+	dir, _, _ := strings.Cut(name, "/")
+	ext := path.Ext(name)
+
+	if dir == "textures" && (ext == ".png" || ext == ".tga") {
+		setFirst(idx.textures, strings.TrimSuffix(name, ext), f)
+		return
+	}
+	if ext != ".json" {
+		return
+	}
+	switch dir {
+	case "entity", "attachables", "models", "render_controllers", "animations", "animation_controllers":
+	default:
+		if name != "textures/item_texture.json" {
+			return
+		}
+	}
+
+	data, err := f.read()
+	if err != nil {
+		logrus.Warn(err)
+		return
+	}
+	var content map[string]any
+	if err := utils.ParseJson(data, &content); err != nil {
+		logrus.Debugf("%s: %s", name, err)
+		return
+	}
+
+	switch dir {
+	case "textures":
+		textureData, _ := content["texture_data"].(map[string]any)
+		for k, v := range textureData {
+			if _, ok := idx.itemTextures[k]; !ok {
+				idx.itemTextures[k] = v
+			}
+		}
+	case "entity":
+		ce, _ := content["minecraft:client_entity"].(map[string]any)
+		desc, _ := ce["description"].(map[string]any)
+		if id, ok := desc["identifier"].(string); ok {
+			setFirst(idx.clientEntities, id, f)
+		}
+	case "attachables":
+		a, _ := content["minecraft:attachable"].(map[string]any)
+		desc, _ := a["description"].(map[string]any)
+		if id, ok := desc["identifier"].(string); ok {
+			setFirst(idx.attachables, id, f)
+		}
+	case "models":
+		if geos, ok := content["minecraft:geometry"].([]any); ok {
+			for _, g := range geos {
+				g, _ := g.(map[string]any)
+				desc, _ := g["description"].(map[string]any)
+				if id, ok := desc["identifier"].(string); ok {
+					setFirst(idx.geometries, id, f)
+				}
+			}
+		}
+		// legacy format, geometry.name or geometry.name:geometry.parent as keys
+		for k := range content {
+			if strings.HasPrefix(k, "geometry.") {
+				id, _, _ := strings.Cut(k, ":")
+				setFirst(idx.geometries, id, f)
+			}
+		}
+	case "render_controllers":
+		rcs, _ := content["render_controllers"].(map[string]any)
+		for id := range rcs {
+			setFirst(idx.renderControllers, id, f)
+		}
+	case "animations", "animation_controllers":
+		anims, _ := content["animations"].(map[string]any)
+		for id := range anims {
+			setFirst(idx.animations, id, f)
+		}
+		controllers, _ := content["animation_controllers"].(map[string]any)
+		for id := range controllers {
+			setFirst(idx.animations, id, f)
+		}
+	}
+}
+
+// copyFrom copies the file defining key, vanilla content is not in the index and is skipped
+func (p *Pack) copyFrom(files map[string]packFile, key string) {
+	f, ok := files[key]
+	if !ok {
+		return
+	}
+	if _, ok := p.Files[f.name]; ok {
+		return
+	}
+	data, err := f.read()
+	if err != nil {
+		logrus.Warn(err)
+		return
+	}
+	p.Files[f.name] = data
+}
+
+// clientDescription is the part of client entity and attachable descriptions that references other files
+type clientDescription struct {
+	Geometry          map[string]string `json:"geometry"`
+	Textures          map[string]string `json:"textures"`
+	Animations        map[string]string `json:"animations"`
+	RenderControllers []any             `json:"render_controllers"`
+}
+
+// copyReferences copies the geometry, textures, render controllers and animations a description uses
+func (p *Pack) copyReferences(desc clientDescription, idx *PackIndex) {
+	for _, id := range desc.Geometry {
+		p.copyFrom(idx.geometries, id)
+	}
+	for _, tex := range desc.Textures {
+		p.copyFrom(idx.textures, tex)
+	}
+	for _, id := range desc.Animations {
+		p.copyFrom(idx.animations, id)
+	}
+	for _, rc := range desc.RenderControllers {
+		// either the name of the controller or {name: condition}
+		switch rc := rc.(type) {
+		case string:
+			p.copyFrom(idx.renderControllers, rc)
+		case map[string]any:
+			for id := range rc {
+				p.copyFrom(idx.renderControllers, id)
+			}
+		}
+	}
+}
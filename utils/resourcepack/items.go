@@ -0,0 +1,95 @@
+package resourcepack
+
+import (
+	"encoding/json"
+
+	"github.com/bedrock-tool/bedrocktool/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// AddItemFromPacks adds the icon of a custom item to item_texture.json and copies its texture from the indexed packs,
+// the attachable of the item is copied too if there is one.
+// returns false if nothing was found for the item.
+func (p *Pack) AddItemFromPacks(identifier, icon string, idx *PackIndex) bool {
+	var found bool
+	if icon != "" {
+		if entry, ok := idx.itemTextures[icon]; ok {
+			for _, tex := range itemTexturePaths(entry) {
+				p.copyFrom(idx.textures, tex)
+			}
+			p.setItemTexture(icon, entry)
+			found = true
+		} else if _, ok := idx.textures[icon]; ok {
+			// the icon is the path of a texture
+			p.copyFrom(idx.textures, icon)
+			p.setItemTexture(icon, map[string]any{"textures": icon})
+			found = true
+		}
+	}
+
+	if f, ok := idx.attachables[identifier]; ok {
+		data, err := f.read()
+		if err != nil {
+			logrus.Warn(err)
+			return found
+		}
+		p.Files[f.name] = data
+		found = true
+
+		var content struct {
+			Attachable struct {
+				Description clientDescription `json:"description"`
+			} `json:"minecraft:attachable"`
+		}
+		if err := utils.ParseJson(data, &content); err != nil {
+			logrus.Warnf("%s: %s", f.name, err)
+			return found
+		}
+		p.copyReferences(content.Attachable.Description, idx)
+	}
+	return found
+}
+
+// itemTexturePaths returns the texture paths of a texture_data entry,
+// "textures" is either a path, {"path": ...} or a list of either
+func itemTexturePaths(entry any) (paths []string) {
+	m, _ := entry.(map[string]any)
+	var add func(v any)
+	add = func(v any) {
+		switch v := v.(type) {
+		case string:
+			paths = append(paths, v)
+		case map[string]any:
+			if path, ok := v["path"].(string); ok {
+				paths = append(paths, path)
+			}
+		case []any:
+			for _, e := range v {
+				add(e)
+			}
+		}
+	}
+	add(m["textures"])
+	return paths
+}
+
+// AddItemIcon adds an entry for icon to item_texture.json at the usual texture path,
+// for items whose icon texture isnt in any of the server packs
+func (p *Pack) AddItemIcon(icon string) {
+	if _, ok := p.itemTextures[icon]; ok {
+		return
+	}
+	p.setItemTexture(icon, map[string]any{"textures": "textures/items/" + icon})
+}
+
+func (p *Pack) setItemTexture(name string, entry any) {
+	if p.itemTextures == nil {
+		p.itemTextures = make(map[string]any)
+	}
+	p.itemTextures[name] = entry
+	p.Files["textures/item_texture.json"], _ = json.Marshal(map[string]any{
+		"resource_pack_name": "bedrocktool",
+		"texture_name":       "atlas.items",
+		"texture_data":       p.itemTextures,
+	})
+}
@@ -22,6 +22,8 @@ import (
 type Pack struct {
 	Manifest resource.Manifest
 	Files    map[string][]byte
+
+	itemTextures map[string]any
 }
 
 // parseVersion parses the version passed in the format of a.b.c as a [3]int.
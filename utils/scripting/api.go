@@ -0,0 +1,312 @@
+package scripting
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/dop251/goja"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// World is the world that is currently being captured, as scripts see it.
+type World interface {
+	// Block returns the name and properties of the block at pos, ok is false if the chunk wasn't captured
+	Block(pos cube.Pos) (name string, properties map[string]any, ok bool)
+	// SetBlock replaces the block at pos, returns false if the block or chunk doesn't exist
+	SetBlock(pos cube.Pos, name string, properties map[string]any) bool
+	// Entities returns all entities captured so far
+	Entities() []any
+}
+
+// ProcessWorld is a world that is about to be written, see OnPostProcess.
+// entities and block entities are passed as the nbt they are stored with.
+type ProcessWorld interface {
+	Chunks() []world.ChunkPos
+	Block(pos cube.Pos) (name string, properties map[string]any, ok bool)
+	SetBlock(pos cube.Pos, name string, properties map[string]any) bool
+	// replace is called once for every different block state
+	ReplaceBlocks(replace func(name string, properties map[string]any) (string, map[string]any, bool)) (int, error)
+	ForEachEntity(fn func(nbt map[string]any) (keep bool))
+	ForEachBlockEntity(fn func(pos cube.Pos, nbt map[string]any) (keep bool))
+}
+
+// Env is what the vm uses to access the proxy session it runs in.
+// all fields are optional, functions that are missing are a no-op in scripts.
+type Env struct {
+	// returns the current world, nil if there is none
+	World          func() World
+	PlayerPosition func() mgl32.Vec3
+	SendMessage    func(text string)
+	AddCommand     func(exec func([]string) bool, cmd protocol.Command)
+	RemoveCommand  func(name string)
+	// sends a packet to the server or the client
+	WritePacket func(pk packet.Packet, toServer bool) error
+}
+
+// packetsByName contains the constructors of all packets by their name
+var packetsByName = func() map[string]func() packet.Packet {
+	packets := make(map[string]func() packet.Packet)
+	for _, pool := range []packet.Pool{packet.NewClientPool(), packet.NewServerPool()} {
+		for _, f := range pool {
+			packets[packetName(f())] = f
+		}
+	}
+	return packets
+}()
+
+// packetName is the name of the packet struct, e.g. "Text" for *packet.Text
+func packetName(pk packet.Packet) string {
+	return reflect.TypeOf(pk).Elem().Name()
+}
+
+// setupAPI adds the globals scripts use to interact with the proxy and world
+func (v *VM) setupAPI(r *runtime) {
+	global := r.vm.GlobalObject()
+
+	global.Set("OnPacket", func(name string, fn goja.Value) {
+		cb, ok := goja.AssertFunction(fn)
+		if !ok {
+			panic(r.vm.NewTypeError("OnPacket: callback is not a function"))
+		}
+		if _, ok := packetsByName[name]; name != "*" && !ok {
+			panic(r.vm.NewTypeError(fmt.Sprintf("OnPacket: unknown packet %q", name)))
+		}
+		r.packetCBs[name] = append(r.packetCBs[name], cb)
+		// callbacks added after loading, scripts only run with the lock held
+		if v.rt == r {
+			v.updatePacketNames()
+		}
+	})
+
+	global.Set("NewPacket", func(name string, fields *goja.Object) goja.Value {
+		f, ok := packetsByName[name]
+		if !ok {
+			panic(r.vm.NewTypeError(fmt.Sprintf("NewPacket: unknown packet %q", name)))
+		}
+		pk := r.vm.ToValue(f()).ToObject(r.vm)
+		if fields != nil {
+			for _, key := range fields.Keys() {
+				if err := pk.Set(key, fields.Get(key)); err != nil {
+					panic(err)
+				}
+			}
+		}
+		return pk
+	})
+
+	writePacket := func(val goja.Value, toServer bool) {
+		pk, ok := val.Export().(packet.Packet)
+		if !ok {
+			panic(r.vm.NewTypeError("not a packet, use NewPacket to create one"))
+		}
+		if v.env.WritePacket == nil {
+			return
+		}
+		if err := v.env.WritePacket(pk, toServer); err != nil {
+			panic(r.vm.NewGoError(err))
+		}
+	}
+	global.Set("SendToClient", func(pk goja.Value) {
+		writePacket(pk, false)
+	})
+	global.Set("SendToServer", func(pk goja.Value) {
+		writePacket(pk, true)
+	})
+
+	global.Set("SendMessage", func(text string) {
+		if v.env.SendMessage != nil {
+			v.env.SendMessage(text)
+		}
+	})
+
+	global.Set("AddCommand", func(name, description string, fn goja.Value) {
+		cb, ok := goja.AssertFunction(fn)
+		if !ok {
+			panic(r.vm.NewTypeError("AddCommand: callback is not a function"))
+		}
+		r.commands[name] = cb
+		if v.env.AddCommand == nil || v.commands[name] {
+			return
+		}
+		v.commands[name] = true
+		v.env.AddCommand(func(args []string) bool {
+			var ret bool
+			v.call("command "+name, func(r *runtime) error {
+				// the command may be gone after reloading
+				cb, ok := r.commands[name]
+				if !ok {
+					return nil
+				}
+				val, err := cb(goja.Undefined(), r.vm.ToValue(args))
+				if err != nil {
+					return err
+				}
+				ret = val.ToBoolean()
+				return nil
+			})
+			return ret
+		}, protocol.Command{
+			Name:        name,
+			Description: description,
+		})
+	})
+
+	player := r.vm.NewObject()
+	player.Set("Position", func() []float32 {
+		if v.env.PlayerPosition == nil {
+			return []float32{0, 0, 0}
+		}
+		pos := v.env.PlayerPosition()
+		return pos[:]
+	})
+	global.Set("Player", player)
+
+	worldObj := r.vm.NewObject()
+	worldObj.Set("GetBlock", func(x, y, z int) any {
+		w := v.world()
+		if w == nil {
+			return nil
+		}
+		name, properties, ok := w.Block(cube.Pos{x, y, z})
+		if !ok {
+			return nil
+		}
+		return blockObject(name, properties)
+	})
+	worldObj.Set("SetBlock", func(x, y, z int, name string, properties map[string]any) bool {
+		w := v.world()
+		if w == nil {
+			return false
+		}
+		return w.SetBlock(cube.Pos{x, y, z}, name, blockProperties(properties))
+	})
+	worldObj.Set("Entities", func() []any {
+		w := v.world()
+		if w == nil {
+			return []any{}
+		}
+		return w.Entities()
+	})
+	global.Set("World", worldObj)
+}
+
+func (v *VM) world() World {
+	if v.env.World == nil {
+		return nil
+	}
+	return v.env.World()
+}
+
+// blockProperties converts the numbers from js to the types block states use
+func blockProperties(properties map[string]any) map[string]any {
+	out := make(map[string]any, len(properties))
+	for k, v := range properties {
+		switch v := v.(type) {
+		case int64:
+			out[k] = int32(v)
+		case float64:
+			out[k] = int32(v)
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// blockObject is how blocks are passed to scripts
+func blockObject(name string, properties map[string]any) map[string]any {
+	return map[string]any{
+		"Name":       name,
+		"Properties": properties,
+	}
+}
+
+// processWorldObject wraps a world for OnPostProcess
+func (v *VM) processWorldObject(r *runtime, pw ProcessWorld) *goja.Object {
+	obj := r.vm.NewObject()
+	obj.Set("Chunks", func() []world.ChunkPos {
+		return pw.Chunks()
+	})
+	obj.Set("GetBlock", func(x, y, z int) any {
+		name, properties, ok := pw.Block(cube.Pos{x, y, z})
+		if !ok {
+			return nil
+		}
+		return blockObject(name, properties)
+	})
+	obj.Set("SetBlock", func(x, y, z int, name string, properties map[string]any) bool {
+		return pw.SetBlock(cube.Pos{x, y, z}, name, blockProperties(properties))
+	})
+	// takes either an object mapping block names to their replacement, or a function returning the replacement
+	obj.Set("ReplaceBlocks", func(replacements goja.Value) int {
+		var replace func(name string, properties map[string]any) (string, map[string]any, bool)
+		if fn, ok := goja.AssertFunction(replacements); ok {
+			replace = func(name string, properties map[string]any) (string, map[string]any, bool) {
+				ret, err := fn(goja.Undefined(), r.vm.ToValue(blockObject(name, properties)))
+				if err != nil {
+					panic(err)
+				}
+				return exportBlock(r, ret)
+			}
+		} else {
+			m := replacements.ToObject(r.vm)
+			replace = func(name string, properties map[string]any) (string, map[string]any, bool) {
+				return exportBlock(r, m.Get(name))
+			}
+		}
+		n, err := pw.ReplaceBlocks(replace)
+		if err != nil {
+			panic(r.vm.NewGoError(err))
+		}
+		return n
+	})
+	// returning false removes the entity or block entity, nothing keeps it
+	obj.Set("ForEachEntity", func(fn goja.Callable) {
+		pw.ForEachEntity(func(nbt map[string]any) bool {
+			ret, err := fn(goja.Undefined(), r.vm.ToValue(nbt))
+			if err != nil {
+				panic(err)
+			}
+			return !isFalse(ret)
+		})
+	})
+	obj.Set("ForEachBlockEntity", func(fn goja.Callable) {
+		pw.ForEachBlockEntity(func(pos cube.Pos, nbt map[string]any) bool {
+			ret, err := fn(goja.Undefined(), r.vm.ToValue(pos), r.vm.ToValue(nbt))
+			if err != nil {
+				panic(err)
+			}
+			return !isFalse(ret)
+		})
+	})
+	return obj
+}
+
+// exportBlock reads a replacement block, which is either a name or a block object
+func exportBlock(r *runtime, val goja.Value) (string, map[string]any, bool) {
+	if val == nil || goja.IsUndefined(val) || goja.IsNull(val) {
+		return "", nil, false
+	}
+	if s, ok := val.Export().(string); ok {
+		return s, map[string]any{}, true
+	}
+	obj := val.ToObject(r.vm)
+	name := obj.Get("Name")
+	if name == nil {
+		return "", nil, false
+	}
+	var properties map[string]any
+	if p := obj.Get("Properties"); p != nil && !goja.IsUndefined(p) && !goja.IsNull(p) {
+		properties, _ = p.Export().(map[string]any)
+	}
+	return name.String(), blockProperties(properties), true
+}
+
+// isFalse returns true only if the script explicitly returned false
+func isFalse(val goja.Value) bool {
+	return val != nil && val.ExportType() != nil && val.ExportType().Kind() == reflect.Bool && !val.ToBoolean()
+}
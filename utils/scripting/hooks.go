@@ -0,0 +1,168 @@
+package scripting
+
+import (
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/dop251/goja"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+func (v *VM) OnEntityAdd(entity any, metadata protocol.EntityMetadata) (ignore bool) {
+	v.call("OnEntityAdd", func(r *runtime) error {
+		if len(r.hooks.OnEntityAdd) == 0 {
+			return nil
+		}
+		data := r.vm.NewDynamicObject(entityDataObject{metadata, r.vm})
+		for _, cb := range r.hooks.OnEntityAdd {
+			if cb(entity, data) {
+				ignore = true
+			}
+		}
+		return nil
+	})
+	return ignore
+}
+
+func (v *VM) OnEntityDataUpdate(entity any, metadata protocol.EntityMetadata) {
+	v.call("OnEntityDataUpdate", func(r *runtime) error {
+		if len(r.hooks.OnEntityDataUpdate) == 0 {
+			return nil
+		}
+		data := r.vm.NewDynamicObject(entityDataObject{metadata, r.vm})
+		for _, cb := range r.hooks.OnEntityDataUpdate {
+			cb(entity, data)
+		}
+		return nil
+	})
+}
+
+func (v *VM) OnChunkAdd(pos world.ChunkPos) (ignore bool) {
+	v.call("OnChunkAdd", func(r *runtime) error {
+		for _, cb := range r.hooks.OnChunkAdd {
+			if cb(pos) {
+				ignore = true
+			}
+		}
+		return nil
+	})
+	return ignore
+}
+
+// OnBlockEntity is called with the nbt of a block entity before it is stored, the script may modify it
+func (v *VM) OnBlockEntity(pos cube.Pos, nbt map[string]any) (ignore bool) {
+	v.call("OnBlockEntity", func(r *runtime) error {
+		for _, cb := range r.hooks.OnBlockEntity {
+			if cb(pos, nbt) {
+				ignore = true
+			}
+		}
+		return nil
+	})
+	return ignore
+}
+
+// OnSave is called before a world is written to disk
+func (v *VM) OnSave(name, folder string) {
+	v.call("OnSave", func(r *runtime) error {
+		for _, cb := range r.hooks.OnSave {
+			cb(name, folder)
+		}
+		return nil
+	})
+}
+
+func (v *VM) OnAddressAndName(address, name string) {
+	v.call("OnAddressAndName", func(r *runtime) error {
+		for _, cb := range r.hooks.OnAddressAndName {
+			cb(address, name)
+		}
+		return nil
+	})
+}
+
+// OnServerConnect is called after connecting to the server, returns true if a script wants to cancel
+func (v *VM) OnServerConnect() (cancel bool) {
+	v.call("OnServerConnect", func(r *runtime) error {
+		for _, cb := range r.hooks.OnServerConnect {
+			if cb() {
+				cancel = true
+			}
+		}
+		return nil
+	})
+	return cancel
+}
+
+// OnConnect is called after the player spawned, returns true if a script wants to disconnect
+func (v *VM) OnConnect() (disconnect bool) {
+	v.call("OnConnect", func(r *runtime) error {
+		for _, cb := range r.hooks.OnConnect {
+			if cb() {
+				disconnect = true
+			}
+		}
+		return nil
+	})
+	return disconnect
+}
+
+func (v *VM) OnEnd() {
+	v.call("OnEnd", func(r *runtime) error {
+		for _, cb := range r.hooks.OnEnd {
+			cb()
+		}
+		return nil
+	})
+}
+
+// OnPacket passes a packet to the callbacks registered for it,
+// returns nil if a callback dropped the packet.
+func (v *VM) OnPacket(pk packet.Packet, toServer bool) packet.Packet {
+	name := packetName(pk)
+	if !v.hasPacketCallback(name) {
+		return pk
+	}
+	drop := false
+	v.call("OnPacket", func(r *runtime) error {
+		var cbs []goja.Callable
+		cbs = append(cbs, r.packetCBs["*"]...)
+		cbs = append(cbs, r.packetCBs[name]...)
+		if len(cbs) == 0 {
+			return nil
+		}
+
+		val := r.vm.ToValue(pk)
+		for _, cb := range cbs {
+			ret, err := cb(goja.Undefined(), val, r.vm.ToValue(toServer))
+			if err != nil {
+				return err
+			}
+			// returning false drops the packet, nothing or true keeps it
+			if isFalse(ret) {
+				drop = true
+				return nil
+			}
+		}
+		return nil
+	})
+	if drop {
+		return nil
+	}
+	return pk
+}
+
+// OnPostProcess lets the scripts change a world before it is written.
+// walking a whole world takes a while, so it gets PostProcessTimeout instead of Timeout.
+func (v *VM) OnPostProcess(pw ProcessWorld) error {
+	return v.callTimeout("OnPostProcess", v.PostProcessTimeout, func(r *runtime) error {
+		if len(r.hooks.OnPostProcess) == 0 {
+			return nil
+		}
+		obj := v.processWorldObject(r, pw)
+		for _, cb := range r.hooks.OnPostProcess {
+			cb(obj)
+		}
+		return nil
+	})
+}
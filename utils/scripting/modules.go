@@ -0,0 +1,178 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/sirupsen/logrus"
+)
+
+// runScript runs a top level script in the global scope, so the hooks it defines are visible
+func (v *VM) runScript(r *runtime, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	src, err := r.readFile(path)
+	if err != nil {
+		return err
+	}
+	r.vm.Set("require", r.requireFunc(filepath.Dir(path)))
+	_, err = r.vm.RunScript(path, src)
+	return err
+}
+
+func (r *runtime) readFile(path string) (string, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	r.files[path] = st.ModTime()
+	return string(data), nil
+}
+
+// requireFunc returns a commonjs style require that resolves paths relative to dir
+func (r *runtime) requireFunc(dir string) func(name string) goja.Value {
+	return func(name string) goja.Value {
+		path, err := resolveModule(dir, name)
+		if err != nil {
+			panic(r.vm.NewGoError(err))
+		}
+		if m, ok := r.modules[path]; ok {
+			return m.Get("exports")
+		}
+		m, err := r.loadModule(path)
+		if err != nil {
+			var ex *goja.Exception
+			if errors.As(err, &ex) {
+				panic(ex)
+			}
+			panic(r.vm.NewGoError(err))
+		}
+		return m.Get("exports")
+	}
+}
+
+func resolveModule(dir, name string) (string, error) {
+	if !strings.HasPrefix(name, "./") && !strings.HasPrefix(name, "../") && !filepath.IsAbs(name) {
+		return "", fmt.Errorf("cannot find module %q, only relative paths are supported", name)
+	}
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, name)
+	}
+	for _, p := range []string{path, path + ".js", path + ".json", filepath.Join(path, "index.js")} {
+		if st, err := os.Stat(p); err == nil && st.Mode().IsRegular() {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find module %q", name)
+}
+
+func (r *runtime) loadModule(path string) (*goja.Object, error) {
+	src, err := r.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	module := r.vm.NewObject()
+	exports := r.vm.NewObject()
+	module.Set("exports", exports)
+
+	if filepath.Ext(path) == ".json" {
+		parse, _ := goja.AssertFunction(r.vm.Get("JSON").ToObject(r.vm).Get("parse"))
+		val, err := parse(goja.Undefined(), r.vm.ToValue(src))
+		if err != nil {
+			return nil, err
+		}
+		module.Set("exports", val)
+		r.modules[path] = module
+		return module, nil
+	}
+
+	// added before running so circular requires get the partial exports
+	r.modules[path] = module
+	// kept on the first line so line numbers in errors match the file
+	wrapped := "(function(exports, require, module, __filename, __dirname) {" + src + "\n})"
+	val, err := r.vm.RunScript(path, wrapped)
+	if err != nil {
+		delete(r.modules, path)
+		return nil, err
+	}
+	fn, ok := goja.AssertFunction(val)
+	if !ok {
+		delete(r.modules, path)
+		return nil, errors.New("module wrapper is not a function")
+	}
+	dir := filepath.Dir(path)
+	_, err = fn(goja.Undefined(), exports, r.vm.ToValue(r.requireFunc(dir)), module, r.vm.ToValue(path), r.vm.ToValue(dir))
+	if err != nil {
+		delete(r.modules, path)
+		return nil, err
+	}
+	return module, nil
+}
+
+// changed returns true if any file used by the scripts was modified since loading
+func (r *runtime) changed() bool {
+	for path, modTime := range r.files {
+		st, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !st.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads the scripts whenever one of their files changes and saves the store, until ctx is done
+func (v *VM) Watch(ctx context.Context) {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if err := v.SaveStore(); err != nil {
+			logrus.Errorf("scripting: saving store: %s", err)
+		}
+
+		v.l.Lock()
+		changed := v.rt != nil && v.rt.changed()
+		v.l.Unlock()
+		if !changed {
+			continue
+		}
+
+		if err := v.Reload(); err != nil {
+			v.l.Lock()
+			// dont try again until the files change again
+			for path := range v.rt.files {
+				if st, err := os.Stat(path); err == nil {
+					v.rt.files[path] = st.ModTime()
+				}
+			}
+			v.reportError("reload", err)
+			v.l.Unlock()
+			continue
+		}
+		logrus.Info("scripting: reloaded scripts")
+		if v.env.SendMessage != nil {
+			v.env.SendMessage("reloaded scripts")
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package scripting
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultOutputDir is where scripts write their files to when nothing else is set
+const DefaultOutputDir = "script-output"
+
+// output is everything scripts write to disk, it is kept when scripts are reloaded.
+// files go into a folder per session, the store is shared by all sessions.
+type output struct {
+	dir     string
+	started time.Time
+	files   map[string]*os.File
+
+	store       map[string]json.RawMessage
+	storeLoaded bool
+	storeDirty  bool
+}
+
+func newOutput(dir string) *output {
+	return &output{
+		dir:     dir,
+		started: time.Now(),
+		files:   make(map[string]*os.File),
+		store:   make(map[string]json.RawMessage),
+	}
+}
+
+func (o *output) sessionFolder() string {
+	return filepath.Join(o.dir, o.started.Format("2006-01-02_15-04-05"))
+}
+
+func (o *output) storePath() string {
+	return filepath.Join(o.dir, "store.json")
+}
+
+// path returns where a file scripts write to is, names can't leave the session folder.
+// the extension is added if the name doesn't have it.
+func (o *output) path(name, ext string) (string, error) {
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	if !strings.EqualFold(filepath.Ext(name), ext) {
+		name += ext
+	}
+	return filepath.Join(o.sessionFolder(), name), nil
+}
+
+// appendFile returns the file at path opened for appending, isNew is true if it was empty
+func (o *output) appendFile(path string) (f *os.File, isNew bool, err error) {
+	f, ok := o.files[path]
+	if !ok {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, false, err
+		}
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, false, err
+		}
+		o.files[path] = f
+	}
+	st, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	return f, st.Size() == 0, nil
+}
+
+func (o *output) appendCSV(name string, row, header []string) error {
+	path, err := o.path(name, ".csv")
+	if err != nil {
+		return err
+	}
+	f, isNew, err := o.appendFile(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if isNew && header != nil {
+		w.Write(header)
+	}
+	w.Write(row)
+	w.Flush()
+	return w.Error()
+}
+
+func (o *output) appendJSONL(name string, value goja.Value) error {
+	path, err := o.path(name, ".jsonl")
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(jsonValue(value))
+	if err != nil {
+		return err
+	}
+	f, _, err := o.appendFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// writePNG writes an image from rgba bytes, replacing the file if it exists
+func (o *output) writePNG(name string, width, height int, pixels []byte) error {
+	if width <= 0 || height <= 0 {
+		return errors.New("invalid image size")
+	}
+	if len(pixels) != width*height*4 {
+		return fmt.Errorf("expected %d values for a %dx%d image, got %d", width*height*4, width, height, len(pixels))
+	}
+	path, err := o.path(name, ".png")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	img := &image.NRGBA{
+		Pix:    pixels,
+		Stride: width * 4,
+		Rect:   image.Rect(0, 0, width, height),
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, img)
+}
+
+func (o *output) loadStore() error {
+	if o.storeLoaded {
+		return nil
+	}
+	data, err := os.ReadFile(o.storePath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &o.store); err != nil {
+			return fmt.Errorf("%s: %w", o.storePath(), err)
+		}
+	}
+	o.storeLoaded = true
+	return nil
+}
+
+// saveStore writes the store if it changed, through a temporary file so it is never left half written
+func (o *output) saveStore() error {
+	if !o.storeDirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(o.store, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(o.dir, 0o755); err != nil {
+		return err
+	}
+	tmp := o.storePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, o.storePath()); err != nil {
+		return err
+	}
+	o.storeDirty = false
+	return nil
+}
+
+func (o *output) close() {
+	for path, f := range o.files {
+		f.Close()
+		delete(o.files, path)
+	}
+	if err := o.saveStore(); err != nil {
+		logrus.Errorf("scripting: saving store: %s", err)
+	}
+}
+
+// jsonValue returns something json.Marshal encodes like JSON.stringify would
+func jsonValue(val goja.Value) any {
+	if obj, ok := val.(*goja.Object); ok {
+		return obj
+	}
+	return val.Export()
+}
+
+// csvRow converts the values of a js array to csv fields
+func csvRow(r *goja.Runtime, val goja.Value) []string {
+	if val == nil || goja.IsUndefined(val) || goja.IsNull(val) {
+		return nil
+	}
+	var values []goja.Value
+	if err := r.ExportTo(val, &values); err != nil {
+		panic(r.NewTypeError("expected an array"))
+	}
+	row := make([]string, len(values))
+	for i, v := range values {
+		switch e := v.Export().(type) {
+		case nil:
+		case string:
+			row[i] = e
+		case int64:
+			row[i] = strconv.FormatInt(e, 10)
+		case float64:
+			row[i] = strconv.FormatFloat(e, 'f', -1, 64)
+		case bool:
+			row[i] = strconv.FormatBool(e)
+		default:
+			data, err := json.Marshal(jsonValue(v))
+			if err != nil {
+				panic(r.NewGoError(err))
+			}
+			row[i] = string(data)
+		}
+	}
+	return row
+}
+
+// setupOutput adds the Output and Store globals
+func (v *VM) setupOutput(r *runtime) {
+	check := func(err error) {
+		if err != nil {
+			panic(r.vm.NewGoError(err))
+		}
+	}
+
+	out := r.vm.NewObject()
+	out.Set("Folder", func() string {
+		return v.out.sessionFolder()
+	})
+	out.Set("AppendCSV", func(name string, row, header goja.Value) {
+		fields := csvRow(r.vm, row)
+		if fields == nil {
+			panic(r.vm.NewTypeError("AppendCSV: missing row"))
+		}
+		check(v.out.appendCSV(name, fields, csvRow(r.vm, header)))
+	})
+	out.Set("AppendJSONL", func(name string, value goja.Value) {
+		check(v.out.appendJSONL(name, value))
+	})
+	out.Set("WritePNG", func(name string, width, height int, pixels goja.Value) {
+		var pix []byte
+		if err := r.vm.ExportTo(pixels, &pix); err != nil {
+			panic(r.vm.NewTypeError("WritePNG: pixels must be an array of rgba values"))
+		}
+		check(v.out.writePNG(name, width, height, pix))
+	})
+	r.vm.GlobalObject().Set("Output", out)
+
+	parse, _ := goja.AssertFunction(r.vm.Get("JSON").ToObject(r.vm).Get("parse"))
+	store := r.vm.NewObject()
+	store.Set("Get", func(key string) goja.Value {
+		check(v.out.loadStore())
+		data, ok := v.out.store[key]
+		if !ok {
+			return goja.Undefined()
+		}
+		val, err := parse(goja.Undefined(), r.vm.ToValue(string(data)))
+		check(err)
+		return val
+	})
+	store.Set("Set", func(key string, value goja.Value) {
+		check(v.out.loadStore())
+		if goja.IsUndefined(value) {
+			delete(v.out.store, key)
+		} else {
+			data, err := json.Marshal(jsonValue(value))
+			check(err)
+			v.out.store[key] = data
+		}
+		v.out.storeDirty = true
+	})
+	store.Set("Delete", func(key string) {
+		check(v.out.loadStore())
+		delete(v.out.store, key)
+		v.out.storeDirty = true
+	})
+	store.Set("Keys", func() []string {
+		check(v.out.loadStore())
+		keys := make([]string, 0, len(v.out.store))
+		for k := range v.out.store {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	})
+	r.vm.GlobalObject().Set("Store", store)
+}
+
+// SaveStore writes the store to disk if scripts changed it
+func (v *VM) SaveStore() error {
+	v.l.Lock()
+	defer v.l.Unlock()
+	if v.out == nil {
+		return nil
+	}
+	return v.out.saveStore()
+}
+
+// Close closes all files the scripts wrote to and saves the store, scripts can still write after it.
+func (v *VM) Close() {
+	v.l.Lock()
+	defer v.l.Unlock()
+	if v.out != nil {
+		v.out.close()
+	}
+}
@@ -0,0 +1,44 @@
+package scripting
+
+import (
+	"fmt"
+
+	"github.com/bedrock-tool/bedrocktool/utils/proxy"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// ProxyEnv returns an Env that uses the proxy session passed, World is left empty.
+func ProxyEnv(pc *proxy.Context) Env {
+	return Env{
+		PlayerPosition: func() mgl32.Vec3 {
+			return pc.Player.Position
+		},
+		SendMessage: pc.SendMessage,
+		AddCommand: func(exec func([]string) bool, cmd protocol.Command) {
+			pc.RegisterCommand(proxy.Command{
+				Name:        cmd.Name,
+				Description: cmd.Description,
+				Overloads: []proxy.CommandOverload{{
+					Params: []proxy.CommandParam{{Name: "args", Type: proxy.ParamWords, Optional: true}},
+					Run: func(args proxy.CommandArgs) error {
+						words := args.Words("args")
+						if words == nil {
+							words = []string{}
+						}
+						if !exec(words) {
+							return fmt.Errorf("%s failed", cmd.Name)
+						}
+						return nil
+					},
+				}},
+			})
+		},
+		RemoveCommand: pc.RemoveCommand,
+		WritePacket: func(pk packet.Packet, toServer bool) error {
+			pc.Inject(proxy.Injection{Packet: pk, ToServer: toServer})
+			return nil
+		},
+	}
+}
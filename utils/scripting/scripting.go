@@ -0,0 +1,416 @@
+package scripting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/df-mc/dragonfly/server/block/cube"
+	"github.com/df-mc/dragonfly/server/world"
+	"github.com/dop251/goja"
+	"github.com/gregwebs/go-recovery"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sirupsen/logrus"
+
+	_ "embed"
+)
+
+//go:embed enums.js
+var enums_js string
+
+// DefaultTimeout is how long a callback may run before it is interrupted
+const DefaultTimeout = time.Second
+
+// DefaultPostProcessTimeout is how long OnPostProcess may run, it walks whole worlds
+const DefaultPostProcessTimeout = 5 * time.Minute
+
+// loading runs all the top level code of the scripts, so it gets more time
+const loadTimeout = 10 * time.Second
+
+type VM struct {
+	env Env
+	// how long a single callback may run, 0 for no limit
+	Timeout time.Duration
+	// how long OnPostProcess may run, 0 for no limit
+	PostProcessTimeout time.Duration
+	// where Output and Store write to, DefaultOutputDir if empty
+	OutputDir string
+
+	// goja runtimes are not safe to use from multiple goroutines
+	l       sync.Mutex
+	rt      *runtime
+	scripts []string
+	// commands that were added to the proxy, a reload only replaces their callback
+	commands map[string]bool
+	out      *output
+	// names of the packets the current runtime has callbacks for,
+	// read without the lock so packets without callbacks dont wait for a running script
+	packetNames atomic.Pointer[map[string]bool]
+
+	lastError     string
+	lastErrorTime time.Time
+}
+
+// runtime is one instance of all loaded scripts, reloading replaces it
+type runtime struct {
+	vm        *goja.Runtime
+	hooks     hooks
+	packetCBs map[string][]goja.Callable
+	commands  map[string]goja.Callable
+	// modules by absolute path
+	modules map[string]*goja.Object
+	// modification times of every file loaded, used to detect changes
+	files map[string]time.Time
+}
+
+// hooks are the callbacks scripts define as global functions, every script can define each of them
+type hooks struct {
+	OnEntityAdd        []func(entity any, metadata *goja.Object) (ignore bool)
+	OnChunkAdd         []func(pos world.ChunkPos) (ignore bool)
+	OnEntityDataUpdate []func(entity any, metadata *goja.Object)
+	OnBlockEntity      []func(pos cube.Pos, nbt map[string]any) (ignore bool)
+	OnSave             []func(name, folder string)
+	OnPostProcess      []func(world *goja.Object)
+
+	// connection lifecycle, see proxy.Handler
+	OnAddressAndName []func(address, name string)
+	OnServerConnect  []func() (cancel bool)
+	OnConnect        []func() (disconnect bool)
+	OnEnd            []func()
+}
+
+func New() *VM {
+	return &VM{
+		Timeout:            DefaultTimeout,
+		PostProcessTimeout: DefaultPostProcessTimeout,
+		commands:           make(map[string]bool),
+	}
+}
+
+// SetEnv sets what the scripts use to access the proxy, has to be called before loading
+func (v *VM) SetEnv(env Env) {
+	v.l.Lock()
+	defer v.l.Unlock()
+	v.env = env
+}
+
+// Load runs the scripts at the paths passed, replacing all previously loaded ones
+func (v *VM) Load(paths []string) error {
+	v.l.Lock()
+	defer v.l.Unlock()
+	rt, err := v.newRuntime(paths, nil)
+	if err != nil {
+		return err
+	}
+	v.scripts = paths
+	v.setRuntime(rt)
+	v.removeStaleCommands()
+	return nil
+}
+
+// Loaded returns true if scripts have been loaded
+func (v *VM) Loaded() bool {
+	v.l.Lock()
+	defer v.l.Unlock()
+	return v.rt != nil
+}
+
+// Reload runs all scripts again in a new runtime, the global state object is kept.
+// if loading fails the old scripts keep running.
+func (v *VM) Reload() error {
+	v.l.Lock()
+	defer v.l.Unlock()
+	if v.rt == nil {
+		return nil
+	}
+	state, err := v.rt.state()
+	if err != nil {
+		logrus.Warnf("scripting: not keeping state: %s", err)
+	}
+	rt, err := v.newRuntime(v.scripts, state)
+	if err != nil {
+		// the failed runtime may have added commands the old one doesnt have
+		v.removeStaleCommands()
+		return err
+	}
+	v.setRuntime(rt)
+	v.removeStaleCommands()
+	return nil
+}
+
+// setRuntime makes rt the current runtime, v.l has to be held
+func (v *VM) setRuntime(rt *runtime) {
+	v.rt = rt
+	v.updatePacketNames()
+}
+
+// updatePacketNames copies the packet names of the current runtime for hasPacketCallback
+func (v *VM) updatePacketNames() {
+	names := make(map[string]bool, len(v.rt.packetCBs))
+	for name, cbs := range v.rt.packetCBs {
+		if len(cbs) > 0 {
+			names[name] = true
+		}
+	}
+	v.packetNames.Store(&names)
+}
+
+// HasPacketCallbacks is true if the loaded scripts registered a packet callback.
+// handlers that don't get packets without one miss the ones a later reload adds.
+func (v *VM) HasPacketCallbacks() bool {
+	names := v.packetNames.Load()
+	return names != nil && len(*names) > 0
+}
+
+// hasPacketCallback is true if a script wants packets with this name, it doesnt lock the vm
+func (v *VM) hasPacketCallback(name string) bool {
+	names := v.packetNames.Load()
+	if names == nil {
+		return false
+	}
+	return (*names)["*"] || (*names)[name]
+}
+
+// removeStaleCommands removes the commands from the proxy that the current runtime doesnt define
+func (v *VM) removeStaleCommands() {
+	for name := range v.commands {
+		if _, ok := v.rt.commands[name]; ok {
+			continue
+		}
+		delete(v.commands, name)
+		if v.env.RemoveCommand != nil {
+			v.env.RemoveCommand(name)
+		}
+	}
+}
+
+func (v *VM) newRuntime(paths []string, state []byte) (*runtime, error) {
+	if v.out == nil {
+		dir := v.OutputDir
+		if dir == "" {
+			dir = DefaultOutputDir
+		}
+		v.out = newOutput(dir)
+	}
+
+	r := &runtime{
+		vm:        goja.New(),
+		packetCBs: make(map[string][]goja.Callable),
+		commands:  make(map[string]goja.Callable),
+		modules:   make(map[string]*goja.Object),
+		files:     make(map[string]time.Time),
+	}
+	console := r.vm.NewObject()
+	console.Set("log", func(val goja.Value) {
+		if val.SameAs(goja.Undefined()) {
+			logrus.Println("undefined")
+			return
+		}
+
+		if val.ExportType().Kind() == reflect.String {
+			logrus.Println(val.String())
+			return
+		}
+		obj := val.ToObject(r.vm)
+		data, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		logrus.Println(string(data))
+	})
+
+	r.vm.GlobalObject().Set("console", console)
+	v.setupAPI(r)
+	v.setupOutput(r)
+
+	_, err := r.vm.RunString(enums_js)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := r.setState(state); err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		err := r.run(loadTimeout, func() error {
+			return v.runScript(r, path)
+		})
+		if err != nil {
+			return nil, err
+		}
+		r.resolveHooks()
+	}
+	return r, nil
+}
+
+func (r *runtime) resolveHooks() {
+	resolveHook(r, "OnEntityAdd", &r.hooks.OnEntityAdd)
+	resolveHook(r, "OnChunkAdd", &r.hooks.OnChunkAdd)
+	resolveHook(r, "OnEntityDataUpdate", &r.hooks.OnEntityDataUpdate)
+	resolveHook(r, "OnBlockEntity", &r.hooks.OnBlockEntity)
+	resolveHook(r, "OnSave", &r.hooks.OnSave)
+	resolveHook(r, "OnPostProcess", &r.hooks.OnPostProcess)
+	resolveHook(r, "OnAddressAndName", &r.hooks.OnAddressAndName)
+	resolveHook(r, "OnServerConnect", &r.hooks.OnServerConnect)
+	resolveHook(r, "OnConnect", &r.hooks.OnConnect)
+	resolveHook(r, "OnEnd", &r.hooks.OnEnd)
+}
+
+// resolveHook adds the global function name to the hooks,
+// then clears it so the next script can define its own.
+func resolveHook[T any](r *runtime, name string, list *[]T) {
+	val := r.vm.Get(name)
+	if val == nil || goja.IsUndefined(val) || goja.IsNull(val) {
+		return
+	}
+	var fn T
+	if err := r.vm.ExportTo(val, &fn); err != nil {
+		logrus.Errorf("scripting: %s: %s", name, err)
+		return
+	}
+	*list = append(*list, fn)
+	r.vm.Set(name, goja.Undefined())
+}
+
+// state returns the global state object as json
+func (r *runtime) state() ([]byte, error) {
+	val := r.vm.Get("state")
+	if val == nil || goja.IsUndefined(val) {
+		return nil, nil
+	}
+	return json.Marshal(val)
+}
+
+func (r *runtime) setState(state []byte) error {
+	if state == nil {
+		return r.vm.Set("state", r.vm.NewObject())
+	}
+	parse, _ := goja.AssertFunction(r.vm.Get("JSON").ToObject(r.vm).Get("parse"))
+	val, err := parse(goja.Undefined(), r.vm.ToValue(string(state)))
+	if err != nil {
+		return err
+	}
+	return r.vm.Set("state", val)
+}
+
+// run calls fn, interrupting the script if it takes longer than timeout
+func (r *runtime) run(timeout time.Duration, fn func() error) error {
+	if timeout > 0 {
+		t := time.AfterFunc(timeout, func() {
+			r.vm.Interrupt(fmt.Sprintf("took longer than %s", timeout))
+		})
+		defer func() {
+			t.Stop()
+			r.vm.ClearInterrupt()
+		}()
+	}
+	return recovery.Call(fn)
+}
+
+// call runs fn with the vm locked, errors thrown by the script are reported instead of stopping the proxy
+func (v *VM) call(name string, fn func(r *runtime) error) error {
+	return v.callTimeout(name, v.Timeout, fn)
+}
+
+func (v *VM) callTimeout(name string, timeout time.Duration, fn func(r *runtime) error) error {
+	v.l.Lock()
+	defer v.l.Unlock()
+	if v.rt == nil {
+		return nil
+	}
+	r := v.rt
+	err := r.run(timeout, func() error {
+		return fn(r)
+	})
+	if err != nil {
+		v.reportError(name, err)
+	}
+	return err
+}
+
+// reportError logs the error and sends it to the player
+func (v *VM) reportError(name string, err error) {
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		err = fmt.Errorf("interrupted, %v", interrupted.Value())
+	}
+	logrus.Errorf("scripting: %s: %s", name, err)
+
+	if v.env.SendMessage == nil {
+		return
+	}
+	msg := fmt.Sprintf("§cscript error in %s: %s", name, err)
+	// dont flood the chat when a callback fails on every packet
+	if msg == v.lastError && time.Since(v.lastErrorTime) < 10*time.Second {
+		return
+	}
+	v.lastError = msg
+	v.lastErrorTime = time.Now()
+	v.env.SendMessage(msg)
+}
+
+type entityDataObject struct {
+	d protocol.EntityMetadata
+	r *goja.Runtime
+}
+
+func (m entityDataObject) Get(key string) goja.Value {
+	if key == "Flag" {
+		f := m.d.Flag
+		return m.r.ToValue(&f)
+	}
+	if key == "SetFlag" {
+		f := m.d.SetFlag
+		return m.r.ToValue(&f)
+	}
+
+	k, err := strconv.Atoi(key)
+	if err != nil {
+		return nil
+	}
+	d, ok := m.d[uint32(k)]
+	if !ok {
+		return nil
+	}
+	return m.r.ToValue(d)
+}
+
+func (m entityDataObject) Set(key string, val goja.Value) bool {
+	k, err := strconv.Atoi(key)
+	if err != nil {
+		return false
+	}
+	m.d[uint32(k)] = val.Export()
+	return true
+}
+
+func (m entityDataObject) Has(key string) bool {
+	k, err := strconv.Atoi(key)
+	if err != nil {
+		return false
+	}
+	_, ok := m.d[uint32(k)]
+	return ok
+}
+
+func (m entityDataObject) Delete(key string) bool {
+	k, err := strconv.Atoi(key)
+	if err != nil {
+		return false
+	}
+	delete(m.d, uint32(k))
+	return true
+}
+
+func (m entityDataObject) Keys() (keys []string) {
+	for k := range m.d {
+		keys = append(keys, strconv.Itoa(int(k)))
+	}
+	return
+}
@@ -26,7 +26,6 @@ import (
 	"github.com/tailscale/hujson"
 
 	"github.com/sandertv/gophertunnel/minecraft/protocol"
-	"github.com/sandertv/gophertunnel/minecraft/resource"
 )
 
 var Options struct {
@@ -34,6 +33,10 @@ var Options struct {
 	IsInteractive      bool
 	ExtraDebug         bool
 	Capture            bool
+	Spectators         int
+	Reconnect          int
+	InjectRate         int
+	Listen             ListenConfig
 	PathCustomUserData string
 }
 
@@ -67,7 +70,9 @@ func RandSeededUUID(str string) string {
 	return id.String()
 }
 
-func WriteManifest(manifest *resource.Manifest, fpath string) error {
+// WriteManifest writes manifest.json to fpath, manifest is usually a *resource.Manifest
+// but can be any other manifest layout such as the one used by world templates
+func WriteManifest(manifest any, fpath string) error {
 	w, err := os.Create(filepath.Join(fpath, "manifest.json"))
 	if err != nil {
 		return err
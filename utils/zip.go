@@ -2,26 +2,20 @@ package utils
 
 import (
 	"archive/zip"
+	"bytes"
 	"compress/flate"
+	"hash/crc32"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 
 	"github.com/sirupsen/logrus"
 )
 
-type closePutback struct {
-	*flate.Writer
-}
-
-func (c closePutback) Close() error {
-	deflate.ReturnWriter(c.Writer)
-	return nil
-}
-
 type DeflatePool struct {
 	pool sync.Pool
 }
@@ -43,6 +37,49 @@ func (pool *DeflatePool) ReturnWriter(writer *flate.Writer) {
 	pool.pool.Put(writer)
 }
 
+type zipEntry struct {
+	header *zip.FileHeader
+	data   bytes.Buffer
+	err    error
+}
+
+// compressEntry deflates a single file into memory so it can be written with zip.CreateRaw
+func compressEntry(fpath, name string) (e *zipEntry) {
+	e = &zipEntry{}
+	f, err := os.Open(fpath)
+	if err != nil {
+		e.err = err
+		return e
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		e.err = err
+		return e
+	}
+
+	crc := crc32.NewIEEE()
+	w := deflate.GetWriter(&e.data)
+	n, err := io.Copy(io.MultiWriter(w, crc), f)
+	deflate.ReturnWriter(w)
+	if err != nil {
+		e.err = err
+		return e
+	}
+
+	e.header = &zip.FileHeader{
+		Name:               name,
+		Method:             zip.Deflate,
+		Modified:           info.ModTime(),
+		CRC32:              crc.Sum32(),
+		CompressedSize64:   uint64(e.data.Len()),
+		UncompressedSize64: uint64(n),
+	}
+	return e
+}
+
+// ZipFolder writes all files in folder to a zip at filename.
+// files are compressed in parallel and streamed into the zip in walk order.
 func ZipFolder(filename, folder string) error {
 	f, err := os.Create(filename)
 	if err != nil {
@@ -51,36 +88,55 @@ func ZipFolder(filename, folder string) error {
 	defer f.Close()
 	zw := zip.NewWriter(f)
 
-	// Register a custom Deflate compressor.
-	zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
-		w := deflate.GetWriter(out)
-		return closePutback{w}, nil
-	})
+	// each file gets its own result channel, the buffer limits how many are compressed at once
+	pending := make(chan chan *zipEntry, runtime.NumCPU())
+	var walkErr error
+	go func() {
+		defer close(pending)
+		walkErr = filepath.WalkDir(folder, func(fpath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(folder, fpath)
+			if err != nil {
+				return err
+			}
+			rel = strings.ReplaceAll(rel, "\\", "/")
 
-	err = filepath.WalkDir(folder, func(fpath string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.Type().IsDir() {
+			c := make(chan *zipEntry, 1)
+			pending <- c
+			go func() {
+				c <- compressEntry(fpath, rel)
+			}()
 			return nil
+		})
+	}()
+
+	var writeErr error
+	for c := range pending {
+		e := <-c
+		if writeErr != nil {
+			continue
 		}
-		rel, err := filepath.Rel(folder, fpath)
-		if err != nil {
-			return err
+		if e.err != nil {
+			logrus.Error(e.err)
+			continue
 		}
-		rel = strings.ReplaceAll(rel, "\\", "/")
-
-		zwf, _ := zw.Create(rel)
-		f, err := os.Open(fpath)
+		zwf, err := zw.CreateRaw(e.header)
 		if err != nil {
-			logrus.Error(err)
-			return nil
+			writeErr = err
+			continue
 		}
-		_, err = io.Copy(zwf, f)
-		return err
-	})
-	if err != nil {
-		return err
+		_, writeErr = zwf.Write(e.data.Bytes())
+	}
+	if walkErr != nil {
+		return walkErr
+	}
+	if writeErr != nil {
+		return writeErr
 	}
 
 	return zw.Close()